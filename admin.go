@@ -0,0 +1,311 @@
+package mnemosyne
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// AdminAuthorizer decides whether a mutating admin request, or one reading a cached value, is allowed,
+// a non-nil error rejects it
+type AdminAuthorizer func(r *http.Request) error
+
+// AdminOption configures the admin handler
+type AdminOption func(*adminHandler)
+
+// WithAdminAuthorizer sets the authorization hook of the mutating and value reading admin endpoints,
+// without one all such requests are rejected
+func WithAdminAuthorizer(authorizer AdminAuthorizer) AdminOption {
+	return func(h *adminHandler) {
+		h.authorizer = authorizer
+	}
+}
+
+// WithAdminLogger sets the logger which authorized admin calls are logged to (default: the logger of Mnemosyne)
+func WithAdminLogger(logger Logger) AdminOption {
+	return func(h *adminHandler) {
+		h.logger = logger
+	}
+}
+
+// AdminLayer is the state of a cache layer as reported by the admin handler
+type AdminLayer struct {
+	LayerStats
+	Amnesia int
+	// Chaos is set for the layers with a chaos config
+	Chaos *ChaosConfig `json:",omitempty"`
+}
+
+// AdminInstance is the state of a cache instance as reported by the admin handler
+type AdminInstance struct {
+	Name    string
+	Layers  []AdminLayer
+	Hits    uint64
+	Misses  uint64
+	HitRate float64
+}
+
+type adminHandler struct {
+	mnemosyne  *Mnemosyne
+	authorizer AdminAuthorizer
+	logger     Logger
+}
+
+// NewAdminHandler returns an http.Handler for inspecting and managing the cache instances, meant to be mounted
+// on an internal admin port (use http.StripPrefix to mount it under a path). Its endpoints, all speaking JSON, are:
+//
+//	GET    /instances                                  lists the instances with their layers and hit/miss counts
+//	GET    /instances/{instance}                       a single instance
+//	GET    /instances/{instance}/entry?key=            every layer's view of a key, see MnemosyneInstance.Explain
+//	DELETE /instances/{instance}/entry?key=            deletes a key from all layers
+//	POST   /instances/{instance}/layers/{layer}/flush  flushes a layer
+//	PUT    /instances/{instance}/layers/{layer}/amnesia sets the amnesia chance of a layer, body: {"chance": 10}
+//	PUT    /instances/{instance}/layers/{layer}/chaos   sets the fault injection of a layer, body: a ChaosConfig
+//	                                                    like {"error": 5, "latency": "50ms", "latency_chance": 20}
+//
+// Mutating endpoints and the entry endpoint (whose values are as sensitive as the cache is, encrypted or not)
+// go through the authorizer and every call of them is logged
+func NewAdminHandler(m *Mnemosyne, opts ...AdminOption) http.Handler {
+	h := &adminHandler{
+		mnemosyne: m,
+		logger:    m.logger,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	if h.logger == nil {
+		h.logger = defaultLogger
+	}
+	return h
+}
+
+func (h *adminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if parts[0] != "instances" {
+		writeAdminError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+	if len(parts) == 1 {
+		h.requireMethod(w, r, http.MethodGet, h.listInstances)
+		return
+	}
+	instance := h.mnemosyne.Select(parts[1])
+	if instance == nil {
+		writeAdminError(w, http.StatusNotFound, errors.New("instance not found"))
+		return
+	}
+	switch {
+	case len(parts) == 2:
+		h.requireMethod(w, r, http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+			writeAdminJSON(w, http.StatusOK, describeInstance(instance))
+		})
+	case len(parts) == 3 && parts[2] == "entry":
+		h.serveEntry(w, r, instance)
+	case len(parts) == 5 && parts[2] == "layers" && parts[4] == "flush":
+		h.requireMethod(w, r, http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+			h.flushLayer(w, r, instance, parts[3])
+		})
+	case len(parts) == 5 && parts[2] == "layers" && parts[4] == "amnesia":
+		h.requireMethod(w, r, http.MethodPut, func(w http.ResponseWriter, r *http.Request) {
+			h.setAmnesia(w, r, instance, parts[3])
+		})
+	case len(parts) == 5 && parts[2] == "layers" && parts[4] == "chaos":
+		h.requireMethod(w, r, http.MethodPut, func(w http.ResponseWriter, r *http.Request) {
+			h.setChaos(w, r, instance, parts[3])
+		})
+	default:
+		writeAdminError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+func (h *adminHandler) requireMethod(w http.ResponseWriter, r *http.Request, method string, handle http.HandlerFunc) {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		writeAdminError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	handle(w, r)
+}
+
+func (h *adminHandler) listInstances(w http.ResponseWriter, r *http.Request) {
+	names := h.mnemosyne.Instances()
+	instances := make([]AdminInstance, len(names))
+	for i, name := range names {
+		instances[i] = describeInstance(h.mnemosyne.childs[name])
+	}
+	writeAdminJSON(w, http.StatusOK, instances)
+}
+
+func describeInstance(mn *MnemosyneInstance) AdminInstance {
+	stats := mn.Stats()
+	res := AdminInstance{
+		Name:    mn.name,
+		Layers:  make([]AdminLayer, len(stats.Layers)),
+		Hits:    stats.Hits,
+		Misses:  stats.Misses,
+		HitRate: stats.HitRate,
+	}
+	for i, layerStats := range stats.Layers {
+		res.Layers[i].LayerStats = layerStats
+		if layerWithAmnesia, ok := unwrapLayer(mn.cacheLayers[i]).(amnesiac); ok {
+			res.Layers[i].Amnesia = layerWithAmnesia.amnesia()
+		}
+		if cl, ok := mn.cacheLayers[i].(*chaosLayer); ok {
+			chaos := cl.chaos()
+			res.Layers[i].Chaos = &chaos
+		}
+	}
+	return res
+}
+
+func (h *adminHandler) serveEntry(w http.ResponseWriter, r *http.Request, mn *MnemosyneInstance) {
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		writeAdminError(w, http.StatusBadRequest, errors.New("key is required"))
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		fields := Fields{FieldInstance: mn.name, FieldKeyHash: keyHash(key)}
+		if !h.authorize(w, r, "read-entry", fields) {
+			return
+		}
+		explanation, err := mn.Explain(r.Context(), key)
+		h.audit(r, "read-entry", fields, err)
+		if err != nil {
+			writeAdminError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeAdminJSON(w, http.StatusOK, explanation)
+	case http.MethodDelete:
+		fields := Fields{FieldInstance: mn.name, FieldKeyHash: keyHash(key)}
+		if !h.authorize(w, r, "delete", fields) {
+			return
+		}
+		err := mn.Delete(r.Context(), key)
+		h.audit(r, "delete", fields, err)
+		if err != nil {
+			writeAdminError(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", http.MethodGet+", "+http.MethodDelete)
+		writeAdminError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	}
+}
+
+func (h *adminHandler) flushLayer(w http.ResponseWriter, r *http.Request, mn *MnemosyneInstance, layerName string) {
+	if !hasLayer(mn, layerName) {
+		writeAdminError(w, http.StatusNotFound, errors.New("layer not found"))
+		return
+	}
+	fields := Fields{FieldInstance: mn.name, FieldLayer: layerName}
+	if !h.authorize(w, r, "flush", fields) {
+		return
+	}
+	err := mn.Flush(layerName)
+	h.audit(r, "flush", fields, err)
+	if err != nil {
+		writeAdminError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *adminHandler) setAmnesia(w http.ResponseWriter, r *http.Request, mn *MnemosyneInstance, layerName string) {
+	if !hasLayer(mn, layerName) {
+		writeAdminError(w, http.StatusNotFound, errors.New("layer not found"))
+		return
+	}
+	var body struct {
+		Chance *int `json:"chance"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Chance == nil {
+		writeAdminError(w, http.StatusBadRequest, errors.New(`body must be like {"chance": 10}`))
+		return
+	}
+	fields := Fields{FieldInstance: mn.name, FieldLayer: layerName, "chance": *body.Chance}
+	if !h.authorize(w, r, "set-amnesia", fields) {
+		return
+	}
+	err := mn.SetAmnesia(layerName, *body.Chance)
+	h.audit(r, "set-amnesia", fields, err)
+	if err != nil {
+		writeAdminError(w, http.StatusBadRequest, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *adminHandler) setChaos(w http.ResponseWriter, r *http.Request, mn *MnemosyneInstance, layerName string) {
+	if !hasLayer(mn, layerName) {
+		writeAdminError(w, http.StatusNotFound, errors.New("layer not found"))
+		return
+	}
+	var body ChaosConfig
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeAdminError(w, http.StatusBadRequest, fmt.Errorf("body must be a chaos config: %w", err))
+		return
+	}
+	fields := Fields{FieldInstance: mn.name, FieldLayer: layerName, "chaos": body}
+	if !h.authorize(w, r, "set-chaos", fields) {
+		return
+	}
+	err := mn.SetChaos(layerName, body)
+	h.audit(r, "set-chaos", fields, err)
+	if err != nil {
+		writeAdminError(w, http.StatusBadRequest, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authorize runs the authorizer for a mutating or value reading call and rejects the request if it's not allowed
+func (h *adminHandler) authorize(w http.ResponseWriter, r *http.Request, action string, fields Fields) bool {
+	err := errors.New("no admin authorizer is configured")
+	if h.authorizer != nil {
+		err = h.authorizer(r)
+	}
+	if err != nil {
+		h.audit(r, action+" (denied)", fields, err)
+		writeAdminError(w, http.StatusForbidden, err)
+		return false
+	}
+	return true
+}
+
+// audit logs an authorized call, at info level so it's never rate limited
+func (h *adminHandler) audit(r *http.Request, action string, fields Fields, err error) {
+	auditFields := make(Fields, len(fields)+3)
+	for name, value := range fields {
+		auditFields[name] = value
+	}
+	auditFields["action"] = action
+	auditFields["remote_addr"] = r.RemoteAddr
+	if err != nil {
+		auditFields[FieldError] = err
+	}
+	h.logger.Info("mnemosyne admin call", auditFields)
+}
+
+func hasLayer(mn *MnemosyneInstance, layerName string) bool {
+	for _, layer := range mn.cacheLayers {
+		if layer.Name() == layerName {
+			return true
+		}
+	}
+	return false
+}
+
+func writeAdminJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeAdminError(w http.ResponseWriter, status int, err error) {
+	writeAdminJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -2,51 +2,143 @@ package mnemosyne
 
 import (
 	"context"
-	"math/rand"
+	"encoding/json"
+	"fmt"
+	"sync"
 	"time"
 
 	goCache "github.com/patrickmn/go-cache"
 )
 
+const (
+	// ValueModeCodec stores encoded payloads and decodes them into the refrence on each Get, like the other layers
+	ValueModeCodec = "codec"
+	// ValueModeZeroCopy stores the values as-is and returns the very same object on each Get,
+	// values read in this mode are shared between callers and MUST be treated as immutable
+	ValueModeZeroCopy = "zero-copy"
+)
+
+// fastMemoryItem is what the layer keeps in go-cache. Its expiry is measured by the clock of the instance,
+// so values age and expire the same way on Get and TTL (go-cache's own wall clock expiry only frees memory)
+type fastMemoryItem struct {
+	// value is the encoded payload, or the *Cachable itself in zero-copy mode
+	value interface{}
+	// expires is zero for the values which never expire
+	expires time.Time
+}
+
 type fastMemoryCache struct {
 	baseCache
-	base     *goCache.Cache
-	cacheTTL time.Duration
+	base        *goCache.Cache
+	cacheTTL    time.Duration
+	zeroCopy    bool
+	stopJanitor chan struct{}
+	closeOnce   sync.Once
 }
 
 func NewFastMemoryCache(opts *CacheOpts) *fastMemoryCache {
 	// Notice: max memory dosent supported by go-cache
-	return &fastMemoryCache{
-		baseCache: baseCache{
-			layerName:          opts.layerName,
-			amnesiaChance:      opts.amnesiaChance,
-			compressionEnabled: opts.compressionEnabled,
-		},
-		base:     goCache.New(opts.cacheTTL, opts.cleanupInterval),
-		cacheTTL: opts.cacheTTL,
+	zeroCopy := opts.memOpts.valueMode == ValueModeZeroCopy
+	if !zeroCopy && opts.memOpts.valueMode != "" && opts.memOpts.valueMode != ValueModeCodec {
+		opts.log().Error(fmt.Sprintf("Malformed: Unknown value-mode %s, using %s", opts.memOpts.valueMode, ValueModeCodec), nil)
+	}
+	if zeroCopy && opts.keyring != nil {
+		opts.log().Warn(fmt.Sprintf("fastmemory layer keeps values as-is in %s mode, encryption is ignored", ValueModeZeroCopy), nil)
 	}
+	mc := &fastMemoryCache{
+		baseCache: newBaseCache(opts),
+		// go-cache's own janitor can't be stopped, so the layer runs its own
+		base:        goCache.New(opts.cacheTTL, 0),
+		cacheTTL:    opts.cacheTTL,
+		zeroCopy:    zeroCopy,
+		stopJanitor: make(chan struct{}),
+	}
+	if opts.cleanupInterval > 0 {
+		go mc.runJanitor(opts.cleanupInterval)
+	}
+	return mc
 }
 
-func (mc *fastMemoryCache) Get(ctx context.Context, key string, refrence interface{}) (*cachable, error) {
-	if mc.amnesiaChance > rand.Intn(100) {
-		return nil, newAmnesiaError(mc.amnesiaChance)
+func (mc *fastMemoryCache) runJanitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			mc.base.DeleteExpired()
+		case <-mc.stopJanitor:
+			return
+		}
 	}
-	val, found := mc.base.Get(key)
-	if val == nil || found == false {
+}
+
+func (mc *fastMemoryCache) Get(ctx context.Context, key string, refrence interface{}) (*Cachable, error) {
+	if chance, forgets := mc.forgets(); forgets {
+		return nil, newAmnesiaError(chance)
+	}
+	item, found := mc.item(key)
+	if !found {
 		return nil, &ErrCacheMiss{message: "Miss entry at fastmemory layer"}
 	}
-	res := val.(*cachable)
-	return &cachable{
+	if !mc.zeroCopy {
+		return mc.unpackPayload(ctx, key, item.value.([]byte), refrence)
+	}
+	res := item.value.(*Cachable)
+	if err := checkFingerprint(res.Fingerprint, refrence); err != nil {
+		return nil, err
+	}
+	return &Cachable{
 		Time:         res.Time,
 		CachedObject: res.CachedObject,
+		Fingerprint:  res.Fingerprint,
 	}, nil
 }
 
-func (mc *fastMemoryCache) Set(ctx context.Context, key string, value *cachable) error {
-	mc.base.Set(key, value, goCache.DefaultExpiration)
+func (mc *fastMemoryCache) Set(ctx context.Context, key string, value *Cachable) error {
+	if mc.zeroCopy {
+		if value == nil {
+			return errNilValue
+		}
+		mc.base.Set(key, mc.newItem(value), goCache.DefaultExpiration)
+		return nil
+	}
+	finalData, err := mc.packPayload(ctx, key, value)
+	if err != nil {
+		return err
+	}
+	mc.base.Set(key, mc.newItem(finalData), goCache.DefaultExpiration)
 	return nil
 }
 
+func (mc *fastMemoryCache) newItem(value interface{}) *fastMemoryItem {
+	item := &fastMemoryItem{value: value}
+	if mc.cacheTTL > 0 {
+		item.expires = mc.clock.Now().Add(mc.cacheTTL)
+	}
+	return item
+}
+
+// item returns the item stored for key, unless it's expired by the clock
+func (mc *fastMemoryCache) item(key string) (*fastMemoryItem, bool) {
+	val, found := mc.base.Get(key)
+	if !found {
+		return nil, false
+	}
+	item, ok := val.(*fastMemoryItem)
+	if !ok || item.value == nil || (!item.expires.IsZero() && !mc.clock.Now().Before(item.expires)) {
+		return nil, false
+	}
+	return item, true
+}
+
+// ttl is the remaining TTL of item, zero for the values which never expire
+func (mc *fastMemoryCache) ttl(item *fastMemoryItem) time.Duration {
+	if item.expires.IsZero() {
+		return 0
+	}
+	return item.expires.Sub(mc.clock.Now())
+}
+
 func (mc *fastMemoryCache) Delete(ctx context.Context, key string) error {
 	mc.base.Delete(key)
 	return nil
@@ -58,12 +150,61 @@ func (mc *fastMemoryCache) Clear() error {
 }
 
 func (mc *fastMemoryCache) TTL(ctx context.Context, key string) time.Duration {
-	if _, exp, found := mc.base.GetWithExpiration(key); found {
-		return time.Until(exp)
+	if item, found := mc.item(key); found {
+		return mc.ttl(item)
 	}
 	return time.Second * 0
 }
 
+func (mc *fastMemoryCache) layerStats() (int, int) {
+	// go-cache doesn't track its memory usage
+	return mc.base.ItemCount(), -1
+}
+
+func (mc *fastMemoryCache) explain(ctx context.Context, key string) LayerExplanation {
+	res := LayerExplanation{Shard: -1}
+	item, found := mc.item(key)
+	if !found {
+		return res
+	}
+	res.TTL = mc.ttl(item)
+	if !mc.zeroCopy {
+		mc.explainPayload(key, item.value.([]byte), &res)
+		return res
+	}
+	stored := item.value.(*Cachable)
+	res.Present, res.Time, res.Fingerprint = true, stored.Time, stored.Fingerprint
+	value, err := json.Marshal(stored.CachedObject)
+	if err != nil {
+		res.DecodeError = err.Error()
+		return res
+	}
+	res.Decoded, res.Value = true, value
+	return res
+}
+
+func (mc *fastMemoryCache) scan(ctx context.Context, pattern string, match func(string) bool, limit int) ([]string, error) {
+	var keys []string
+	now := mc.clock.Now()
+	for key, stored := range mc.base.Items() {
+		if scanLimitReached(keys, limit) {
+			break
+		}
+		if item, ok := stored.Object.(*fastMemoryItem); ok && !item.expires.IsZero() && !now.Before(item.expires) {
+			continue
+		}
+		if match(key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (mc *fastMemoryCache) close() error {
+	mc.closeOnce.Do(func() { close(mc.stopJanitor) })
+	return nil
+}
+
 func (mc *fastMemoryCache) Name() string {
 	return mc.layerName
 }
@@ -2,11 +2,10 @@ package mnemosyne
 
 import (
 	"context"
-	"math/rand"
+	"errors"
 	"time"
 
 	"github.com/allegro/bigcache"
-	"github.com/sirupsen/logrus"
 )
 
 type inMemoryCache struct {
@@ -25,45 +24,70 @@ func NewInMemoryCache(opts *CacheOpts) *inMemoryCache {
 		HardMaxCacheSize:   opts.memOpts.maxMem,
 		CleanWindow:        1 * time.Minute,
 	}
+	if opts.onEvict != nil {
+		internalOpts.OnRemoveWithReason = func(key string, entry []byte, reason bigcache.RemoveReason) {
+			if reason == bigcache.Expired {
+				opts.onEvict("expired")
+			} else if reason == bigcache.NoSpace {
+				opts.onEvict("no-space")
+			}
+		}
+	}
 	cacheInstance, err := bigcache.NewBigCache(internalOpts)
 	if err != nil {
-		logrus.Errorf("InMemCache %s Initialization Error: %v", opts.layerName, err)
+		opts.log().Error("InMemCache Initialization Error", err)
 	}
 	return &inMemoryCache{
-		baseCache: baseCache{
-			layerName:          opts.layerName,
-			amnesiaChance:      opts.amnesiaChance,
-			compressionEnabled: opts.compressionEnabled,
-		},
-		base:     cacheInstance,
-		cacheTTL: opts.cacheTTL,
+		baseCache: newBaseCache(opts),
+		base:      cacheInstance,
+		cacheTTL:  opts.cacheTTL,
 	}
 }
 
-func (mc *inMemoryCache) Get(ctx context.Context, key string, refrence interface{}) (*cachable, error) {
-	if mc.amnesiaChance > rand.Intn(100) {
-		return nil, newAmnesiaError(mc.amnesiaChance)
+func (mc *inMemoryCache) Get(ctx context.Context, key string, refrence interface{}) (*Cachable, error) {
+	if chance, forgets := mc.forgets(); forgets {
+		return nil, newAmnesiaError(chance)
+	}
+	if mc.base == nil {
+		return nil, newBackendError(errors.New("bigcache is not initialized"))
 	}
 	rawBytes, err := mc.base.Get(key)
-	if err != nil {
-		return nil, err
+	if err == bigcache.ErrEntryNotFound {
+		return nil, &ErrCacheMiss{message: "Miss entry at memory layer"}
+	} else if err != nil {
+		return nil, newBackendError(err)
 	}
-	return finalizeCacheResponse(rawBytes, mc.compressionEnabled, refrence)
+	return mc.unpackPayload(ctx, key, rawBytes, refrence)
 }
 
-func (mc *inMemoryCache) Set(ctx context.Context, key string, value *cachable) error {
-	finalData, err := prepareCachePayload(value, mc.compressionEnabled)
+func (mc *inMemoryCache) Set(ctx context.Context, key string, value *Cachable) error {
+	finalData, err := mc.packPayload(ctx, key, value)
 	if err != nil {
 		return err
 	}
-	return mc.base.Set(key, finalData)
+	if mc.base == nil {
+		return newBackendError(errors.New("bigcache is not initialized"))
+	}
+	if err := mc.base.Set(key, finalData); err != nil {
+		return newBackendError(err)
+	}
+	return nil
 }
 
 func (mc *inMemoryCache) Delete(ctx context.Context, key string) error {
-	return mc.base.Delete(key)
+	if mc.base == nil {
+		return newBackendError(errors.New("bigcache is not initialized"))
+	}
+	if err := mc.base.Delete(key); err != nil && err != bigcache.ErrEntryNotFound {
+		return newBackendError(err)
+	}
+	return nil
 }
 
 func (mc *inMemoryCache) Clear() error {
+	if mc.base == nil {
+		return newBackendError(errors.New("bigcache is not initialized"))
+	}
 	return mc.base.Reset()
 }
 
@@ -71,6 +95,56 @@ func (mc *inMemoryCache) TTL(ctx context.Context, key string) time.Duration {
 	return time.Second * 0
 }
 
+func (mc *inMemoryCache) layerStats() (int, int) {
+	if mc.base == nil {
+		return 0, 0
+	}
+	return mc.base.Len(), mc.base.Capacity()
+}
+
+func (mc *inMemoryCache) explain(ctx context.Context, key string) LayerExplanation {
+	res := LayerExplanation{Shard: -1}
+	if mc.base == nil {
+		res.Error = "bigcache is not initialized"
+		return res
+	}
+	rawBytes, err := mc.base.Get(key)
+	if err == bigcache.ErrEntryNotFound {
+		return res
+	} else if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	mc.explainPayload(key, rawBytes, &res)
+	return res
+}
+
+func (mc *inMemoryCache) scan(ctx context.Context, pattern string, match func(string) bool, limit int) ([]string, error) {
+	if mc.base == nil {
+		return nil, newBackendError(errors.New("bigcache is not initialized"))
+	}
+	var keys []string
+	iterator := mc.base.Iterator()
+	for !scanLimitReached(keys, limit) && iterator.SetNext() {
+		entry, err := iterator.Value()
+		if err != nil {
+			// the entry was removed while iterating
+			continue
+		}
+		if match(entry.Key()) {
+			keys = append(keys, entry.Key())
+		}
+	}
+	return keys, ctx.Err()
+}
+
+func (mc *inMemoryCache) close() error {
+	if mc.base == nil {
+		return nil
+	}
+	return mc.base.Close()
+}
+
 func (mc *inMemoryCache) Name() string {
 	return mc.layerName
 }
@@ -2,12 +2,11 @@ package mnemosyne
 
 import (
 	"context"
+	"fmt"
 	"hash/fnv"
-	"math/rand"
 	"time"
 
 	"github.com/go-redis/redis"
-	"github.com/sirupsen/logrus"
 )
 
 type RedisClusterAddress struct {
@@ -33,7 +32,7 @@ type redisCache struct {
 	watcher     ITimer
 }
 
-func makeClient(addr string, db int, idleTimeout time.Duration) *redis.Client {
+func makeClient(addr string, db int, idleTimeout time.Duration, logger *layerLogger) *redis.Client {
 	redisOptions := &redis.Options{
 		Addr: addr,
 		DB:   db,
@@ -44,42 +43,40 @@ func makeClient(addr string, db int, idleTimeout time.Duration) *redis.Client {
 	newClient := redis.NewClient(redisOptions)
 
 	if err := newClient.Ping().Err(); err != nil {
-		logrus.WithError(err).WithField("address", addr).Error("error pinging Redis")
+		logger.Error("error pinging Redis at "+addr, err)
 	}
 	return newClient
 }
 
 func NewShardedClusterRedisCache(opts *CacheOpts, watcher ITimer) *redisCache {
 	rc := &redisCache{
-		baseCache: baseCache{
-			layerName:          opts.layerName,
-			amnesiaChance:      opts.amnesiaChance,
-			compressionEnabled: opts.compressionEnabled,
-		},
-		cacheTTL: opts.cacheTTL,
-		watcher:  watcher,
+		baseCache: newBaseCache(opts),
+		cacheTTL:  opts.cacheTTL,
+		watcher:   watcher,
 	}
 	rc.baseClients = make([]*clusterClient, len(opts.redisOpts.shards))
 	for i, shard := range opts.redisOpts.shards {
 		rc.baseClients[i] = &clusterClient{
 			master: makeClient(shard.MasterAddr,
 				opts.redisOpts.db,
-				opts.redisOpts.idleTimeout),
+				opts.redisOpts.idleTimeout,
+				opts.log()),
 			slaves: make([]*redis.Client, len(shard.SlaveAddrs)),
 		}
 
 		for j, slv := range shard.SlaveAddrs {
 			rc.baseClients[i].slaves[j] = makeClient(slv,
 				opts.redisOpts.db,
-				opts.redisOpts.idleTimeout)
+				opts.redisOpts.idleTimeout,
+				opts.log())
 		}
 	}
 	return rc
 }
 
-func (rc *redisCache) Get(ctx context.Context, key string, refrence interface{}) (*cachable, error) {
-	if rc.amnesiaChance > rand.Intn(100) {
-		return nil, newAmnesiaError(rc.amnesiaChance)
+func (rc *redisCache) Get(ctx context.Context, key string, refrence interface{}) (*Cachable, error) {
+	if chance, forgets := rc.forgets(); forgets {
+		return nil, newAmnesiaError(chance)
 	}
 	client := rc.pickClient(key, false).WithContext(ctx)
 	startMarker := rc.watcher.Start()
@@ -88,15 +85,59 @@ func (rc *redisCache) Get(ctx context.Context, key string, refrence interface{})
 		rc.watcher.Done(startMarker, rc.layerName, "get", "ok")
 	} else if err == redis.Nil {
 		rc.watcher.Done(startMarker, rc.layerName, "get", "miss")
+		return nil, &ErrCacheMiss{message: "Miss entry at redis layer"}
 	} else {
 		rc.watcher.Done(startMarker, rc.layerName, "get", "error")
+		return nil, newBackendError(err)
 	}
 	rawBytes := []byte(strValue)
-	return finalizeCacheResponse(rawBytes, rc.compressionEnabled, refrence)
+	return rc.unpackPayload(ctx, key, rawBytes, refrence)
 }
 
-func (rc *redisCache) Set(ctx context.Context, key string, value *cachable) error {
-	finalData, err := prepareCachePayload(value, rc.compressionEnabled)
+// getMany reads the keys of each shard with a single MGET
+func (rc *redisCache) getMany(ctx context.Context, keys []string, refrences []interface{}) ([]*Cachable, []error) {
+	results := make([]*Cachable, len(keys))
+	errs := make([]error, len(keys))
+	shards := make(map[int][]int)
+	for i, key := range keys {
+		if chance, forgets := rc.forgets(); forgets {
+			errs[i] = newAmnesiaError(chance)
+			continue
+		}
+		shard := rc.shardKey(key)
+		shards[shard] = append(shards[shard], i)
+	}
+	for _, indexes := range shards {
+		shardKeys := make([]string, len(indexes))
+		for j, i := range indexes {
+			shardKeys[j] = keys[i]
+		}
+		// the keys of a shard are all read from the same replica
+		_, _, client := rc.pickReplica(shardKeys[0], false)
+		startMarker := rc.watcher.Start()
+		values, err := client.WithContext(ctx).MGet(shardKeys...).Result()
+		if err != nil {
+			rc.watcher.Done(startMarker, rc.layerName, "mget", "error")
+			for _, i := range indexes {
+				errs[i] = newBackendError(err)
+			}
+			continue
+		}
+		rc.watcher.Done(startMarker, rc.layerName, "mget", "ok")
+		for j, i := range indexes {
+			strValue, ok := values[j].(string)
+			if !ok {
+				errs[i] = &ErrCacheMiss{message: "Miss entry at redis layer"}
+				continue
+			}
+			results[i], errs[i] = rc.unpackPayload(ctx, keys[i], []byte(strValue), refrences[i])
+		}
+	}
+	return results, errs
+}
+
+func (rc *redisCache) Set(ctx context.Context, key string, value *Cachable) error {
+	finalData, err := rc.packPayload(ctx, key, value)
 	if err != nil {
 		return err
 	}
@@ -105,14 +146,17 @@ func (rc *redisCache) Set(ctx context.Context, key string, value *cachable) erro
 	setError := client.Set(key, finalData, rc.cacheTTL).Err()
 	if setError != nil {
 		rc.watcher.Done(startMarker, rc.layerName, "set", "error")
-	} else {
-		rc.watcher.Done(startMarker, rc.layerName, "set", "ok")
+		return newBackendError(setError)
 	}
-	return setError
+	rc.watcher.Done(startMarker, rc.layerName, "set", "ok")
+	return nil
 }
 func (rc *redisCache) Delete(ctx context.Context, key string) error {
 	client := rc.pickClient(key, true).WithContext(ctx)
-	return client.Del(key).Err()
+	if err := client.Del(key).Err(); err != nil {
+		return newBackendError(err)
+	}
+	return nil
 }
 
 func (rc *redisCache) Clear() error {
@@ -120,7 +164,7 @@ func (rc *redisCache) Clear() error {
 		client := cl.master
 		err := client.FlushDB().Err()
 		if err != nil {
-			return err
+			return newBackendError(err)
 		}
 	}
 	return nil
@@ -129,19 +173,26 @@ func (rc *redisCache) Clear() error {
 func (rc *redisCache) TTL(ctx context.Context, key string) time.Duration {
 	client := rc.pickClient(key, false).WithContext(ctx)
 	res, err := client.TTL(key).Result()
-	if err != nil {
+	// redis returns negative TTLs for missing keys and keys which never expire
+	if err != nil || res < 0 {
 		return time.Second * 0
 	}
 	return res
 }
 
 func (rc *redisCache) pickClient(key string, modification bool) *redis.Client {
+	_, _, client := rc.pickReplica(key, modification)
+	return client
+}
+
+// pickReplica returns the client for key along with its shard and replica (-1 for the master)
+func (rc *redisCache) pickReplica(key string, modification bool) (int, int, *redis.Client) {
 	shard := rc.shardKey(key)
 	if modification || len(rc.baseClients[shard].slaves) == 0 {
-		return rc.baseClients[shard].master
+		return shard, -1, rc.baseClients[shard].master
 	}
-	cl := rand.Intn(len(rc.baseClients[shard].slaves))
-	return rc.baseClients[shard].slaves[cl]
+	cl := rc.random.Intn(len(rc.baseClients[shard].slaves))
+	return shard, cl, rc.baseClients[shard].slaves[cl]
 }
 
 func (rc *redisCache) shardKey(key string) int {
@@ -155,6 +206,66 @@ func (rc *redisCache) shardKey(key string) int {
 	return keyHash % shards
 }
 
+func (rc *redisCache) explain(ctx context.Context, key string) LayerExplanation {
+	shard, replica, client := rc.pickReplica(key, false)
+	res := LayerExplanation{Shard: shard, Replica: "master", Address: client.Options().Addr}
+	if replica >= 0 {
+		res.Replica = fmt.Sprintf("slave-%d", replica)
+	}
+	client = client.WithContext(ctx)
+	strValue, err := client.Get(key).Result()
+	if err == redis.Nil {
+		return res
+	} else if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	rc.explainPayload(key, []byte(strValue), &res)
+	if ttl, err := client.TTL(key).Result(); err == nil && ttl > 0 {
+		res.TTL = ttl
+	}
+	return res
+}
+
+func (rc *redisCache) scan(ctx context.Context, pattern string, match func(string) bool, limit int) ([]string, error) {
+	var keys []string
+	for _, cl := range rc.baseClients {
+		client := cl.master.WithContext(ctx)
+		var cursor uint64
+		for {
+			batch, next, err := client.Scan(cursor, pattern, 100).Result()
+			if err != nil {
+				return keys, newBackendError(err)
+			}
+			for _, key := range batch {
+				if scanLimitReached(keys, limit) {
+					return keys, nil
+				}
+				if match(key) {
+					keys = append(keys, key)
+				}
+			}
+			if next == 0 {
+				break
+			}
+			cursor = next
+		}
+	}
+	return keys, nil
+}
+
+func (rc *redisCache) close() error {
+	var errs []error
+	for _, cl := range rc.baseClients {
+		for _, client := range append([]*redis.Client{cl.master}, cl.slaves...) {
+			if err := client.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return closeError(errs)
+}
+
 func (rc *redisCache) Name() string {
 	return rc.layerName
 }
@@ -3,7 +3,6 @@ package mnemosyne
 import (
 	"context"
 	"errors"
-	"math/rand"
 	"sync"
 	"time"
 )
@@ -16,34 +15,28 @@ type tinyCache struct {
 func NewTinyCache(opts *CacheOpts) *tinyCache {
 	data := sync.Map{}
 	return &tinyCache{
-		baseCache: baseCache{
-			layerName:          opts.layerName,
-			amnesiaChance:      opts.amnesiaChance,
-			compressionEnabled: opts.compressionEnabled,
-		},
-		base: &data,
+		baseCache: newBaseCache(opts),
+		base:      &data,
 	}
 }
 
-func (tc *tinyCache) Get(ctx context.Context, key string, refrence interface{}) (*cachable, error) {
-	if tc.amnesiaChance > rand.Intn(100) {
-		return nil, newAmnesiaError(tc.amnesiaChance)
+func (tc *tinyCache) Get(ctx context.Context, key string, refrence interface{}) (*Cachable, error) {
+	if chance, forgets := tc.forgets(); forgets {
+		return nil, newAmnesiaError(chance)
 	}
-	var rawBytes []byte
 	val, ok := tc.base.Load(key)
 	if !ok {
-		return nil, errors.New("Failed to load from syncmap")
-	} else {
-		rawBytes, ok = val.([]byte)
-		if !ok {
-			return nil, errors.New("Failed to load from syncmap")
-		}
+		return nil, &ErrCacheMiss{message: "Miss entry at tiny layer"}
+	}
+	rawBytes, ok := val.([]byte)
+	if !ok {
+		return nil, newDecodeError(errors.New("Failed to load from syncmap"))
 	}
-	return finalizeCacheResponse(rawBytes, tc.compressionEnabled, refrence)
+	return tc.unpackPayload(ctx, key, rawBytes, refrence)
 }
 
-func (tc *tinyCache) Set(ctx context.Context, key string, value *cachable) error {
-	finalData, err := prepareCachePayload(value, tc.compressionEnabled)
+func (tc *tinyCache) Set(ctx context.Context, key string, value *Cachable) error {
+	finalData, err := tc.packPayload(ctx, key, value)
 	if err != nil {
 		return err
 	}
@@ -57,7 +50,11 @@ func (tc *tinyCache) Delete(ctx context.Context, key string) error {
 }
 
 func (tc *tinyCache) Clear() error {
-	tc.base = &sync.Map{}
+	// the map is emptied in place, as replacing it would race with the readers
+	tc.base.Range(func(key, value interface{}) bool {
+		tc.base.Delete(key)
+		return true
+	})
 	return nil
 }
 
@@ -65,6 +62,38 @@ func (tc *tinyCache) TTL(ctx context.Context, key string) time.Duration {
 	return time.Second * 0
 }
 
+func (tc *tinyCache) layerStats() (int, int) {
+	entries, size := 0, 0
+	tc.base.Range(func(key, value interface{}) bool {
+		entries++
+		if rawBytes, ok := value.([]byte); ok {
+			size += len(rawBytes)
+		}
+		return true
+	})
+	return entries, size
+}
+
+func (tc *tinyCache) explain(ctx context.Context, key string) LayerExplanation {
+	res := LayerExplanation{Shard: -1}
+	if val, ok := tc.base.Load(key); ok {
+		rawBytes, _ := val.([]byte)
+		tc.explainPayload(key, rawBytes, &res)
+	}
+	return res
+}
+
+func (tc *tinyCache) scan(ctx context.Context, pattern string, match func(string) bool, limit int) ([]string, error) {
+	var keys []string
+	tc.base.Range(func(key, value interface{}) bool {
+		if strKey, ok := key.(string); ok && match(strKey) {
+			keys = append(keys, strKey)
+		}
+		return !scanLimitReached(keys, limit)
+	})
+	return keys, nil
+}
+
 func (tc *tinyCache) Name() string {
 	return tc.layerName
 }
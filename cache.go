@@ -2,14 +2,18 @@ package mnemosyne
 
 import (
 	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
-
-	"github.com/sirupsen/logrus"
 )
 
+// ICache is a layer of a cache instance. Get decodes the value into refrence (a nil refrence only reads
+// the metadata) and returns an *ErrCacheMiss for missing keys, and TTL is zero for missing keys and for layers
+// which can't tell. Layers must be safe for concurrent use, the cachetest package checks the whole contract
 type ICache interface {
-	Get(context.Context, string, interface{}) (*cachable, error)
-	Set(context.Context, string, *cachable) error
+	Get(context.Context, string, interface{}) (*Cachable, error)
+	Set(context.Context, string, *Cachable) error
 	Delete(context.Context, string) error
 	Clear() error
 	TTL(context.Context, string) time.Duration
@@ -17,7 +21,8 @@ type ICache interface {
 }
 
 type MemoryOpts struct {
-	maxMem int
+	maxMem    int
+	valueMode string
 }
 
 type CacheOpts struct {
@@ -27,16 +32,102 @@ type CacheOpts struct {
 	memOpts            MemoryOpts
 	amnesiaChance      int
 	compressionEnabled bool
+	keyring            *keyring
 	cacheTTL           time.Duration
 	cleanupInterval    time.Duration
+	onEvict            func(reason string)
+	logger             Logger
+	instanceName       string
+	random             RandomSource
+	clock              Clock
+}
+
+// log returns the logger of the layer, with the layer's name attached to the fields
+func (opts *CacheOpts) log() *layerLogger {
+	logger := opts.logger
+	if logger == nil {
+		logger = defaultLogger
+	}
+	return &layerLogger{base: logger, layerName: opts.layerName, instanceName: opts.instanceName}
+}
+
+type layerLogger struct {
+	base         Logger
+	layerName    string
+	instanceName string
+}
+
+func (l *layerLogger) fields(err error) Fields {
+	fields := Fields{FieldLayer: l.layerName}
+	if l.instanceName != "" {
+		fields[FieldInstance] = l.instanceName
+	}
+	if err != nil {
+		fields[FieldError] = err
+	}
+	return fields
+}
+
+func (l *layerLogger) Warn(msg string, err error) {
+	l.base.Warn(msg, l.fields(err))
+}
+
+func (l *layerLogger) Error(msg string, err error) {
+	l.base.Error(msg, l.fields(err))
 }
 
 type baseCache struct {
-	layerName          string
-	amnesiaChance      int
+	layerName string
+	// amnesiaChance is accessed atomically, as it may be changed at runtime
+	amnesiaChance      int32
 	compressionEnabled bool
+	keyring            *keyring
+	random             RandomSource
+	clock              Clock
 }
 
+func newBaseCache(opts *CacheOpts) baseCache {
+	random := opts.random
+	if random == nil {
+		random = globalRandom{}
+	}
+	clock := opts.clock
+	if clock == nil {
+		clock = systemClock{}
+	}
+	return baseCache{
+		layerName:          opts.layerName,
+		amnesiaChance:      int32(opts.amnesiaChance),
+		compressionEnabled: opts.compressionEnabled,
+		keyring:            opts.keyring,
+		random:             random,
+		clock:              clock,
+	}
+}
+
+// amnesiac is implemented by the layers whose amnesia chance can be changed at runtime
+type amnesiac interface {
+	amnesia() int
+	setAmnesia(chance int)
+}
+
+func (bc *baseCache) amnesia() int {
+	return int(atomic.LoadInt32(&bc.amnesiaChance))
+}
+
+func (bc *baseCache) setAmnesia(chance int) {
+	atomic.StoreInt32(&bc.amnesiaChance, int32(chance))
+}
+
+// forgets rolls the dice of amnesia, and returns the chance it was rolled against if the layer should miss
+func (bc *baseCache) forgets() (int, bool) {
+	chance := bc.amnesia()
+	return chance, chance > bc.random.Intn(100)
+}
+
+// gaurdianDeprecation makes the deprecation of gaurdian layers logged once per process
+var gaurdianDeprecation sync.Once
+
 func NewCacheLayer(opts *CacheOpts, watcher ITimer) ICache {
 	layerType := opts.layerType
 	if layerType == "memory" {
@@ -45,12 +136,17 @@ func NewCacheLayer(opts *CacheOpts, watcher ITimer) ICache {
 		return NewTinyCache(opts)
 	} else if layerType == "redis" {
 		return NewShardedClusterRedisCache(opts, watcher)
+	} else if layerType == "rediscluster" {
+		return NewShardedClusterRedisCache(opts, watcher)
 	} else if layerType == "gaurdian" {
 		// to preserve backward-compatibility
+		gaurdianDeprecation.Do(func() {
+			opts.log().Warn("gaurdian layers are deprecated in favor of rediscluster, run `mnemosyne migrate` to convert the config", nil)
+		})
 		return NewShardedClusterRedisCache(opts, watcher)
 	} else if layerType == "fastmemory" {
 		return NewFastMemoryCache(opts)
 	}
-	logrus.Errorf("Malformed: Unknown cache type %s", layerType)
+	opts.log().Error(fmt.Sprintf("Malformed: Unknown cache type %s", layerType), nil)
 	return nil
 }
@@ -0,0 +1,304 @@
+// Package cachetest checks that an implementation of mnemosyne.ICache behaves the way Mnemosyne expects a layer to.
+//
+//	func TestMyLayer(t *testing.T) {
+//		cachetest.Run(t, func(t *testing.T, compression bool) mnemosyne.ICache {
+//			return newEmptyLayer(compression)
+//		}, cachetest.Options{TTL: time.Hour, ReportsTTL: true})
+//	}
+//
+// Run the tests with -race, as the suite also checks the layer is safe for concurrent use.
+package cachetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mghayour/mnemosyne"
+	"github.com/stretchr/testify/assert"
+)
+
+// DefaultMaxValueSize is the size of the large values stored by the suite, unless set in Options
+const DefaultMaxValueSize = 1 << 20
+
+// Factory creates an empty layer, with compression enabled or not, for a single test of the suite.
+// The layer must not use amnesia, as the suite expects it to return whatever it holds
+type Factory func(t *testing.T, compression bool) mnemosyne.ICache
+
+// Options describes what the suite should expect from the layer
+type Options struct {
+	// TTL is the ttl the factory creates the layers with
+	TTL time.Duration
+	// ReportsTTL shows whether the layer reports the remaining TTL of its keys, rather than always zero
+	ReportsTTL bool
+	// MaxValueSize is the size (in bytes) of the largest value the layer is expected to hold
+	MaxValueSize int
+	// Concurrency is the number of goroutines accessing the layer at once in the concurrency test (default: 16)
+	Concurrency int
+}
+
+type suite struct {
+	factory     Factory
+	options     Options
+	compression bool
+}
+
+// Value is the type of the values stored by the suite
+type Value struct {
+	Name   string
+	Tags   []string
+	Counts map[string]int
+	Nested *Value `json:",omitempty"`
+}
+
+// Run runs the whole suite against the layers created by factory, once without and once with compression
+func Run(t *testing.T, factory Factory, options Options) {
+	if options.MaxValueSize <= 0 {
+		options.MaxValueSize = DefaultMaxValueSize
+	}
+	if options.Concurrency <= 0 {
+		options.Concurrency = 16
+	}
+	for _, compression := range []bool{false, true} {
+		s := &suite{factory: factory, options: options, compression: compression}
+		t.Run(fmt.Sprintf("compression=%v", compression), func(t *testing.T) {
+			t.Run("RoundTrip", s.testRoundTrip)
+			t.Run("Overwrite", s.testOverwrite)
+			t.Run("Metadata", s.testMetadata)
+			t.Run("Miss", s.testMiss)
+			t.Run("Delete", s.testDelete)
+			t.Run("NilValue", s.testNilValue)
+			t.Run("Keys", s.testKeys)
+			t.Run("TTL", s.testTTL)
+			t.Run("Clear", s.testClear)
+			t.Run("LargeValue", s.testLargeValue)
+			t.Run("Concurrency", s.testConcurrency)
+		})
+	}
+}
+
+func (s *suite) layer(t *testing.T) mnemosyne.ICache {
+	layer := s.factory(t, s.compression)
+	if layer == nil {
+		t.Fatal("the factory returned a nil layer")
+	}
+	return layer
+}
+
+func sampleValue(name string) *Value {
+	return &Value{
+		Name:   name,
+		Tags:   []string{"a", "b", "ünïcode"},
+		Counts: map[string]int{"x": 1, "y": -2},
+		Nested: &Value{Name: name + "-nested", Tags: []string{}},
+	}
+}
+
+// set stores value in layer and returns what was stored
+func set(t *testing.T, layer mnemosyne.ICache, key string, value interface{}) *mnemosyne.Cachable {
+	stored := &mnemosyne.Cachable{Time: time.Now(), CachedObject: value}
+	if err := layer.Set(context.Background(), key, stored); err != nil {
+		t.Fatalf("Set(%q) failed: %v", key, err)
+	}
+	return stored
+}
+
+// assertMiss checks that key is missing from layer the way Mnemosyne expects
+func assertMiss(t *testing.T, layer mnemosyne.ICache, key string) {
+	t.Helper()
+	result, err := layer.Get(context.Background(), key, &Value{})
+	assert.Nil(t, result, "a miss returns no value")
+	assert.True(t, errors.Is(err, mnemosyne.ErrMiss), "a miss of %q returns an error matching ErrMiss, got %v", key, err)
+	var miss *mnemosyne.ErrCacheMiss
+	assert.True(t, errors.As(err, &miss), "a miss returns an *ErrCacheMiss")
+}
+
+func (s *suite) testRoundTrip(t *testing.T) {
+	layer := s.layer(t)
+	stored := set(t, layer, "round-trip", sampleValue("round-trip"))
+	refrence := &Value{}
+	result, err := layer.Get(context.Background(), "round-trip", refrence)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, sampleValue("round-trip"), refrence, "the value is decoded into the refrence")
+	assert.True(t, result.CachedObject == refrence, "the result holds the refrence")
+	assert.True(t, stored.Time.Equal(result.Time), "the time is kept, got %v instead of %v", result.Time, stored.Time)
+
+	// decoding into a fresh refrence doesn't share anything with the previous one
+	another := &Value{}
+	_, err = layer.Get(context.Background(), "round-trip", another)
+	assert.Nil(t, err)
+	another.Tags[0] = "changed"
+	assert.Equal(t, "a", refrence.Tags[0])
+}
+
+func (s *suite) testOverwrite(t *testing.T) {
+	layer := s.layer(t)
+	set(t, layer, "overwrite", sampleValue("old"))
+	stored := set(t, layer, "overwrite", sampleValue("new"))
+	refrence := &Value{}
+	result, err := layer.Get(context.Background(), "overwrite", refrence)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, "new", refrence.Name)
+	assert.True(t, stored.Time.Equal(result.Time))
+}
+
+func (s *suite) testMetadata(t *testing.T) {
+	layer := s.layer(t)
+	stored := &mnemosyne.Cachable{Time: time.Now(), CachedObject: sampleValue("metadata"), Fingerprint: "cachetest"}
+	assert.Nil(t, layer.Set(context.Background(), "metadata", stored))
+	result, err := layer.Get(context.Background(), "metadata", nil)
+	if !assert.Nil(t, err, "a nil refrence only reads the metadata") {
+		return
+	}
+	assert.Nil(t, result.CachedObject)
+	assert.True(t, stored.Time.Equal(result.Time))
+	assert.Equal(t, "cachetest", result.Fingerprint)
+}
+
+func (s *suite) testMiss(t *testing.T) {
+	layer := s.layer(t)
+	assertMiss(t, layer, "missing")
+	_, err := layer.Get(context.Background(), "missing", nil)
+	assert.True(t, errors.Is(err, mnemosyne.ErrMiss), "a miss without a refrence matches ErrMiss too")
+}
+
+func (s *suite) testDelete(t *testing.T) {
+	layer := s.layer(t)
+	set(t, layer, "deleted", sampleValue("deleted"))
+	set(t, layer, "kept", sampleValue("kept"))
+	assert.Nil(t, layer.Delete(context.Background(), "deleted"))
+	assertMiss(t, layer, "deleted")
+	_, err := layer.Get(context.Background(), "kept", &Value{})
+	assert.Nil(t, err, "deleting a key leaves the others")
+	assert.Nil(t, layer.Delete(context.Background(), "deleted"), "deleting a missing key isn't an error")
+}
+
+func (s *suite) testNilValue(t *testing.T) {
+	layer := s.layer(t)
+	assert.NotNil(t, layer.Set(context.Background(), "nil", nil), "setting a nil *Cachable is an error")
+	assertMiss(t, layer, "nil")
+
+	stored := set(t, layer, "nil-object", nil)
+	refrence := &Value{Name: "untouched"}
+	result, err := layer.Get(context.Background(), "nil-object", refrence)
+	if !assert.Nil(t, err, "a nil CachedObject is a value like any other") {
+		return
+	}
+	assert.True(t, stored.Time.Equal(result.Time))
+	assert.Equal(t, "untouched", refrence.Name, "a nil CachedObject leaves the refrence untouched")
+}
+
+func (s *suite) testKeys(t *testing.T) {
+	layer := s.layer(t)
+	keys := []string{"key", "Key", "key ", "key:1", "key*", "ключ", strings.Repeat("k", 512)}
+	for _, key := range keys {
+		set(t, layer, key, sampleValue(key))
+	}
+	for _, key := range keys {
+		refrence := &Value{}
+		_, err := layer.Get(context.Background(), key, refrence)
+		assert.Nil(t, err, "Get(%q)", key)
+		assert.Equal(t, key, refrence.Name, "keys are distinct and taken literally")
+	}
+}
+
+func (s *suite) testTTL(t *testing.T) {
+	layer := s.layer(t)
+	assert.Equal(t, time.Duration(0), layer.TTL(context.Background(), "missing"), "a missing key has no TTL")
+	set(t, layer, "ttl", sampleValue("ttl"))
+	ttl := layer.TTL(context.Background(), "ttl")
+	if !s.options.ReportsTTL {
+		assert.Equal(t, time.Duration(0), ttl, "a layer which can't tell the TTL reports zero")
+		return
+	}
+	assert.True(t, ttl > 0 && ttl <= s.options.TTL, "the TTL %v is within (0, %v]", ttl, s.options.TTL)
+}
+
+func (s *suite) testClear(t *testing.T) {
+	layer := s.layer(t)
+	for i := 0; i < 10; i++ {
+		set(t, layer, fmt.Sprintf("clear-%d", i), sampleValue("clear"))
+	}
+	assert.Nil(t, layer.Clear())
+	for i := 0; i < 10; i++ {
+		assertMiss(t, layer, fmt.Sprintf("clear-%d", i))
+	}
+	assert.Nil(t, layer.Clear(), "clearing an empty layer isn't an error")
+
+	set(t, layer, "after-clear", sampleValue("after-clear"))
+	_, err := layer.Get(context.Background(), "after-clear", &Value{})
+	assert.Nil(t, err, "the layer is usable after Clear")
+}
+
+func (s *suite) testLargeValue(t *testing.T) {
+	layer := s.layer(t)
+	// random letters, so compression doesn't shrink the value much
+	random := rand.New(rand.NewSource(1))
+	letters := make([]byte, s.options.MaxValueSize)
+	for i := range letters {
+		letters[i] = byte('a' + random.Intn(26))
+	}
+	value := &Value{Name: string(letters)}
+	set(t, layer, "large", value)
+	refrence := &Value{}
+	_, err := layer.Get(context.Background(), "large", refrence)
+	if assert.Nil(t, err, "a value of %d bytes fits", s.options.MaxValueSize) {
+		assert.True(t, value.Name == refrence.Name, "the large value is kept intact")
+	}
+}
+
+func (s *suite) testConcurrency(t *testing.T) {
+	layer := s.layer(t)
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	errs := make(chan error, s.options.Concurrency)
+	for g := 0; g < s.options.Concurrency; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				key := fmt.Sprintf("concurrent-%d", (g+i)%8)
+				var err error
+				switch i % 10 {
+				case 0:
+					err = layer.Delete(ctx, key)
+				case 1:
+					layer.TTL(ctx, key)
+				case 2:
+					// once is enough to race with the others, and clearing may be costly (e.g. reallocating memory)
+					if g == 0 && i == 52 {
+						err = layer.Clear()
+					}
+				case 3, 4, 5:
+					err = layer.Set(ctx, key, &mnemosyne.Cachable{Time: time.Now(), CachedObject: sampleValue(key)})
+				default:
+					refrence := &Value{}
+					_, err = layer.Get(ctx, key, refrence)
+					if errors.Is(err, mnemosyne.ErrMiss) {
+						err = nil
+					} else if err == nil && refrence.Name != key {
+						err = fmt.Errorf("Get(%q) returned the value of %q", key, refrence.Name)
+					}
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,282 @@
+package mnemosyne
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// defaultChaosTimeoutAfter is how long a timed out operation hangs when the context has no deadline,
+// the same as the default read timeout of the Redis client
+const defaultChaosTimeoutAfter = 3 * time.Second
+
+var (
+	errChaosUnavailable = errors.New("chaos: injected failure")
+	errChaosTimeout     = errors.New("chaos: injected timeout")
+	errChaosCorrupted   = errors.New("chaos: corrupted payload")
+)
+
+// ChaosConfig is the fault injection of a layer, all chances are in percent.
+// In JSON the durations are strings like "50ms"
+type ChaosConfig struct {
+	// ErrorChance is the chance of a Get, Set or Delete failing with ErrLayerUnavailable
+	ErrorChance int
+	// Latency is added to the operations picked by LatencyChance
+	Latency       time.Duration
+	LatencyChance int
+	// TimeoutChance is the chance of an operation hanging until its context is done (or TimeoutAfter passes)
+	// and failing with ErrTimeout
+	TimeoutChance int
+	TimeoutAfter  time.Duration
+	// CorruptChance is the chance of a hit failing to decode with ErrDecode
+	CorruptChance int
+	// DropWriteChance is the chance of a Set being silently dropped
+	DropWriteChance int
+}
+
+type chaosConfigJSON struct {
+	ErrorChance     int    `json:"error"`
+	Latency         string `json:"latency,omitempty"`
+	LatencyChance   int    `json:"latency_chance"`
+	TimeoutChance   int    `json:"timeout"`
+	TimeoutAfter    string `json:"timeout_after,omitempty"`
+	CorruptChance   int    `json:"corrupt"`
+	DropWriteChance int    `json:"drop_writes"`
+}
+
+func (c ChaosConfig) MarshalJSON() ([]byte, error) {
+	res := chaosConfigJSON{
+		ErrorChance:     c.ErrorChance,
+		LatencyChance:   c.LatencyChance,
+		TimeoutChance:   c.TimeoutChance,
+		CorruptChance:   c.CorruptChance,
+		DropWriteChance: c.DropWriteChance,
+	}
+	if c.Latency != 0 {
+		res.Latency = c.Latency.String()
+	}
+	if c.TimeoutAfter != 0 {
+		res.TimeoutAfter = c.TimeoutAfter.String()
+	}
+	return json.Marshal(res)
+}
+
+func (c *ChaosConfig) UnmarshalJSON(data []byte) error {
+	var res chaosConfigJSON
+	if err := json.Unmarshal(data, &res); err != nil {
+		return err
+	}
+	*c = ChaosConfig{
+		ErrorChance:     res.ErrorChance,
+		LatencyChance:   res.LatencyChance,
+		TimeoutChance:   res.TimeoutChance,
+		CorruptChance:   res.CorruptChance,
+		DropWriteChance: res.DropWriteChance,
+	}
+	var err error
+	if res.Latency != "" {
+		if c.Latency, err = time.ParseDuration(res.Latency); err != nil {
+			return err
+		}
+	}
+	if res.TimeoutAfter != "" {
+		if c.TimeoutAfter, err = time.ParseDuration(res.TimeoutAfter); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c ChaosConfig) validate() error {
+	chances := map[string]int{
+		"error": c.ErrorChance, "latency-chance": c.LatencyChance, "timeout": c.TimeoutChance,
+		"corrupt": c.CorruptChance, "drop-writes": c.DropWriteChance,
+	}
+	for name, chance := range chances {
+		if chance < 0 || chance > 100 {
+			return fmt.Errorf("chaos %s chance %d is not in the range of 0-100", name, chance)
+		}
+	}
+	if c.Latency < 0 || c.TimeoutAfter < 0 {
+		return errors.New("chaos latency and timeout-after can't be negative")
+	}
+	return nil
+}
+
+// readChaosConfig reads the chaos block of a layer, e.g.
+//
+//	chaos:
+//	  error: 5
+//	  latency: 50ms
+//	  latency-chance: 20
+//	  timeout: 1
+//	  timeout-after: 1s
+//	  corrupt: 1
+//	  drop-writes: 2
+func readChaosConfig(config *viper.Viper, keyPrefix string) ChaosConfig {
+	return ChaosConfig{
+		ErrorChance:     config.GetInt(keyPrefix + ".error"),
+		Latency:         config.GetDuration(keyPrefix + ".latency"),
+		LatencyChance:   config.GetInt(keyPrefix + ".latency-chance"),
+		TimeoutChance:   config.GetInt(keyPrefix + ".timeout"),
+		TimeoutAfter:    config.GetDuration(keyPrefix + ".timeout-after"),
+		CorruptChance:   config.GetInt(keyPrefix + ".corrupt"),
+		DropWriteChance: config.GetInt(keyPrefix + ".drop-writes"),
+	}
+}
+
+// layerWrapper is implemented by the layers which decorate another one
+type layerWrapper interface {
+	unwrap() ICache
+}
+
+// unwrapLayer returns the layer behind all the decorators of layer,
+// which is the one implementing the optional interfaces (layerStatter, amnesiac, ...)
+func unwrapLayer(layer ICache) ICache {
+	for {
+		wrapper, ok := layer.(layerWrapper)
+		if !ok {
+			return layer
+		}
+		layer = wrapper.unwrap()
+	}
+}
+
+// chaosLayer injects failures into the operations of the layer it wraps,
+// it's meant for checking services degrade gracefully in staging
+type chaosLayer struct {
+	ICache
+	config atomic.Value // ChaosConfig
+	random RandomSource
+}
+
+func newChaosLayer(layer ICache, config ChaosConfig, random RandomSource) *chaosLayer {
+	if random == nil {
+		random = globalRandom{}
+	}
+	cl := &chaosLayer{ICache: layer, random: random}
+	cl.config.Store(config)
+	return cl
+}
+
+func (cl *chaosLayer) unwrap() ICache {
+	return cl.ICache
+}
+
+func (cl *chaosLayer) chaos() ChaosConfig {
+	return cl.config.Load().(ChaosConfig)
+}
+
+func (cl *chaosLayer) setChaos(config ChaosConfig) {
+	cl.config.Store(config)
+}
+
+func (cl *chaosLayer) roll(chance int) bool {
+	return chance > cl.random.Intn(100)
+}
+
+// inject applies the latency, timeouts and errors of the config to an operation
+func (cl *chaosLayer) inject(ctx context.Context, config ChaosConfig) error {
+	if config.Latency > 0 && cl.roll(config.LatencyChance) {
+		if err := sleepContext(ctx, config.Latency); err != nil {
+			return &kindError{kind: ErrTimeout, err: err}
+		}
+	}
+	if cl.roll(config.TimeoutChance) {
+		timeoutAfter := config.TimeoutAfter
+		if timeoutAfter == 0 {
+			timeoutAfter = defaultChaosTimeoutAfter
+		}
+		if err := sleepContext(ctx, timeoutAfter); err != nil {
+			return &kindError{kind: ErrTimeout, err: err}
+		}
+		return &kindError{kind: ErrTimeout, err: errChaosTimeout}
+	}
+	if cl.roll(config.ErrorChance) {
+		return newBackendError(errChaosUnavailable)
+	}
+	return nil
+}
+
+func (cl *chaosLayer) Get(ctx context.Context, key string, refrence interface{}) (*Cachable, error) {
+	config := cl.chaos()
+	if err := cl.inject(ctx, config); err != nil {
+		return nil, err
+	}
+	res, err := cl.ICache.Get(ctx, key, refrence)
+	if err == nil && cl.roll(config.CorruptChance) {
+		return nil, newDecodeError(errChaosCorrupted)
+	}
+	return res, err
+}
+
+func (cl *chaosLayer) Set(ctx context.Context, key string, value *Cachable) error {
+	config := cl.chaos()
+	if err := cl.inject(ctx, config); err != nil {
+		return err
+	}
+	if cl.roll(config.DropWriteChance) {
+		return nil
+	}
+	return cl.ICache.Set(ctx, key, value)
+}
+
+func (cl *chaosLayer) Delete(ctx context.Context, key string) error {
+	if err := cl.inject(ctx, cl.chaos()); err != nil {
+		return err
+	}
+	return cl.ICache.Delete(ctx, key)
+}
+
+// sleepContext waits for d, unless ctx is done first
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Chaos returns the fault injection of a single layer, which must have a chaos block in the config
+func (mn *MnemosyneInstance) Chaos(targetLayerName string) (ChaosConfig, error) {
+	layer, err := mn.chaosLayer(targetLayerName)
+	if err != nil {
+		return ChaosConfig{}, err
+	}
+	return layer.chaos(), nil
+}
+
+// SetChaos changes the fault injection of a single layer at runtime. Only the layers with a chaos block in the config
+// (even an empty one) can inject faults, so the layers of a production config can't be broken by mistake
+func (mn *MnemosyneInstance) SetChaos(targetLayerName string, config ChaosConfig) error {
+	if err := config.validate(); err != nil {
+		return err
+	}
+	layer, err := mn.chaosLayer(targetLayerName)
+	if err != nil {
+		return err
+	}
+	layer.setChaos(config)
+	return nil
+}
+
+func (mn *MnemosyneInstance) chaosLayer(targetLayerName string) (*chaosLayer, error) {
+	for _, layer := range mn.cacheLayers {
+		if layer.Name() != targetLayerName {
+			continue
+		}
+		if cl, ok := layer.(*chaosLayer); ok {
+			return cl, nil
+		}
+		return nil, fmt.Errorf("Layer Named: %v has no chaos config", targetLayerName)
+	}
+	return nil, fmt.Errorf("Layer Named: %v Not Found", targetLayerName)
+}
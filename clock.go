@@ -0,0 +1,82 @@
+package mnemosyne
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Clock tells Mnemosyne the time, which stamps the values on Set and ages them on Get.
+// Expiry of the layers (ttl) is left to their backends, which use the wall clock, except for fastmemory
+// which expires values and reports their TTL by the clock too
+type Clock interface {
+	Now() time.Time
+}
+
+// RandomSource provides the randomness of amnesia and of picking the slave to read from,
+// it must be safe for concurrent use
+type RandomSource interface {
+	// Intn returns a non-negative pseudo-random number in [0,n)
+	Intn(n int) int
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// globalRandom uses the shared source of math/rand
+type globalRandom struct{}
+
+func (globalRandom) Intn(n int) int {
+	return rand.Intn(n)
+}
+
+type lockedRandom struct {
+	lock   sync.Mutex
+	source *rand.Rand
+}
+
+// NewRandomSource returns a RandomSource safe for concurrent use which yields the same sequence for the same seed
+func NewRandomSource(seed int64) RandomSource {
+	return &lockedRandom{source: rand.New(rand.NewSource(seed))}
+}
+
+func (r *lockedRandom) Intn(n int) int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.source.Intn(n)
+}
+
+// FakeClock is a Clock which only moves when told to, for tests
+type FakeClock struct {
+	lock sync.Mutex
+	now  time.Time
+}
+
+// NewFakeClock returns a FakeClock stopped at now
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now returns the time the clock is stopped at
+func (c *FakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d
+func (c *FakeClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Set moves the clock to now
+func (c *FakeClock) Set(now time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = now
+}
@@ -0,0 +1,294 @@
+// Command mnemosyne inspects and manages the caches of a service from the command line,
+// using the same YAML config the service does.
+//
+// Usage:
+//
+//	mnemosyne validate -config config.yaml
+//	mnemosyne migrate  -config config.yaml [-out migrated.yaml]
+//	mnemosyne get      -config config.yaml -instance results [-layer results-redis] <key>
+//	mnemosyne set      -config config.yaml -instance results [-layer results-redis] <key> <json value>
+//	mnemosyne del      -config config.yaml -instance results [-layer results-redis] <key>
+//	mnemosyne ttl      -config config.yaml -instance results [-layer results-redis] <key>
+//	mnemosyne flush    -config config.yaml -instance results -layer results-redis
+//	mnemosyne scan     -config config.yaml -instance results -layer results-redis [-limit 100] <pattern>
+//
+// Without -layer, get shows every layer's view of the key and the other commands act on all layers.
+// Values are printed decoded (decrypted and decompressed) and pretty-printed.
+// In-memory layers live in the service's process, so only the shared (redis) layers are useful to inspect.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mghayour/mnemosyne"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+type command struct {
+	name string
+	// args is the number of positional arguments of the command
+	args          int
+	usage         string
+	layerRequired bool
+	run           func(ctx context.Context, cli *cli, args []string) error
+}
+
+var commands = []command{
+	{name: "validate", usage: "lints the config file"},
+	{name: "migrate", usage: "converts the gaurdian and redis layers of the config file to rediscluster"},
+	{name: "get", args: 1, usage: "<key> shows the decoded value and metadata of a key", run: runGet},
+	{name: "set", args: 2, usage: "<key> <json value> writes a value", run: runSet},
+	{name: "del", args: 1, usage: "<key> deletes a key", run: runDel},
+	{name: "ttl", args: 1, usage: "<key> shows the remaining TTL of a key", run: runTTL},
+	{name: "flush", usage: "clears a layer", layerRequired: true, run: runFlush},
+	{name: "scan", args: 1, usage: "<pattern> lists the keys matching a glob pattern", layerRequired: true, run: runScan},
+}
+
+type cli struct {
+	stdout   io.Writer
+	instance *mnemosyne.MnemosyneInstance
+	layer    *mnemosyne.Layer
+	limit    int
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		printUsage(stderr)
+		return exitUsage
+	}
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == args[0] {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		printUsage(stderr)
+		return exitUsage
+	}
+
+	flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	configPath := flags.String("config", "config.yaml", "path of the config file")
+	instanceName := flags.String("instance", "", "name of the cache instance")
+	layerName := flags.String("layer", "", "name of the layer (default: all layers)")
+	limit := flags.Int("limit", 100, "maximum number of keys to scan, zero means no limit")
+	timeout := flags.Duration("timeout", 10*time.Second, "timeout of the command")
+	out := flags.String("out", "", "path to write the migrated config to (default: stdout)")
+	if err := flags.Parse(args[1:]); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() != cmd.args {
+		fmt.Fprintf(stderr, "usage: mnemosyne %s [flags] %s\n", cmd.name, cmd.usage)
+		return exitUsage
+	}
+
+	config := viper.New()
+	config.SetConfigFile(*configPath)
+	if err := config.ReadInConfig(); err != nil {
+		fmt.Fprintf(stderr, "error reading config: %v\n", err)
+		return exitError
+	}
+	switch cmd.name {
+	case "validate":
+		return validate(config, stdout)
+	case "migrate":
+		return migrate(config, *out, stdout, stderr)
+	}
+
+	if *instanceName == "" || (cmd.layerRequired && *layerName == "") {
+		fmt.Fprintf(stderr, "mnemosyne %s requires -instance", cmd.name)
+		if cmd.layerRequired {
+			fmt.Fprint(stderr, " and -layer")
+		}
+		fmt.Fprintln(stderr)
+		return exitUsage
+	}
+	manager := mnemosyne.NewMnemosyne(config, nil, nil)
+	c := &cli{stdout: stdout, limit: *limit}
+	c.instance = manager.Select(*instanceName)
+	if c.instance == nil {
+		fmt.Fprintf(stderr, "unknown instance %q, instances are: %s\n", *instanceName, strings.Join(manager.Instances(), ", "))
+		return exitError
+	}
+	if *layerName != "" {
+		layer, err := c.instance.Layer(*layerName)
+		if err != nil {
+			fmt.Fprintf(stderr, "%v, layers are: %s\n", err, strings.Join(c.instance.LayerNames(), ", "))
+			return exitError
+		}
+		c.layer = layer
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	defer manager.Close(ctx)
+	if err := cmd.run(ctx, c, flags.Args()); err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+	return exitOK
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "usage: mnemosyne <command> [flags] [args]")
+	fmt.Fprintln(w, "commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-8s %s\n", cmd.name, cmd.usage)
+	}
+	fmt.Fprintln(w, "run mnemosyne <command> -h for the flags of a command")
+}
+
+func validate(config *viper.Viper, stdout io.Writer) int {
+	problems := mnemosyne.ValidateConfig(config)
+	exitCode := exitOK
+	for _, problem := range problems {
+		level := "warning"
+		if !problem.Warning {
+			level = "error"
+			exitCode = exitError
+		}
+		fmt.Fprintf(stdout, "%s: %v\n", level, problem)
+	}
+	if len(problems) == 0 {
+		fmt.Fprintln(stdout, "config is valid")
+	}
+	return exitCode
+}
+
+func migrate(config *viper.Viper, out string, stdout, stderr io.Writer) int {
+	migration := mnemosyne.MigrateConfig(config)
+	exitCode := exitOK
+	for _, problem := range migration.Problems {
+		level := "warning"
+		if !problem.Warning {
+			level = "error"
+			exitCode = exitError
+		}
+		fmt.Fprintf(stderr, "%s: %v\n", level, problem)
+	}
+	for _, key := range migration.Migrated {
+		fmt.Fprintf(stderr, "migrated %s to rediscluster\n", key)
+	}
+	if out != "" {
+		if err := migration.Config.WriteConfigAs(out); err != nil {
+			fmt.Fprintf(stderr, "error writing config: %v\n", err)
+			return exitError
+		}
+		return exitCode
+	}
+	encoded, err := yaml.Marshal(migration.Config.AllSettings())
+	if err != nil {
+		fmt.Fprintf(stderr, "error encoding config: %v\n", err)
+		return exitError
+	}
+	stdout.Write(encoded)
+	return exitCode
+}
+
+var errNotFound = errors.New("key not found")
+
+func runGet(ctx context.Context, c *cli, args []string) error {
+	if c.layer != nil {
+		explanation := c.layer.Explain(ctx, args[0])
+		if err := c.printJSON(explanation); err != nil {
+			return err
+		}
+		if !explanation.Present {
+			return errNotFound
+		}
+		return nil
+	}
+	explanation, err := c.instance.Explain(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	if err := c.printJSON(explanation); err != nil {
+		return err
+	}
+	if explanation.ServedBy == -1 {
+		return errNotFound
+	}
+	return nil
+}
+
+func runSet(ctx context.Context, c *cli, args []string) error {
+	if !json.Valid([]byte(args[1])) {
+		return errors.New("value must be valid JSON (quote strings, e.g. '\"text\"')")
+	}
+	value := json.RawMessage(args[1])
+	for _, layer := range c.targetLayers() {
+		if err := layer.Set(ctx, args[0], value); err != nil {
+			return fmt.Errorf("error setting %s: %w", layer.Name(), err)
+		}
+	}
+	return nil
+}
+
+func runDel(ctx context.Context, c *cli, args []string) error {
+	if c.layer != nil {
+		return c.layer.Delete(ctx, args[0])
+	}
+	return c.instance.Delete(ctx, args[0])
+}
+
+func runTTL(ctx context.Context, c *cli, args []string) error {
+	for _, layer := range c.targetLayers() {
+		fmt.Fprintf(c.stdout, "%s\t%v\n", layer.Name(), layer.TTL(ctx, args[0]))
+	}
+	return nil
+}
+
+func runFlush(ctx context.Context, c *cli, args []string) error {
+	return c.layer.Flush()
+}
+
+func runScan(ctx context.Context, c *cli, args []string) error {
+	keys, err := c.layer.Scan(ctx, args[0], c.limit)
+	for _, key := range keys {
+		fmt.Fprintln(c.stdout, key)
+	}
+	return err
+}
+
+// targetLayers returns the selected layer, or all layers if none is selected
+func (c *cli) targetLayers() []*mnemosyne.Layer {
+	if c.layer != nil {
+		return []*mnemosyne.Layer{c.layer}
+	}
+	var layers []*mnemosyne.Layer
+	for _, name := range c.instance.LayerNames() {
+		if layer, err := c.instance.Layer(name); err == nil {
+			layers = append(layers, layer)
+		}
+	}
+	return layers
+}
+
+func (c *cli) printJSON(value interface{}) error {
+	encoded, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(c.stdout, string(encoded))
+	return err
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeConfig writes a config of a single instance with a redis layer on addr, and returns its path
+func writeConfig(t *testing.T, addr string, extra string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	config := fmt.Sprintf(`cache:
+  results:
+    soft-ttl: 2h
+    layers:
+      - results-redis
+    results-redis:
+      type: redis
+      address: %s
+      ttl: 1h
+      compression: true
+%s`, addr, extra)
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCommands(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mr.Close)
+	config := writeConfig(t, mr.Addr(), "")
+	invalidConfig := writeConfig(t, mr.Addr(), "    soft-ttl-typo: 1h\n  broken:\n    layers: [broken-missing]\n")
+	migratedPath := filepath.Join(t.TempDir(), "migrated.yaml")
+
+	// the cases run in order against the same redis
+	cases := []struct {
+		name     string
+		args     []string
+		exitCode int
+		stdout   string
+		stderr   string
+	}{
+		{name: "no command", args: nil, exitCode: exitUsage, stderr: "usage: mnemosyne <command>"},
+		{name: "unknown command", args: []string{"explode"}, exitCode: exitUsage, stderr: "commands:"},
+		{name: "missing argument", args: []string{"get", "-config", config, "-instance", "results"}, exitCode: exitUsage, stderr: "usage: mnemosyne get"},
+		{name: "unknown flag", args: []string{"get", "-bogus", "key"}, exitCode: exitUsage, stderr: "flag provided but not defined"},
+		{name: "missing config", args: []string{"validate", "-config", "/nonexistent.yaml"}, exitCode: exitError, stderr: "error reading config"},
+		{name: "missing instance", args: []string{"get", "-config", config, "key"}, exitCode: exitUsage, stderr: "requires -instance"},
+		{name: "missing layer", args: []string{"flush", "-config", config, "-instance", "results"}, exitCode: exitUsage, stderr: "requires -instance and -layer"},
+		{name: "unknown instance", args: []string{"get", "-config", config, "-instance", "users", "key"}, exitCode: exitError, stderr: `unknown instance "users", instances are: results`},
+		{name: "unknown layer", args: []string{"get", "-config", config, "-instance", "results", "-layer", "results-tiny", "key"}, exitCode: exitError, stderr: "layers are: results-redis"},
+
+		{name: "validate", args: []string{"validate", "-config", config}, exitCode: exitOK, stdout: "config is valid"},
+		{name: "validate invalid", args: []string{"validate", "-config", invalidConfig}, exitCode: exitError, stdout: "error: "},
+		{name: "migrate", args: []string{"migrate", "-config", config}, exitCode: exitOK, stdout: "type: rediscluster", stderr: "migrated cache.results.results-redis to rediscluster"},
+		{name: "migrate to file", args: []string{"migrate", "-config", config, "-out", migratedPath}, exitCode: exitOK},
+		{name: "validate migrated", args: []string{"validate", "-config", migratedPath}, exitCode: exitOK, stdout: "config is valid"},
+
+		{name: "get missing", args: []string{"get", "-config", config, "-instance", "results", "user:1"}, exitCode: exitError, stderr: "key not found"},
+		{name: "set invalid json", args: []string{"set", "-config", config, "-instance", "results", "user:1", "text"}, exitCode: exitError, stderr: "value must be valid JSON"},
+		{name: "set", args: []string{"set", "-config", config, "-instance", "results", "user:1", `{"name":"ali"}`}, exitCode: exitOK},
+		{name: "set another", args: []string{"set", "-config", config, "-instance", "results", "-layer", "results-redis", "user:2", `"text"`}, exitCode: exitOK},
+		{name: "get", args: []string{"get", "-config", config, "-instance", "results", "user:1"}, exitCode: exitOK, stdout: `"name": "ali"`},
+		{name: "get from layer", args: []string{"get", "-config", config, "-instance", "results", "-layer", "results-redis", "user:2"}, exitCode: exitOK, stdout: `"Compressed": true`},
+		{name: "ttl", args: []string{"ttl", "-config", config, "-instance", "results", "user:1"}, exitCode: exitOK, stdout: "results-redis\t1h0m0s"},
+		{name: "scan", args: []string{"scan", "-config", config, "-instance", "results", "-layer", "results-redis", "user:[12]"}, exitCode: exitOK, stdout: "user:"},
+		{name: "del", args: []string{"del", "-config", config, "-instance", "results", "user:1"}, exitCode: exitOK},
+		{name: "get deleted", args: []string{"get", "-config", config, "-instance", "results", "user:1"}, exitCode: exitError, stderr: "key not found"},
+		{name: "flush", args: []string{"flush", "-config", config, "-instance", "results", "-layer", "results-redis"}, exitCode: exitOK},
+		{name: "get flushed", args: []string{"get", "-config", config, "-instance", "results", "-layer", "results-redis", "user:2"}, exitCode: exitError, stderr: "key not found"},
+	}
+	for _, c := range cases {
+		var stdout, stderr bytes.Buffer
+		exitCode := run(c.args, &stdout, &stderr)
+		assert.Equal(t, c.exitCode, exitCode, "%s: %s", c.name, stderr.String())
+		assert.Contains(t, stdout.String(), c.stdout, c.name)
+		assert.Contains(t, stderr.String(), c.stderr, c.name)
+	}
+}
+
+func TestScanPrintsEveryMatch(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mr.Close)
+	config := writeConfig(t, mr.Addr(), "")
+	for _, key := range []string{"user:1", "user:2", "order:1"} {
+		assert.Equal(t, exitOK, run([]string{"set", "-config", config, "-instance", "results", key, "1"}, &bytes.Buffer{}, &bytes.Buffer{}))
+	}
+
+	var stdout bytes.Buffer
+	assert.Equal(t, exitOK, run([]string{"scan", "-config", config, "-instance", "results", "-layer", "results-redis", "user:*"}, &stdout, &bytes.Buffer{}))
+	keys := strings.Fields(stdout.String())
+	assert.ElementsMatch(t, []string{"user:1", "user:2"}, keys)
+
+	stdout.Reset()
+	assert.Equal(t, exitOK, run([]string{"scan", "-config", config, "-instance", "results", "-layer", "results-redis", "-limit", "1", "*"}, &stdout, &bytes.Buffer{}))
+	assert.Len(t, strings.Fields(stdout.String()), 1)
+}
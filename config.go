@@ -0,0 +1,179 @@
+package mnemosyne
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// layerTypes are the known types of cache layers
+var layerTypes = map[string]bool{
+	"memory":       true,
+	"fastmemory":   true,
+	"tiny":         true,
+	"redis":        true,
+	"rediscluster": true,
+	"gaurdian":     true,
+}
+
+// ConfigProblem is a problem found in the config of Mnemosyne
+type ConfigProblem struct {
+	// Key is the config key the problem is about, e.g. cache.results.results-redis.ttl
+	Key string
+	// Warning shows the config still works, but probably not the way it's meant to
+	Warning bool
+	Message string
+}
+
+func (p ConfigProblem) Error() string {
+	return p.Key + ": " + p.Message
+}
+
+// ValidateConfig lints the cache instances in config without connecting to anything,
+// and returns the problems found, sorted by key
+func ValidateConfig(config *viper.Viper) []ConfigProblem {
+	var problems []ConfigProblem
+	report := func(key string, warning bool, format string, args ...interface{}) {
+		problems = append(problems, ConfigProblem{Key: key, Warning: warning, Message: fmt.Sprintf(format, args...)})
+	}
+	cacheConfigs := config.GetStringMap("cache")
+	if len(cacheConfigs) == 0 {
+		report("cache", false, "no cache instance is defined")
+	}
+	for name := range cacheConfigs {
+		configKeyPrefix := "cache." + name
+		validateDuration(config, configKeyPrefix+".soft-ttl", report)
+		if !config.IsSet(configKeyPrefix + ".soft-ttl") {
+			report(configKeyPrefix+".soft-ttl", true, "is not set, so all values are considered stale")
+		}
+		validateBackgroundConfig(config, configKeyPrefix+".background", report)
+		layerNames := config.GetStringSlice(configKeyPrefix + ".layers")
+		if len(layerNames) == 0 {
+			report(configKeyPrefix+".layers", false, "no layer is defined")
+		}
+		seen := make(map[string]bool, len(layerNames))
+		for _, layerName := range layerNames {
+			keyPrefix := configKeyPrefix + "." + layerName
+			if seen[layerName] {
+				report(configKeyPrefix+".layers", false, "layer %s is listed more than once", layerName)
+				continue
+			}
+			seen[layerName] = true
+			if !config.IsSet(keyPrefix) {
+				report(keyPrefix, false, "layer is listed but not configured")
+				continue
+			}
+			validateLayerConfig(config, keyPrefix, report)
+		}
+	}
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].Key < problems[j].Key })
+	return problems
+}
+
+func validateLayerConfig(config *viper.Viper, keyPrefix string, report func(string, bool, string, ...interface{})) {
+	layerType := config.GetString(keyPrefix + ".type")
+	if !layerTypes[layerType] {
+		report(keyPrefix+".type", false, "unknown layer type %q", layerType)
+	}
+	validateDuration(config, keyPrefix+".ttl", report)
+	validateDuration(config, keyPrefix+".cleanup-interval", report)
+	validateDuration(config, keyPrefix+".idle-timeout", report)
+	if config.IsSet(keyPrefix + ".amnesia") {
+		amnesia, err := cast.ToIntE(config.Get(keyPrefix + ".amnesia"))
+		if err != nil || amnesia < 0 || amnesia > 100 {
+			report(keyPrefix+".amnesia", false, "must be a percentage between 0 and 100")
+		}
+	}
+	if config.IsSet(keyPrefix + ".compression") {
+		if _, err := cast.ToBoolE(config.Get(keyPrefix + ".compression")); err != nil {
+			report(keyPrefix+".compression", false, "must be a boolean")
+		}
+	}
+	switch layerType {
+	case "memory":
+		if config.GetInt(keyPrefix+".max-memory") <= 0 {
+			report(keyPrefix+".max-memory", true, "is not set, so the layer may grow without bounds")
+		}
+	case "fastmemory":
+		valueMode := config.GetString(keyPrefix + ".value-mode")
+		if valueMode != "" && valueMode != ValueModeCodec && valueMode != ValueModeZeroCopy {
+			report(keyPrefix+".value-mode", false, "unknown value-mode %q", valueMode)
+		}
+		if valueMode == ValueModeZeroCopy && config.IsSet(keyPrefix+".encryption") {
+			report(keyPrefix+".encryption", true, "is ignored in %s value-mode", ValueModeZeroCopy)
+		}
+	case "redis", "gaurdian":
+		if config.GetString(keyPrefix+".address") == "" {
+			report(keyPrefix+".address", false, "is required for %s layers", layerType)
+		}
+		if layerType == "gaurdian" {
+			report(keyPrefix+".type", true, "gaurdian is deprecated in favor of rediscluster, run `mnemosyne migrate` to convert the config")
+		}
+	case "rediscluster":
+		var shards []*RedisClusterAddress
+		if err := config.UnmarshalKey(keyPrefix+".cluster", &shards); err != nil {
+			report(keyPrefix+".cluster", false, "%v", err)
+		} else if len(shards) == 0 {
+			report(keyPrefix+".cluster", false, "at least one shard is required for rediscluster layers")
+		}
+		for i, shard := range shards {
+			if shard == nil || shard.MasterAddr == "" {
+				report(fmt.Sprintf("%s.cluster[%d].address", keyPrefix, i), false, "is required")
+			}
+		}
+	}
+	if layerType == "redis" || layerType == "rediscluster" || layerType == "gaurdian" {
+		if config.GetDuration(keyPrefix+".ttl") == 0 {
+			report(keyPrefix+".ttl", true, "is not set, so values never expire")
+		}
+	}
+	if config.IsSet(keyPrefix + ".chaos") {
+		validateChaosConfig(config, keyPrefix+".chaos", report)
+	}
+	if config.IsSet(keyPrefix + ".encryption") {
+		if _, err := newKeyring(config.GetString(keyPrefix+".encryption.primary"),
+			config.GetStringMapString(keyPrefix+".encryption.keys")); err != nil {
+			report(keyPrefix+".encryption", false, "%v", err)
+		}
+	}
+}
+
+func validateBackgroundConfig(config *viper.Viper, keyPrefix string, report func(string, bool, string, ...interface{})) {
+	for _, key := range []string{keyPrefix + ".workers", keyPrefix + ".queue-size"} {
+		if !config.IsSet(key) {
+			continue
+		}
+		if value, err := cast.ToIntE(config.Get(key)); err != nil || value < 1 {
+			report(key, false, "must be a positive number")
+		}
+	}
+	dropPolicy := config.GetString(keyPrefix + ".drop-policy")
+	if dropPolicy != "" && dropPolicy != DropNewest && dropPolicy != DropOldest {
+		report(keyPrefix+".drop-policy", false, "unknown drop-policy %q", dropPolicy)
+	}
+}
+
+func validateChaosConfig(config *viper.Viper, keyPrefix string, report func(string, bool, string, ...interface{})) {
+	report(keyPrefix, true, "is set, so the layer fails on purpose (keep it out of production)")
+	validateDuration(config, keyPrefix+".latency", report)
+	validateDuration(config, keyPrefix+".timeout-after", report)
+	for _, name := range []string{"error", "latency-chance", "timeout", "corrupt", "drop-writes"} {
+		if !config.IsSet(keyPrefix + "." + name) {
+			continue
+		}
+		if chance, err := cast.ToIntE(config.Get(keyPrefix + "." + name)); err != nil || chance < 0 || chance > 100 {
+			report(keyPrefix+"."+name, false, "must be a percentage between 0 and 100")
+		}
+	}
+}
+
+func validateDuration(config *viper.Viper, key string, report func(string, bool, string, ...interface{})) {
+	if !config.IsSet(key) {
+		return
+	}
+	if _, err := cast.ToDurationE(config.Get(key)); err != nil {
+		report(key, false, "is not a valid duration: %v", err)
+	}
+}
@@ -2,20 +2,22 @@ package mnemosyne
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"strings"
+	"sort"
 	"time"
 
-	"github.com/go-redis/redis"
-	"github.com/pkg/errors"
-
-	"github.com/sirupsen/logrus"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Mnemosyne is the parent object which holds all cache instances
 type Mnemosyne struct {
-	childs map[string]*MnemosyneInstance
+	childs     map[string]*MnemosyneInstance
+	logger     Logger
+	registerer prometheus.Registerer
+	collector  *prometheusCollector
 }
 
 // MnemosyneInstance is an instance of a multi-layer cache
@@ -23,34 +25,70 @@ type MnemosyneInstance struct {
 	name         string
 	cacheLayers  []ICache
 	cacheWatcher ICounter
+	observers    []observer
+	stats        *statsRecorder
+	tracer       trace.Tracer
+	logger       Logger
 	softTTL      time.Duration
+	fingerprint  bool
+	background   *workerPool
+	lifecycle    lifecycle
+	clock        Clock
 }
 
-// ErrCacheMiss is the Error returned when a cache miss happens
-type ErrCacheMiss struct {
-	message string
+// ICacheInstance holds the cache operations of a MnemosyneInstance, so that services can depend on it
+// and use a fake (e.g. mnemosynetest.Fake) in their tests
+type ICacheInstance interface {
+	Get(ctx context.Context, key string, refrence interface{}) (interface{}, error)
+	GetEntry(ctx context.Context, key string, refrence interface{}) (*Entry, error)
+	GetAndShouldUpdate(ctx context.Context, key string, refrence interface{}) (interface{}, bool, error)
+	ShouldUpdate(ctx context.Context, key string) (bool, error)
+	ShouldUpdateDeep(ctx context.Context, key string, refrence interface{}) (bool, error)
+	Set(ctx context.Context, key string, value interface{}) error
+	Delete(ctx context.Context, key string) error
+	TTL(ctx context.Context, key string) (int, time.Duration)
+	Flush(targetLayerName string) error
 }
 
-func (e *ErrCacheMiss) Error() string {
-	return e.message
-}
+var _ ICacheInstance = (*MnemosyneInstance)(nil)
 
 // NewMnemosyne initializes the Mnemosyne object which holds all the cache instances
-func NewMnemosyne(config *viper.Viper, commTimer ITimer, cacheHitCounter ICounter) *Mnemosyne {
+func NewMnemosyne(config *viper.Viper, commTimer ITimer, cacheHitCounter ICounter, opts ...Option) *Mnemosyne {
 	if commTimer == nil {
 		commTimer = NewDummyTimer()
 	}
 	if cacheHitCounter == nil {
 		cacheHitCounter = NewDummyCounter()
 	}
+	mnemosyneOpts := defaultOptions()
+	for _, opt := range opts {
+		opt(&mnemosyneOpts)
+	}
+	mnemosyneOpts.logger = newRateLimitedLogger(mnemosyneOpts.logger, mnemosyneOpts.logRateLimit)
+	var observers []observer
+	var collector *prometheusCollector
+	if mnemosyneOpts.registerer != nil {
+		collector = newPrometheusCollector()
+		observers = append(observers, collector)
+	}
 	cacheConfigs := config.GetStringMap("cache")
 	caches := make(map[string]*MnemosyneInstance, len(cacheConfigs))
 	for cacheName := range cacheConfigs {
-		caches[cacheName] = newMnemosyneInstance(cacheName, config, commTimer, cacheHitCounter)
+		caches[cacheName] = newMnemosyneInstance(cacheName, config, commTimer, cacheHitCounter, &mnemosyneOpts, observers)
 	}
-	return &Mnemosyne{
+	m := &Mnemosyne{
 		childs: caches,
+		logger: mnemosyneOpts.logger,
 	}
+	if collector != nil {
+		collector.mnemosyne = m
+		if err := mnemosyneOpts.registerer.Register(collector); err != nil {
+			mnemosyneOpts.logger.Error("Error registering Prometheus collector", Fields{FieldError: err})
+		} else {
+			m.registerer, m.collector = mnemosyneOpts.registerer, collector
+		}
+	}
+	return m
 }
 
 // Select returns a cache instance selected by name
@@ -58,11 +96,35 @@ func (m *Mnemosyne) Select(cacheName string) *MnemosyneInstance {
 	return m.childs[cacheName]
 }
 
-func newMnemosyneInstance(name string, config *viper.Viper, commTimer ITimer, hitCounter ICounter) *MnemosyneInstance {
+// Instances returns the names of all cache instances, sorted
+func (m *Mnemosyne) Instances() []string {
+	names := make([]string, 0, len(m.childs))
+	for name := range m.childs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func newMnemosyneInstance(name string, config *viper.Viper, commTimer ITimer, hitCounter ICounter, opts *options, observers []observer) *MnemosyneInstance {
 	configKeyPrefix := fmt.Sprintf("cache.%s", name)
 	layerNames := config.GetStringSlice(configKeyPrefix + ".layers")
-	cacheLayers := make([]ICache, len(layerNames))
+	mn := &MnemosyneInstance{
+		name:         name,
+		cacheLayers:  make([]ICache, len(layerNames)),
+		cacheWatcher: hitCounter,
+		stats:        newStatsRecorder(name, layerNames),
+		tracer:       newTracer(opts.tracerProvider),
+		logger:       opts.logger,
+		softTTL:      config.GetDuration(configKeyPrefix + ".soft-ttl"),
+		fingerprint:  config.GetBool(configKeyPrefix + ".fingerprint"),
+		clock:        opts.clock,
+	}
+	mn.lifecycle.drained = make(chan struct{})
+	mn.observers = append(append([]observer{}, observers...), mn.stats)
+	mn.background = newBackgroundPool(config, name, opts.logger)
 	for i, layerName := range layerNames {
+		layerName := layerName
 		keyPrefix := configKeyPrefix + "." + layerName
 		cleanupInterval := config.GetDuration(keyPrefix + ".cleanup-interval")
 		if cleanupInterval.Nanoseconds() == 0 {
@@ -76,13 +138,31 @@ func newMnemosyneInstance(name string, config *viper.Viper, commTimer ITimer, hi
 			amnesiaChance:      config.GetInt(keyPrefix + ".amnesia"),
 			compressionEnabled: config.GetBool(keyPrefix + ".compression"),
 			memOpts: MemoryOpts{
-				maxMem: config.GetInt(keyPrefix + ".max-memory"),
+				maxMem:    config.GetInt(keyPrefix + ".max-memory"),
+				valueMode: config.GetString(keyPrefix + ".value-mode"),
 			},
 			redisOpts: RedisOpts{
 				db:          config.GetInt(keyPrefix + ".db"),
 				idleTimeout: config.GetDuration(keyPrefix + ".idle-timeout"),
 				shards:      make([]*RedisClusterAddress, 1),
 			},
+			onEvict: func(reason string) {
+				mn.observeEviction(layerName, reason)
+			},
+			logger:       opts.logger,
+			instanceName: name,
+			random:       opts.random,
+			clock:        opts.clock,
+		}
+		if config.IsSet(keyPrefix + ".encryption") {
+			keys, err := newKeyring(config.GetString(keyPrefix+".encryption.primary"),
+				config.GetStringMapString(keyPrefix+".encryption.keys"))
+			if err != nil {
+				// never fall back to plaintext, the layer will fail all operations instead
+				layerOptions.log().Error("Error reading encryption config", err)
+				keys = &keyring{err: fmt.Errorf("encryption of layer %s is misconfigured: %w", layerName, err)}
+			}
+			layerOptions.keyring = keys
 		}
 		if layerOptions.layerType == "redis" {
 			layerOptions.redisOpts.shards[0] = &RedisClusterAddress{
@@ -97,44 +177,63 @@ func newMnemosyneInstance(name string, config *viper.Viper, commTimer ITimer, hi
 		} else if layerOptions.layerType == "rediscluster" {
 			err := config.UnmarshalKey(keyPrefix+".cluster", &layerOptions.redisOpts.shards)
 			if err != nil {
-				logrus.WithError(err).Error("Error reading redis cluster config")
+				layerOptions.log().Error("Error reading redis cluster config", err)
+			} else if len(layerOptions.redisOpts.shards) == 0 {
+				layerOptions.log().Error("Malformed: redis cluster config has no shards", nil)
 			}
 		}
-		cacheLayers[i] = NewCacheLayer(layerOptions, commTimer)
+		mn.cacheLayers[i] = NewCacheLayer(layerOptions, commTimer)
+		if config.IsSet(keyPrefix+".chaos") && mn.cacheLayers[i] != nil {
+			chaos := readChaosConfig(config, keyPrefix+".chaos")
+			if err := chaos.validate(); err != nil {
+				layerOptions.log().Error("Malformed: "+err.Error(), nil)
+				chaos = ChaosConfig{}
+			}
+			layerOptions.log().Warn("chaos is enabled, the layer will fail on purpose", nil)
+			mn.cacheLayers[i] = newChaosLayer(mn.cacheLayers[i], chaos, opts.random)
+		}
 
 	}
-	return &MnemosyneInstance{
-		name:         name,
-		cacheLayers:  cacheLayers,
-		cacheWatcher: hitCounter,
-		softTTL:      config.GetDuration(configKeyPrefix + ".soft-ttl"),
-	}
+	return mn
 }
 
-func (mn *MnemosyneInstance) get(ctx context.Context, key string, refrence interface{}) (*cachable, error) {
+// get returns the value from the first layer which has it, along with the index of that layer
+// and whether the upper layers were scheduled to be filled with it
+func (mn *MnemosyneInstance) get(ctx context.Context, key string, refrence interface{}) (*Cachable, int, bool, error) {
 	cacheErrors := make([]error, len(mn.cacheLayers))
-	var result *cachable
+	var result *Cachable
 	for i, layer := range mn.cacheLayers {
-		result, cacheErrors[i] = layer.Get(ctx, key, refrence)
-		if cacheErrors[i] == nil {
-			go func() {
-				mn.fillUpperLayers(key, result, i)
-				mn.cacheWatcher.Inc(mn.name, fmt.Sprintf("layer%d", i))
-			}()
-			return result, nil
+		var err error
+		result, err = mn.layerGet(ctx, i, key, refrence)
+		if err == nil {
+			mn.observeHit(i)
+			backfilled := mn.scheduleFill(ctx, key, result, i)
+			mn.goBackground(func() { mn.cacheWatcher.Inc(mn.name, fmt.Sprintf("layer%d", i)) })
+			return result, i, backfilled, nil
 		}
+		var mismatch *fingerprintMismatchError
+		if errors.As(err, &mismatch) {
+			mn.goBackground(func() { mn.cacheWatcher.Inc(mn.name, "fingerprint-mismatch") })
+		}
+		cacheErrors[i] = &LayerError{Layer: layer.Name(), Index: i, Op: "get", Err: err}
 	}
-	go mn.cacheWatcher.Inc(mn.name, "miss")
-	return nil, &ErrCacheMiss{message: "Miss"} // FIXME: better Error combination
+	mn.goBackground(func() { mn.cacheWatcher.Inc(mn.name, "miss") })
+	mn.observeMiss()
+	return nil, -1, false, &ErrCacheMiss{message: "Miss", Errors: cacheErrors}
 }
 
 // get from all layers and replace older data with new one
-func (mn *MnemosyneInstance) getAndSyncLayers(ctx context.Context, key string, refrence interface{}) (*cachable, error) {
-	cacheResults := make([]*cachable, len(mn.cacheLayers))
-	var result *cachable
+func (mn *MnemosyneInstance) getAndSyncLayers(ctx context.Context, key string, refrence interface{}) (*Cachable, error) {
+	cacheResults := make([]*Cachable, len(mn.cacheLayers))
+	cacheErrors := make([]error, len(mn.cacheLayers))
+	var result *Cachable
 	var resultLayer int
 	for i, layer := range mn.cacheLayers {
-		cacheResults[i], _ = layer.Get(ctx, key, refrence)
+		var err error
+		cacheResults[i], err = mn.layerGet(ctx, i, key, refrence)
+		if err != nil {
+			cacheErrors[i] = &LayerError{Layer: layer.Name(), Index: i, Op: "get", Err: err}
+		}
 		if cacheResults[i] != nil &&
 			(result == nil ||
 				cacheResults[i].Time.After(result.Time)) {
@@ -143,49 +242,47 @@ func (mn *MnemosyneInstance) getAndSyncLayers(ctx context.Context, key string, r
 		}
 	}
 	if result == nil {
-		go mn.cacheWatcher.Inc(mn.name, "miss")
-		return nil, &ErrCacheMiss{message: fmt.Sprintf("Miss cache. layer %d", resultLayer)}
+		mn.goBackground(func() { mn.cacheWatcher.Inc(mn.name, "miss") })
+		mn.observeMiss()
+		return nil, &ErrCacheMiss{message: "Miss", Errors: cacheErrors}
 	}
-	for i, layer := range mn.cacheLayers {
+	for i := range mn.cacheLayers {
 		if cacheResults[i] == nil || cacheResults[i].Time.Before(result.Time) {
-			go layer.Set(ctx, key, result)
+			mn.scheduleSync(ctx, key, result, i)
 		}
 	}
 
-	go mn.cacheWatcher.Inc(mn.name, fmt.Sprintf("layer%d", resultLayer))
+	mn.goBackground(func() { mn.cacheWatcher.Inc(mn.name, fmt.Sprintf("layer%d", resultLayer)) })
+	mn.observeHit(resultLayer)
 	return result, nil
 }
 
 // GetAndShouldUpdate retrieves the value for key and also shows whether the soft-TTL of that key has passed or not
-func (mn *MnemosyneInstance) GetAndShouldUpdate(ctx context.Context, key string, refrence interface{}) (interface{}, bool, error) {
-	cachableObj, err := mn.get(ctx, key, refrence)
-	if err == redis.Nil {
+func (mn *MnemosyneInstance) GetAndShouldUpdate(ctx context.Context, key string, refrence interface{}) (value interface{}, shouldUpdate bool, err error) {
+	ctx, span := mn.startSpan(ctx, "GetAndShouldUpdate")
+	defer func() { endSpan(span, err, true) }()
+	return mn.getAndShouldUpdate(ctx, key, refrence)
+}
+
+func (mn *MnemosyneInstance) getAndShouldUpdate(ctx context.Context, key string, refrence interface{}) (interface{}, bool, error) {
+	defer mn.observeOperation("get", time.Now())
+	entry, err := mn.getEntry(ctx, key, refrence, false)
+	if errors.Is(err, ErrMiss) {
 		return nil, true, err
 	} else if err != nil {
 		return nil, false, err
 	}
-
-	if cachableObj == nil || cachableObj.CachedObject == nil {
-		logrus.Errorf("nil object found in cache %s ! %v", key, cachableObj)
-		return nil, false, errors.New("nil found")
-	}
-
-	dataAge := time.Since(cachableObj.Time)
-	go mn.monitorDataHotness(dataAge)
-	shouldUpdate := dataAge > mn.softTTL
 	if refrence == nil {
-		return nil, shouldUpdate, nil
+		return nil, entry.Stale, nil
 	}
-
-	if err != nil {
-		return nil, false, err
-	}
-	return cachableObj.CachedObject, shouldUpdate, nil
+	return entry.Value, entry.Stale, nil
 }
 
 // Get retrieves the value for key
-func (mn *MnemosyneInstance) Get(ctx context.Context, key string, refrence interface{}) (interface{}, error) {
-	res, _, err := mn.GetAndShouldUpdate(ctx, key, refrence)
+func (mn *MnemosyneInstance) Get(ctx context.Context, key string, refrence interface{}) (res interface{}, err error) {
+	ctx, span := mn.startSpan(ctx, "Get")
+	defer func() { endSpan(span, err, true) }()
+	res, _, err = mn.getAndShouldUpdate(ctx, key, refrence)
 	return res, err
 }
 
@@ -196,52 +293,67 @@ func (mn *MnemosyneInstance) ShouldUpdate(ctx context.Context, key string) (bool
 }
 
 // ShouldUpdateDeep checks all layers for newer result and will sync older cache layers
-func (mn *MnemosyneInstance) ShouldUpdateDeep(ctx context.Context, key string, refrence interface{}) (bool, error) {
+func (mn *MnemosyneInstance) ShouldUpdateDeep(ctx context.Context, key string, refrence interface{}) (shouldUpdate bool, err error) {
+	ctx, span := mn.startSpan(ctx, "ShouldUpdateDeep")
+	defer func() { endSpan(span, err, true) }()
+	defer mn.observeOperation("get", time.Now())
+	if err := mn.enter(); err != nil {
+		return false, err
+	}
+	defer mn.leave()
 	cachableObj, err := mn.getAndSyncLayers(ctx, key, refrence)
-	if err == redis.Nil {
+	if errors.Is(err, ErrMiss) {
 		return true, err
 	} else if err != nil {
 		return false, err
 	}
 
 	if cachableObj == nil || cachableObj.CachedObject == nil {
-		logrus.Errorf("nil object found in cache %s ! %v", key, cachableObj)
+		mn.logger.Error("nil object found in cache", Fields{FieldInstance: mn.name, FieldKeyHash: keyHash(key)})
 		return false, errors.New("nil found")
 	}
 
-	shouldUpdate := time.Now().Sub(cachableObj.Time) > mn.softTTL
-
-	return shouldUpdate, nil
+	return mn.clock.Now().Sub(cachableObj.Time) > mn.softTTL, nil
 }
 
 // Set sets the value for a key in all layers of the cache instance
-func (mn *MnemosyneInstance) Set(ctx context.Context, key string, value interface{}) error {
+func (mn *MnemosyneInstance) Set(ctx context.Context, key string, value interface{}) (err error) {
+	ctx, span := mn.startSpan(ctx, "Set")
+	defer func() { endSpan(span, err, false) }()
+	defer mn.observeOperation("set", time.Now())
+	if err := mn.enter(); err != nil {
+		return err
+	}
+	defer mn.leave()
 	if value == nil {
 		return fmt.Errorf("cannot set nil value in cache")
 	}
 
-	toCache := cachable{
+	toCache := Cachable{
 		CachedObject: value,
-		Time:         time.Now(),
+		Time:         mn.clock.Now(),
 	}
-	cacheErrors := make([]error, len(mn.cacheLayers))
-	errorStrings := make([]string, len(mn.cacheLayers))
-	haveErorr := false
+	if mn.fingerprint {
+		toCache.Fingerprint = typeFingerprint(value)
+	}
+	var cacheErrors []error
 	for i, layer := range mn.cacheLayers {
-		cacheErrors[i] = layer.Set(ctx, key, &toCache)
-		if cacheErrors[i] != nil {
-			errorStrings[i] = cacheErrors[i].Error()
-			haveErorr = true
+		if err := mn.layerSet(ctx, i, key, &toCache); err != nil {
+			cacheErrors = append(cacheErrors, &LayerError{Layer: layer.Name(), Index: i, Op: "set", Err: err})
 		}
 	}
-	if haveErorr {
-		return fmt.Errorf(strings.Join(errorStrings, ";"))
+	if len(cacheErrors) > 0 {
+		return &MultiError{Errors: cacheErrors}
 	}
 	return nil
 }
 
 // TTL returns the TTL of the first accessible data instance as well as the layer it was found on
 func (mn *MnemosyneInstance) TTL(ctx context.Context, key string) (int, time.Duration) {
+	if mn.enter() != nil {
+		return -1, 0
+	}
+	defer mn.leave()
 	for i, layer := range mn.cacheLayers {
 		dur := layer.TTL(ctx, key)
 		if dur > 0 {
@@ -252,25 +364,32 @@ func (mn *MnemosyneInstance) TTL(ctx context.Context, key string) (int, time.Dur
 }
 
 // Delete removes a key from all the layers (if exists)
-func (mn *MnemosyneInstance) Delete(ctx context.Context, key string) error {
-	cacheErrors := make([]error, len(mn.cacheLayers))
-	errorStrings := make([]string, len(mn.cacheLayers))
-	haveErorr := false
+func (mn *MnemosyneInstance) Delete(ctx context.Context, key string) (err error) {
+	ctx, span := mn.startSpan(ctx, "Delete")
+	defer func() { endSpan(span, err, false) }()
+	defer mn.observeOperation("delete", time.Now())
+	if err := mn.enter(); err != nil {
+		return err
+	}
+	defer mn.leave()
+	var cacheErrors []error
 	for i, layer := range mn.cacheLayers {
-		cacheErrors[i] = layer.Delete(ctx, key)
-		if cacheErrors[i] != nil {
-			errorStrings[i] = cacheErrors[i].Error()
-			haveErorr = true
+		if err := mn.layerDelete(ctx, i, key); err != nil {
+			cacheErrors = append(cacheErrors, &LayerError{Layer: layer.Name(), Index: i, Op: "delete", Err: err})
 		}
 	}
-	if haveErorr {
-		return fmt.Errorf(strings.Join(errorStrings, ";"))
+	if len(cacheErrors) > 0 {
+		return &MultiError{Errors: cacheErrors}
 	}
 	return nil
 }
 
 // Flush completly clears a single layer of the cache
 func (mn *MnemosyneInstance) Flush(targetLayerName string) error {
+	if err := mn.enter(); err != nil {
+		return err
+	}
+	defer mn.leave()
 	for _, layer := range mn.cacheLayers {
 		if layer.Name() == targetLayerName {
 			return layer.Clear()
@@ -279,26 +398,105 @@ func (mn *MnemosyneInstance) Flush(targetLayerName string) error {
 	return fmt.Errorf("Layer Named: %v Not Found", targetLayerName)
 }
 
-func (mn *MnemosyneInstance) fillUpperLayers(key string, value *cachable, layer int) {
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+// SetAmnesia changes the amnesia chance (in percent) of a single layer of the cache at runtime
+func (mn *MnemosyneInstance) SetAmnesia(targetLayerName string, chance int) error {
+	if chance < 0 || chance > 100 {
+		return fmt.Errorf("amnesia chance %d is not in the range of 0-100", chance)
+	}
+	for _, layer := range mn.cacheLayers {
+		if layer.Name() != targetLayerName {
+			continue
+		}
+		layerWithAmnesia, ok := unwrapLayer(layer).(amnesiac)
+		if !ok {
+			return fmt.Errorf("Layer Named: %v doesn't support amnesia", targetLayerName)
+		}
+		layerWithAmnesia.setAmnesia(chance)
+		return nil
+	}
+	return fmt.Errorf("Layer Named: %v Not Found", targetLayerName)
+}
+
+func (mn *MnemosyneInstance) fillUpperLayers(origin context.Context, key string, value *Cachable, layer int) {
+	if layer == 0 {
+		return
+	}
+	ctx, span := mn.startBackgroundSpan(origin, "fillUpperLayers")
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
 	defer cancel()
 	for i := layer - 1; i >= 0; i-- {
 		if value == nil {
 			continue
 		}
-		err := mn.cacheLayers[i].Set(ctx, key, value)
+		err := mn.backfill(ctx, key, value, i)
 		if err != nil {
-			logrus.Errorf("failed to fill layer %d : %v", i, err)
+			mn.logger.Error("failed to fill layer", Fields{
+				FieldInstance: mn.name,
+				FieldLayer:    mn.cacheLayers[i].Name(),
+				FieldKeyHash:  keyHash(key),
+				FieldError:    err,
+			})
 		}
 	}
 }
 
+// syncLayer replaces the older value of a layer found by getAndSyncLayers
+func (mn *MnemosyneInstance) syncLayer(origin context.Context, key string, value *Cachable, layer int) {
+	ctx, span := mn.startBackgroundSpan(origin, "syncLayer")
+	defer span.End()
+	// the origin's deadline still applies to the write, as it always did
+	if deadline, ok := origin.Deadline(); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+	mn.backfill(ctx, key, value, layer)
+}
+
+// backfill writes a value found in another layer into the given layer
+func (mn *MnemosyneInstance) backfill(ctx context.Context, key string, value *Cachable, layer int) error {
+	err := mn.layerSet(ctx, layer, key, value)
+	if err == nil {
+		mn.observeBackfill(layer)
+	}
+	return err
+}
+
+func (mn *MnemosyneInstance) layerGet(ctx context.Context, layer int, key string, refrence interface{}) (*Cachable, error) {
+	ctx, span := mn.startLayerSpan(ctx, layer, "get")
+	start := time.Now()
+	result, err := mn.cacheLayers[layer].Get(ctx, key, refrence)
+	mn.observeLayerOperation(layer, "get", err, start)
+	endSpan(span, err, true)
+	return result, err
+}
+
+func (mn *MnemosyneInstance) layerSet(ctx context.Context, layer int, key string, value *Cachable) error {
+	ctx, span := mn.startLayerSpan(ctx, layer, "set")
+	start := time.Now()
+	err := mn.cacheLayers[layer].Set(ctx, key, value)
+	mn.observeLayerOperation(layer, "set", err, start)
+	endSpan(span, err, false)
+	return err
+}
+
+func (mn *MnemosyneInstance) layerDelete(ctx context.Context, layer int, key string) error {
+	ctx, span := mn.startLayerSpan(ctx, layer, "delete")
+	start := time.Now()
+	err := mn.cacheLayers[layer].Delete(ctx, key)
+	mn.observeLayerOperation(layer, "delete", err, start)
+	endSpan(span, err, false)
+	return err
+}
+
 func (mn *MnemosyneInstance) monitorDataHotness(age time.Duration) {
+	hotness := "cold"
 	if age <= mn.softTTL {
-		mn.cacheWatcher.Inc(mn.name+"-hotness", "hot")
+		hotness = "hot"
 	} else if age <= mn.softTTL*2 {
-		mn.cacheWatcher.Inc(mn.name+"-hotness", "warm")
-	} else {
-		mn.cacheWatcher.Inc(mn.name+"-hotness", "cold")
+		hotness = "warm"
 	}
+	mn.cacheWatcher.Inc(mn.name+"-hotness", hotness)
+	mn.observeHotness(hotness)
 }
@@ -3,45 +3,58 @@ package mnemosyne
 import (
 	"bytes"
 	"compress/zlib"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"time"
 )
 
-type cachable struct {
+// Cachable is a value stored in a cache layer, along with the time it was set and the fingerprint of its type
+type Cachable struct {
 	Time         time.Time
 	CachedObject interface{}
+	Fingerprint  string `json:",omitempty"`
 }
 
 type cachableRet struct {
 	Time         time.Time
 	CachedObject *json.RawMessage
+	Fingerprint  string `json:",omitempty"`
 }
 
-func finalizeCacheResponse(rawBytes []byte, compress bool, refrence interface{}) (*cachable, error) {
+func finalizeCacheResponse(rawBytes []byte, compress bool, refrence interface{}) (*Cachable, error) {
 	var finalBytes []byte
 	if compress {
-		finalBytes = decompressZlib(rawBytes)
+		var err error
+		finalBytes, err = decompressZlib(rawBytes)
+		if err != nil {
+			return nil, newDecodeError(fmt.Errorf("failed to decompress cached value : %w", err))
+		}
 	} else {
 		finalBytes = rawBytes
 	}
 	var unMarshaledWithoutRefrence cachableRet
 	unmarshalErr := json.Unmarshal(finalBytes, &unMarshaledWithoutRefrence)
 	if unmarshalErr != nil {
-		return nil, fmt.Errorf("failed to unmarshall cached value : %w", unmarshalErr)
+		return nil, newDecodeError(fmt.Errorf("failed to unmarshall cached value : %w", unmarshalErr))
 	}
 
-	if refrence != nil {
+	if err := checkFingerprint(unMarshaledWithoutRefrence.Fingerprint, refrence); err != nil {
+		return nil, err
+	}
+	// a nil value is stored as null, which leaves the refrence untouched
+	if refrence != nil && unMarshaledWithoutRefrence.CachedObject != nil {
 		unmarshalErr = json.Unmarshal(*unMarshaledWithoutRefrence.CachedObject, refrence)
 		if unmarshalErr != nil {
-			return nil, fmt.Errorf("failed to unmarshall cached refrence value : %w", unmarshalErr)
+			return nil, newDecodeError(fmt.Errorf("failed to unmarshall cached refrence value : %w", unmarshalErr))
 		}
 	}
 
-	return &cachable{
+	return &Cachable{
 		Time:         unMarshaledWithoutRefrence.Time,
 		CachedObject: refrence,
+		Fingerprint:  unMarshaledWithoutRefrence.Fingerprint,
 	}, nil
 }
 
@@ -65,6 +78,35 @@ func prepareCachePayload(value interface{}, compress bool) (finalData []byte, pr
 	return
 }
 
+// packPayload serializes a Cachable into the bytes stored by the layer (compressed and encrypted if enabled)
+func (bc *baseCache) packPayload(ctx context.Context, key string, value *Cachable) ([]byte, error) {
+	if value == nil {
+		return nil, errNilValue
+	}
+	finalData, err := prepareCachePayload(value, bc.compressionEnabled)
+	if err == nil && bc.keyring != nil {
+		finalData, err = bc.keyring.seal(finalData, key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	bc.annotatePayload(ctx, len(finalData))
+	return finalData, nil
+}
+
+// unpackPayload is the reverse of packPayload
+func (bc *baseCache) unpackPayload(ctx context.Context, key string, rawBytes []byte, refrence interface{}) (*Cachable, error) {
+	bc.annotatePayload(ctx, len(rawBytes))
+	if bc.keyring != nil {
+		opened, err := bc.keyring.open(rawBytes, key)
+		if err != nil {
+			return nil, newDecodeError(err)
+		}
+		rawBytes = opened
+	}
+	return finalizeCacheResponse(rawBytes, bc.compressionEnabled, refrence)
+}
+
 func compressZlib(input []byte) []byte {
 	var buf bytes.Buffer
 	w := zlib.NewWriter(&buf)
@@ -74,11 +116,15 @@ func compressZlib(input []byte) []byte {
 	return compressed
 }
 
-func decompressZlib(input []byte) []byte {
+func decompressZlib(input []byte) ([]byte, error) {
 	var out bytes.Buffer
-	r, _ := zlib.NewReader(bytes.NewBuffer(input))
-	io.Copy(&out, r)
-	r.Close()
-	original := out.Bytes()
-	return original
+	r, err := zlib.NewReader(bytes.NewBuffer(input))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	if _, err := io.Copy(&out, r); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
 }
@@ -0,0 +1,113 @@
+package mnemosyne
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const sealedPayloadVersion byte = 1
+
+// keyring holds the AES-GCM keys of a layer by their IDs.
+// New payloads are always sealed with the primary key, but any key still present
+// in the ring can open a payload, so keys can be rotated without flushing the cache.
+type keyring struct {
+	primary string
+	aeads   map[string]cipher.AEAD
+	err     error
+}
+
+// newKeyring builds a keyring from base64 encoded AES keys (16, 24 or 32 bytes long)
+func newKeyring(primary string, keys map[string]string) (*keyring, error) {
+	primary = strings.ToLower(primary)
+	if len(keys) == 0 {
+		return nil, errors.New("encryption keyring is empty")
+	}
+	kr := &keyring{
+		primary: primary,
+		aeads:   make(map[string]cipher.AEAD, len(keys)),
+	}
+	for id, encodedKey := range keys {
+		id = strings.ToLower(id)
+		if len(id) == 0 || len(id) > 255 {
+			return nil, fmt.Errorf("invalid encryption key id %q", id)
+		}
+		rawKey, err := base64.StdEncoding.DecodeString(encodedKey)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %s is not valid base64: %w", id, err)
+		}
+		block, err := aes.NewCipher(rawKey)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %s: %w", id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %s: %w", id, err)
+		}
+		kr.aeads[id] = aead
+	}
+	if _, ok := kr.aeads[primary]; !ok {
+		return nil, fmt.Errorf("primary encryption key %q is not in the keyring", primary)
+	}
+	return kr, nil
+}
+
+// seal encrypts the payload with the primary key.
+// The result is laid out as: version | len(keyID) | keyID | nonce | ciphertext
+// and the cache key is used as additional data, so a payload can not be moved to another key.
+func (kr *keyring) seal(payload []byte, cacheKey string) ([]byte, error) {
+	if kr.err != nil {
+		return nil, kr.err
+	}
+	aead := kr.aeads[kr.primary]
+	header := make([]byte, 0, 2+len(kr.primary)+aead.NonceSize())
+	header = append(header, sealedPayloadVersion, byte(len(kr.primary)))
+	header = append(header, kr.primary...)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := append(header, nonce...)
+	return aead.Seal(sealed, nonce, payload, kr.additionalData(header, cacheKey)), nil
+}
+
+// open decrypts a payload sealed by any of the keys in the keyring
+func (kr *keyring) open(sealed []byte, cacheKey string) ([]byte, error) {
+	if kr.err != nil {
+		return nil, kr.err
+	}
+	if len(sealed) < 2 || sealed[0] != sealedPayloadVersion {
+		return nil, errors.New("payload is not encrypted")
+	}
+	idLen := int(sealed[1])
+	if len(sealed) < 2+idLen {
+		return nil, errors.New("encrypted payload is truncated")
+	}
+	keyID := string(sealed[2 : 2+idLen])
+	aead, ok := kr.aeads[keyID]
+	if !ok {
+		return nil, fmt.Errorf("payload is encrypted with unknown key %q", keyID)
+	}
+	header := sealed[:2+idLen]
+	rest := sealed[2+idLen:]
+	if len(rest) < aead.NonceSize() {
+		return nil, errors.New("encrypted payload is truncated")
+	}
+	nonce, ciphertext := rest[:aead.NonceSize()], rest[aead.NonceSize():]
+	payload, err := aead.Open(nil, nonce, ciphertext, kr.additionalData(header, cacheKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt payload with key %s: %w", keyID, err)
+	}
+	return payload, nil
+}
+
+func (kr *keyring) additionalData(header []byte, cacheKey string) []byte {
+	ad := make([]byte, 0, len(header)+len(cacheKey))
+	ad = append(ad, header...)
+	return append(ad, cacheKey...)
+}
@@ -0,0 +1,194 @@
+package mnemosyne
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Entry is a cached value along with the metadata of the lookup which found it
+type Entry struct {
+	// Value is the cached value (the refrence passed to GetEntry, filled)
+	Value interface{}
+	// Layer is the index of the layer which served the value
+	Layer int
+	// LayerName is the name of the layer which served the value
+	LayerName string
+	// Time is when the value was written into the cache
+	Time time.Time
+	// Age is the time passed since the value was written
+	Age time.Duration
+	// TTL is the remaining hard TTL of the value in the serving layer (zero if the layer can't tell)
+	TTL time.Duration
+	// Stale shows whether the soft-TTL of the value has passed
+	Stale bool
+	// Backfilled shows whether the upper layers were scheduled to be filled with the value
+	Backfilled bool
+}
+
+// GetEntry retrieves the value for key along with where it was found and how fresh it is
+func (mn *MnemosyneInstance) GetEntry(ctx context.Context, key string, refrence interface{}) (entry *Entry, err error) {
+	ctx, span := mn.startSpan(ctx, "GetEntry")
+	defer func() { endSpan(span, err, true) }()
+	defer mn.observeOperation("get", time.Now())
+	return mn.getEntry(ctx, key, refrence, true)
+}
+
+func (mn *MnemosyneInstance) getEntry(ctx context.Context, key string, refrence interface{}, withTTL bool) (*Entry, error) {
+	if err := mn.enter(); err != nil {
+		return nil, err
+	}
+	defer mn.leave()
+	cachableObj, layer, backfilled, err := mn.get(ctx, key, refrence)
+	if err != nil {
+		return nil, err
+	}
+	// a nil refrence only asks for the metadata, so there is no value to check
+	if cachableObj == nil || (refrence != nil && cachableObj.CachedObject == nil) {
+		mn.logger.Error("nil object found in cache", Fields{FieldInstance: mn.name, FieldKeyHash: keyHash(key)})
+		return nil, errors.New("nil found")
+	}
+
+	entry := mn.newEntry(cachableObj, layer, backfilled)
+	if withTTL {
+		entry.TTL = mn.cacheLayers[layer].TTL(ctx, key)
+	}
+	return entry, nil
+}
+
+func (mn *MnemosyneInstance) newEntry(cachableObj *Cachable, layer int, backfilled bool) *Entry {
+	dataAge := mn.clock.Now().Sub(cachableObj.Time)
+	mn.goBackground(func() { mn.monitorDataHotness(dataAge) })
+	return &Entry{
+		Value:      cachableObj.CachedObject,
+		Layer:      layer,
+		LayerName:  mn.cacheLayers[layer].Name(),
+		Time:       cachableObj.Time,
+		Age:        dataAge,
+		Stale:      dataAge > mn.softTTL,
+		Backfilled: backfilled,
+	}
+}
+
+// layerMultiGetter is implemented by the layers which read several keys at once (e.g. redis with MGET)
+type layerMultiGetter interface {
+	getMany(ctx context.Context, keys []string, refrences []interface{}) ([]*Cachable, []error)
+}
+
+// GetEntries retrieves the values of keys (decoded into refrences, which is aligned with keys) with a single lookup
+// per layer for the keys still missing, redis layers read the keys of each shard with one MGET.
+// entries[i] is nil when keys[i] missed, and errs[i] tells why. The TTL of the entries isn't filled
+func (mn *MnemosyneInstance) GetEntries(ctx context.Context, keys []string, refrences []interface{}) (entries []*Entry, errs []error) {
+	ctx, span := mn.startSpan(ctx, "GetEntries")
+	defer func() { endSpan(span, batchError(errs), false) }()
+	defer mn.observeOperation("get", time.Now())
+	entries = make([]*Entry, len(keys))
+	errs = make([]error, len(keys))
+	if len(refrences) != len(keys) {
+		err := fmt.Errorf("got %d refrences for %d keys", len(refrences), len(keys))
+		for i := range errs {
+			errs[i] = err
+		}
+		return entries, errs
+	}
+	if err := mn.enter(); err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+		return entries, errs
+	}
+	defer mn.leave()
+
+	cacheErrors := make([][]error, len(keys))
+	pending := make([]int, len(keys))
+	for i := range keys {
+		cacheErrors[i] = make([]error, len(mn.cacheLayers))
+		pending[i] = i
+	}
+	for layer := range mn.cacheLayers {
+		if len(pending) == 0 {
+			break
+		}
+		layerKeys := make([]string, len(pending))
+		layerRefrences := make([]interface{}, len(pending))
+		for j, i := range pending {
+			layerKeys[j], layerRefrences[j] = keys[i], refrences[i]
+		}
+		results, layerErrs := mn.layerGetMany(ctx, layer, layerKeys, layerRefrences)
+		var missed []int
+		for j, i := range pending {
+			if layerErrs[j] == nil {
+				entries[i], errs[i] = mn.batchHit(ctx, keys[i], refrences[i], results[j], layer)
+				continue
+			}
+			var mismatch *fingerprintMismatchError
+			if errors.As(layerErrs[j], &mismatch) {
+				mn.goBackground(func() { mn.cacheWatcher.Inc(mn.name, "fingerprint-mismatch") })
+			}
+			cacheErrors[i][layer] = &LayerError{Layer: mn.cacheLayers[layer].Name(), Index: layer, Op: "get", Err: layerErrs[j]}
+			missed = append(missed, i)
+		}
+		pending = missed
+	}
+	for _, i := range pending {
+		mn.goBackground(func() { mn.cacheWatcher.Inc(mn.name, "miss") })
+		mn.observeMiss()
+		errs[i] = &ErrCacheMiss{message: "Miss", Errors: cacheErrors[i]}
+	}
+	return entries, errs
+}
+
+// batchHit is the part of get and getEntry which follows a hit, for a key found by GetEntries
+func (mn *MnemosyneInstance) batchHit(ctx context.Context, key string, refrence interface{}, result *Cachable, layer int) (*Entry, error) {
+	mn.observeHit(layer)
+	backfilled := mn.scheduleFill(ctx, key, result, layer)
+	mn.goBackground(func() { mn.cacheWatcher.Inc(mn.name, fmt.Sprintf("layer%d", layer)) })
+	if result == nil || (refrence != nil && result.CachedObject == nil) {
+		mn.logger.Error("nil object found in cache", Fields{FieldInstance: mn.name, FieldKeyHash: keyHash(key)})
+		return nil, errors.New("nil found")
+	}
+	return mn.newEntry(result, layer, backfilled), nil
+}
+
+// layerGetMany looks keys up in a single layer, at once if the layer can
+func (mn *MnemosyneInstance) layerGetMany(ctx context.Context, layer int, keys []string, refrences []interface{}) ([]*Cachable, []error) {
+	// not unwrapped, so the decorators of the layer (e.g. chaos) still apply to every key
+	multiGetter, ok := mn.cacheLayers[layer].(layerMultiGetter)
+	if !ok {
+		results := make([]*Cachable, len(keys))
+		errs := make([]error, len(keys))
+		for i, key := range keys {
+			results[i], errs[i] = mn.layerGet(ctx, layer, key, refrences[i])
+		}
+		return results, errs
+	}
+	ctx, span := mn.startLayerSpan(ctx, layer, "mget")
+	start := time.Now()
+	results, errs := multiGetter.getMany(ctx, keys, refrences)
+	// the batch is observed as one operation, failing if any of its keys failed other than by missing
+	var batchErr error
+	for _, err := range errs {
+		if err != nil && !errors.Is(err, ErrMiss) {
+			batchErr = err
+			break
+		}
+	}
+	mn.observeLayerOperation(layer, "get", batchErr, start)
+	endSpan(span, batchErr, false)
+	return results, errs
+}
+
+// batchError aggregates the errors of a batch lookup which aren't misses, for its span
+func batchError(errs []error) error {
+	var failed []error
+	for _, err := range errs {
+		if err != nil && !errors.Is(err, ErrMiss) {
+			failed = append(failed, err)
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return &MultiError{Errors: failed}
+}
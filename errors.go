@@ -0,0 +1,164 @@
+package mnemosyne
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Sentinel errors which can be matched with errors.Is against any error returned by Mnemosyne
+var (
+	// ErrMiss is matched by every cache-miss, including the ones caused by amnesia or a schema change,
+	// but not when a layer failed to answer (see ErrCacheMiss)
+	ErrMiss = errors.New("cache miss")
+	// ErrLayerUnavailable is matched when a layer could not be reached or failed internally
+	ErrLayerUnavailable = errors.New("cache layer unavailable")
+	// ErrDecode is matched when a cached value exists but could not be decoded
+	ErrDecode = errors.New("failed to decode cached value")
+	// ErrAmnesia is matched when a layer ignored its data because of amnesia
+	ErrAmnesia = errors.New("cache layer had amnesia")
+	// ErrTimeout is matched when a layer operation ran out of time
+	ErrTimeout = errors.New("cache operation timed out")
+	// ErrClosed is returned by the operations of an instance after it's closed
+	ErrClosed = errors.New("cache instance is closed")
+)
+
+// errNilValue is returned by layers asked to set a nil *Cachable
+var errNilValue = errors.New("cannot set nil value in cache")
+
+// ErrCacheMiss is the Error returned when no layer could serve a value, because it missed or failed.
+// When returned from a MnemosyneInstance it holds the errors of every layer (as *LayerError) which
+// can be inspected with errors.Is and errors.As
+type ErrCacheMiss struct {
+	message string
+	Errors  []error
+}
+
+func (e *ErrCacheMiss) Error() string {
+	message := e.message
+	if message == "" {
+		message = "Miss"
+	}
+	if len(e.Errors) == 0 {
+		return message
+	}
+	return message + ": " + joinErrors(e.Errors)
+}
+
+// Is reports whether any of the layer errors matches target. It matches ErrMiss only when every layer missed
+// (or held a value which can't be decoded, which setting it again fixes), so an outage of a layer isn't taken
+// for a value to compute again
+func (e *ErrCacheMiss) Is(target error) bool {
+	if target == ErrMiss {
+		return allMisses(e.Errors)
+	}
+	return anyErrorIs(e.Errors, target)
+}
+
+// As finds the first layer error that matches target
+func (e *ErrCacheMiss) As(target interface{}) bool {
+	return anyErrorAs(e.Errors, target)
+}
+
+// MultiError is returned by operations which touch all layers (e.g. Set and Delete) when some of the layers fail
+type MultiError struct {
+	Errors []error
+}
+
+func (e *MultiError) Error() string {
+	return joinErrors(e.Errors)
+}
+
+// Is reports whether any of the errors matches target
+func (e *MultiError) Is(target error) bool {
+	return anyErrorIs(e.Errors, target)
+}
+
+// As finds the first error that matches target
+func (e *MultiError) As(target interface{}) bool {
+	return anyErrorAs(e.Errors, target)
+}
+
+// LayerError is the error of a single operation on a single cache layer
+type LayerError struct {
+	Layer string
+	Index int
+	Op    string
+	Err   error
+}
+
+func (e *LayerError) Error() string {
+	return fmt.Sprintf("%s on layer %d (%s): %v", e.Op, e.Index, e.Layer, e.Err)
+}
+
+func (e *LayerError) Unwrap() error {
+	return e.Err
+}
+
+// kindError attaches one of the sentinel errors to an underlying error
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string {
+	return fmt.Sprintf("%v: %v", e.kind, e.err)
+}
+
+func (e *kindError) Is(target error) bool {
+	return target == e.kind
+}
+
+func (e *kindError) Unwrap() error {
+	return e.err
+}
+
+func newDecodeError(err error) error {
+	return &kindError{kind: ErrDecode, err: err}
+}
+
+// newBackendError classifies an error returned by a layer's backend as a timeout or an unavailability
+func newBackendError(err error) error {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return &kindError{kind: ErrTimeout, err: err}
+	}
+	return &kindError{kind: ErrLayerUnavailable, err: err}
+}
+
+func joinErrors(errs []error) string {
+	errorStrings := make([]string, len(errs))
+	for i, err := range errs {
+		errorStrings[i] = err.Error()
+	}
+	return strings.Join(errorStrings, ";")
+}
+
+func anyErrorIs(errs []error, target error) bool {
+	for _, err := range errs {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func allMisses(errs []error) bool {
+	for _, err := range errs {
+		if err != nil && !errors.Is(err, ErrMiss) && !errors.Is(err, ErrDecode) {
+			return false
+		}
+	}
+	return true
+}
+
+func anyErrorAs(errs []error, target interface{}) bool {
+	for _, err := range errs {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,162 @@
+package mnemosyne
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// LayerExplanation is what a single layer holds for a key, as reported by Explain
+type LayerExplanation struct {
+	Index int
+	Name  string
+	// Present shows whether the layer has an entry for the key, even if it can't be decoded
+	Present bool
+	// Time is when the entry was written (zero if it couldn't be decoded)
+	Time time.Time
+	Age  time.Duration
+	// TTL is the remaining hard TTL of the entry (zero if the layer can't tell)
+	TTL time.Duration
+	// PayloadSize is the size of the stored payload in bytes (zero for values kept as-is)
+	PayloadSize int
+	Compressed  bool
+	Encrypted   bool
+	// KeyID is the id of the encryption key the payload is sealed with
+	KeyID       string
+	Fingerprint string
+	// Decoded shows whether the payload was decrypted, decompressed and unmarshalled successfully
+	Decoded     bool
+	DecodeError string
+	// Value is the JSON of the cached value, if it was decoded
+	Value json.RawMessage
+	// Shard and Replica are the ones chosen for reading the key by sharded layers (-1 and "" otherwise),
+	// Replica is either "master" or "slave-N"
+	Shard   int
+	Replica string
+	Address string
+	// Error is the error of the backend, if the layer couldn't be queried
+	Error string
+}
+
+// Explanation is every layer's view of a key, see MnemosyneInstance.Explain
+type Explanation struct {
+	Instance string
+	Key      string
+	Layers   []LayerExplanation
+	// ServedBy is the index of the layer a Get would have served the key from (-1 for a miss), ignoring amnesia
+	ServedBy int
+	// Stale shows whether the soft-TTL of the value which would have been served has passed
+	Stale bool
+}
+
+// layerExplainer is implemented by the layers which can describe their entry of a key for Explain
+type layerExplainer interface {
+	explain(ctx context.Context, key string) LayerExplanation
+}
+
+// Explain queries every layer for key, with amnesia off and without backfilling, and reports what each one holds.
+// It's meant for debugging (e.g. finding why a key returns stale data) rather than serving requests
+func (mn *MnemosyneInstance) Explain(ctx context.Context, key string) (*Explanation, error) {
+	if err := mn.enter(); err != nil {
+		return nil, err
+	}
+	defer mn.leave()
+	ctx, span := mn.startSpan(ctx, "Explain")
+	defer span.End()
+	explanation := &Explanation{
+		Instance: mn.name,
+		Key:      key,
+		Layers:   make([]LayerExplanation, len(mn.cacheLayers)),
+		ServedBy: -1,
+	}
+	for i := range mn.cacheLayers {
+		layerExplanation := mn.explainLayer(ctx, i, key)
+		if layerExplanation.Decoded && explanation.ServedBy == -1 {
+			explanation.ServedBy = i
+			explanation.Stale = layerExplanation.Age > mn.softTTL
+		}
+		explanation.Layers[i] = layerExplanation
+	}
+	if err := ctx.Err(); err != nil {
+		return explanation, err
+	}
+	return explanation, nil
+}
+
+func (mn *MnemosyneInstance) explainLayer(ctx context.Context, index int, key string) LayerExplanation {
+	layer := mn.cacheLayers[index]
+	var res LayerExplanation
+	if explainer, ok := unwrapLayer(layer).(layerExplainer); ok {
+		res = explainer.explain(ctx, key)
+	} else {
+		res = explainOpaqueLayer(ctx, layer, key)
+	}
+	res.Index = index
+	res.Name = layer.Name()
+	if res.Decoded {
+		res.Age = mn.clock.Now().Sub(res.Time)
+	}
+	return res
+}
+
+// explainOpaqueLayer describes the entry of a layer which doesn't implement layerExplainer through its Get,
+// so the value itself and the details of the payload are not reported (and amnesia may still apply)
+func explainOpaqueLayer(ctx context.Context, layer ICache, key string) LayerExplanation {
+	res := LayerExplanation{Shard: -1}
+	cachableObj, err := layer.Get(ctx, key, nil)
+	switch outcomeOf(err) {
+	case outcomeOK:
+		res.Present, res.Decoded = true, true
+		res.Time, res.Fingerprint = cachableObj.Time, cachableObj.Fingerprint
+		res.TTL = layer.TTL(ctx, key)
+	case outcomeMiss, outcomeAmnesia:
+	default:
+		res.Present = errors.Is(err, ErrDecode)
+		if res.Present {
+			res.DecodeError = err.Error()
+		} else {
+			res.Error = err.Error()
+		}
+	}
+	return res
+}
+
+// explainPayload fills the details of an encoded payload into res, decoding it step by step
+func (bc *baseCache) explainPayload(key string, rawBytes []byte, res *LayerExplanation) {
+	res.Present = true
+	res.PayloadSize = len(rawBytes)
+	res.Compressed = bc.compressionEnabled
+	if bc.keyring != nil {
+		res.Encrypted = true
+		if len(rawBytes) >= 2 && len(rawBytes) >= 2+int(rawBytes[1]) {
+			res.KeyID = string(rawBytes[2 : 2+int(rawBytes[1])])
+		}
+		opened, err := bc.keyring.open(rawBytes, key)
+		if err != nil {
+			res.DecodeError = err.Error()
+			return
+		}
+		rawBytes = opened
+	}
+	if bc.compressionEnabled {
+		decompressed, err := decompressZlib(rawBytes)
+		if err != nil {
+			res.DecodeError = fmt.Sprintf("failed to decompress cached value : %v", err)
+			return
+		}
+		rawBytes = decompressed
+	}
+	var decoded cachableRet
+	if err := json.Unmarshal(rawBytes, &decoded); err != nil {
+		res.DecodeError = fmt.Sprintf("failed to unmarshall cached value : %v", err)
+		return
+	}
+	res.Decoded = true
+	res.Time = decoded.Time
+	res.Fingerprint = decoded.Fingerprint
+	if decoded.CachedObject != nil {
+		res.Value = *decoded.CachedObject
+	}
+}
@@ -0,0 +1,125 @@
+package mnemosyne
+
+import (
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// SchemaVersioner can be implemented by cached types to use an explicit version string
+// as their schema fingerprint instead of the one derived from the type's structure.
+type SchemaVersioner interface {
+	SchemaVersion() string
+}
+
+type fingerprintMismatchError struct {
+	Stored   string
+	Expected string
+}
+
+func (e *fingerprintMismatchError) Error() string {
+	return fmt.Sprintf("Schema fingerprint mismatch (stored:%s expected:%s)", e.Stored, e.Expected)
+}
+
+// Is makes a fingerprint mismatch match ErrMiss
+func (e *fingerprintMismatchError) Is(target error) bool {
+	return target == ErrMiss
+}
+
+var (
+	fingerprintCache    sync.Map
+	jsonMarshalerType   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	schemaVersionerType = reflect.TypeOf((*SchemaVersioner)(nil)).Elem()
+)
+
+// typeFingerprint returns the schema fingerprint of the (dereferenced) type of value
+func typeFingerprint(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	t := reflect.TypeOf(value)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if cached, ok := fingerprintCache.Load(t); ok {
+		return cached.(string)
+	}
+	var fingerprint string
+	if reflect.PtrTo(t).Implements(schemaVersionerType) {
+		fingerprint = "v:" + reflect.New(t).Interface().(SchemaVersioner).SchemaVersion()
+	} else {
+		var sb strings.Builder
+		describeType(&sb, t, map[reflect.Type]bool{})
+		sum := sha256.Sum256([]byte(sb.String()))
+		fingerprint = "t:" + hex.EncodeToString(sum[:8])
+	}
+	fingerprintCache.Store(t, fingerprint)
+	return fingerprint
+}
+
+// checkFingerprint verifies the stored fingerprint of an entry against the refrence it's being decoded into.
+// Entries stored without a fingerprint are always accepted.
+func checkFingerprint(stored string, refrence interface{}) error {
+	if stored == "" || refrence == nil {
+		return nil
+	}
+	if expected := typeFingerprint(refrence); expected != stored {
+		return &fingerprintMismatchError{Stored: stored, Expected: expected}
+	}
+	return nil
+}
+
+// describeType writes the parts of a type's structure which affect its JSON encoding
+func describeType(sb *strings.Builder, t reflect.Type, seen map[reflect.Type]bool) {
+	if t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType) ||
+		reflect.PtrTo(t).Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType) {
+		sb.WriteString(t.String())
+		return
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		sb.WriteString("*")
+		describeType(sb, t.Elem(), seen)
+	case reflect.Slice:
+		sb.WriteString("[]")
+		describeType(sb, t.Elem(), seen)
+	case reflect.Array:
+		fmt.Fprintf(sb, "[%d]", t.Len())
+		describeType(sb, t.Elem(), seen)
+	case reflect.Map:
+		sb.WriteString("map[")
+		describeType(sb, t.Key(), seen)
+		sb.WriteString("]")
+		describeType(sb, t.Elem(), seen)
+	case reflect.Struct:
+		if seen[t] {
+			sb.WriteString(t.String())
+			return
+		}
+		seen[t] = true
+		sb.WriteString("struct{")
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" && !field.Anonymous {
+				continue
+			}
+			tag := field.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			fmt.Fprintf(sb, "%s %q ", field.Name, tag)
+			describeType(sb, field.Type, seen)
+			sb.WriteString(";")
+		}
+		sb.WriteString("}")
+		delete(seen, t)
+	default:
+		sb.WriteString(t.Kind().String())
+	}
+}
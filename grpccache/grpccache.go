@@ -0,0 +1,299 @@
+// Package grpccache caches the responses of unary gRPC methods in a mnemosyne instance. It's kept apart from
+// mnemosyne so the programs which don't import it don't link gRPC
+package grpccache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mghayour/mnemosyne"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+const (
+	// MetadataCacheControl is the request metadata a caller skips the cache for a single call with,
+	// its value being Bypass or Refresh
+	MetadataCacheControl = "x-mnemosyne-cache"
+	// MetadataXCache is the header metadata the server interceptor tells whether a response was served from
+	// the cache with, like mnemosyne.HeaderXCache
+	MetadataXCache = "x-cache"
+)
+
+const (
+	// Bypass neither reads the response from the cache nor stores it
+	Bypass = "bypass"
+	// Refresh skips reading the response from the cache, but stores the new response
+	Refresh = "refresh"
+)
+
+// MethodOptions controls how the responses of a single method are cached
+type MethodOptions struct {
+	// SoftTTL is how long a response is fresh, after which it is served while being refreshed in the background
+	// (default: the soft-ttl of the instance)
+	SoftTTL time.Duration
+	// TTL is how long a response is served at all, after which calls wait for a new one. It can't outlive
+	// the ttl of the layers (default: until the layers expire it)
+	TTL time.Duration
+	// VaryMetadata are the request metadata which are part of the key, e.g. "authorization" for a method whose
+	// responses depend on the caller. Otherwise every caller is served the same response for the same request,
+	// so methods scoped to a user must either vary on the metadata telling the user or not be cached at all
+	VaryMetadata []string
+}
+
+// state tells whether the response found in entry is stale, or expired altogether
+func (options MethodOptions) state(entry *mnemosyne.Entry) (stale, expired bool) {
+	if options.TTL > 0 && entry.Age > options.TTL {
+		return true, true
+	}
+	if options.SoftTTL > 0 {
+		return entry.Age > options.SoftTTL, false
+	}
+	return entry.Stale, false
+}
+
+// vary picks the metadata the method varies on out of md
+func (options MethodOptions) vary(md metadata.MD) metadata.MD {
+	if len(options.VaryMetadata) == 0 {
+		return nil
+	}
+	vary := metadata.MD{}
+	for _, name := range options.VaryMetadata {
+		if values := md.Get(name); len(values) > 0 {
+			vary.Set(name, values...)
+		}
+	}
+	return vary
+}
+
+// Options controls how the interceptors cache responses
+type Options struct {
+	// Methods are the methods whose responses are cached, by their full names like "/package.Service/Method"
+	Methods map[string]MethodOptions
+	// RefreshTimeout bounds refreshing a stale response in the background (default: 30s)
+	RefreshTimeout time.Duration
+}
+
+// CachedMessage is a response message as stored in the cache
+type CachedMessage struct {
+	// Type is the full name of the message, so the server can create it again
+	Type    string
+	Payload []byte
+}
+
+// message creates the cached message again, its type must be linked into the binary
+func (cached *CachedMessage) message() (proto.Message, error) {
+	messageType, err := protoregistry.GlobalTypes.FindMessageByName(protoreflect.FullName(cached.Type))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", mnemosyne.ErrDecode, err)
+	}
+	message := messageType.New().Interface()
+	if err := proto.Unmarshal(cached.Payload, message); err != nil {
+		return nil, fmt.Errorf("%w: %v", mnemosyne.ErrDecode, err)
+	}
+	return message, nil
+}
+
+type cache struct {
+	instance    mnemosyne.ICacheInstance
+	integration mnemosyne.Integration
+	options     Options
+	refreshes   sync.Map
+}
+
+func newCache(instance mnemosyne.ICacheInstance, options Options) *cache {
+	if options.RefreshTimeout <= 0 {
+		options.RefreshTimeout = 30 * time.Second
+	}
+	return &cache{instance: instance, integration: mnemosyne.IntegrationOf(instance), options: options}
+}
+
+// Key returns the key the response of method for req is cached under, e.g. to Delete it. vary holds the values
+// of the VaryMetadata of the method (nil if it has none). The request is hashed in its deterministic
+// serialization, which is stable for a given build of the messages
+func Key(method string, req proto.Message, vary metadata.MD) (string, error) {
+	serialized, err := proto.MarshalOptions{Deterministic: true}.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(serialized)
+	parts := []string{"grpc", method, "#" + hex.EncodeToString(sum[:16])}
+	names := make([]string, 0, len(vary))
+	for name := range vary {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		parts = append(parts, name+"="+strings.Join(vary[name], ","))
+	}
+	return mnemosyne.MakeKey(parts...), nil
+}
+
+// UnaryServerInterceptor caches the responses of the unary methods configured in options. Stale responses
+// are served while the handler is called again in the background, with the metadata of the stale call but
+// not its peer or deadline. Errors are never cached
+func UnaryServerInterceptor(instance mnemosyne.ICacheInstance, options Options) grpc.UnaryServerInterceptor {
+	c := newCache(instance, options)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		methodOptions, ok := c.options.Methods[info.FullMethod]
+		request, isMessage := req.(proto.Message)
+		if !ok || !isMessage {
+			return handler(ctx, req)
+		}
+		md, _ := metadata.FromIncomingContext(ctx)
+		control := cacheControlOf(md)
+		key, err := Key(info.FullMethod, request, methodOptions.vary(md))
+		if control == Bypass || err != nil {
+			grpc.SetHeader(ctx, metadata.Pairs(MetadataXCache, "BYPASS"))
+			return handler(ctx, req)
+		}
+		if control != Refresh {
+			if cached, entry, stale := c.lookup(ctx, key, methodOptions); cached != nil {
+				if res, err := cached.message(); err == nil {
+					state := "HIT"
+					if stale {
+						state = "STALE"
+						request := proto.Clone(request)
+						c.refresh(ctx, key, func(ctx context.Context) (interface{}, error) {
+							return handler(metadata.NewIncomingContext(ctx, md), request)
+						})
+					}
+					grpc.SetHeader(ctx, metadata.Pairs(MetadataXCache, state+" from "+entry.LayerName))
+					return res, nil
+				}
+			}
+		}
+		grpc.SetHeader(ctx, metadata.Pairs(MetadataXCache, "MISS"))
+		res, err := handler(ctx, req)
+		if err == nil {
+			c.store(ctx, key, res)
+		}
+		return res, err
+	}
+}
+
+// UnaryClientInterceptor caches the responses of the unary methods configured in options, so cached calls
+// never reach the server. Stale responses are served while the call is made again in the background, with
+// the metadata and call options of the stale call except those writing back to the caller (like grpc.Header)
+func UnaryClientInterceptor(instance mnemosyne.ICacheInstance, options Options) grpc.UnaryClientInterceptor {
+	c := newCache(instance, options)
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		methodOptions, ok := c.options.Methods[method]
+		request, isRequest := req.(proto.Message)
+		response, isResponse := reply.(proto.Message)
+		if !ok || !isRequest || !isResponse {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		md, _ := metadata.FromOutgoingContext(ctx)
+		control := cacheControlOf(md)
+		key, err := Key(method, request, methodOptions.vary(md))
+		if control == Bypass || err != nil {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		if control != Refresh {
+			if cached, _, stale := c.lookup(ctx, key, methodOptions); cached != nil && cached.Type == string(proto.MessageName(response)) {
+				if err := proto.Unmarshal(cached.Payload, response); err == nil {
+					if stale {
+						request := proto.Clone(request)
+						callOptions := backgroundCallOptions(opts)
+						c.refresh(ctx, key, func(ctx context.Context) (interface{}, error) {
+							fresh := response.ProtoReflect().New().Interface()
+							err := invoker(metadata.NewOutgoingContext(ctx, md), method, request, fresh, cc, callOptions...)
+							return fresh, err
+						})
+					}
+					return nil
+				}
+			}
+		}
+		if err := invoker(ctx, method, req, reply, cc, opts...); err != nil {
+			return err
+		}
+		c.store(ctx, key, response)
+		return nil
+	}
+}
+
+func cacheControlOf(md metadata.MD) string {
+	if values := md.Get(MetadataCacheControl); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// backgroundCallOptions drops the call options which write into the caller's variables
+func backgroundCallOptions(opts []grpc.CallOption) []grpc.CallOption {
+	kept := make([]grpc.CallOption, 0, len(opts))
+	for _, opt := range opts {
+		switch opt.(type) {
+		case grpc.HeaderCallOption, grpc.TrailerCallOption, grpc.PeerCallOption:
+			continue
+		}
+		kept = append(kept, opt)
+	}
+	return kept
+}
+
+// lookup returns the response cached under key (if it isn't expired), the entry holding it and whether it is stale
+func (c *cache) lookup(ctx context.Context, key string, options MethodOptions) (*CachedMessage, *mnemosyne.Entry, bool) {
+	entry, err := c.instance.GetEntry(ctx, key, &CachedMessage{})
+	if err != nil {
+		return nil, nil, false
+	}
+	cached, ok := entry.Value.(*CachedMessage)
+	if !ok {
+		return nil, nil, false
+	}
+	stale, expired := options.state(entry)
+	if expired {
+		return nil, nil, false
+	}
+	return cached, entry, stale
+}
+
+// refresh calls the method again for a stale response in the background, unless a refresh of key is in flight.
+// A panic of the call is logged, as there is no server to recover it
+func (c *cache) refresh(origin context.Context, key string, call func(ctx context.Context) (interface{}, error)) {
+	if _, inFlight := c.refreshes.LoadOrStore(key, struct{}{}); inFlight {
+		return
+	}
+	started := c.integration.Go(origin, "refresh", c.options.RefreshTimeout, func(ctx context.Context) {
+		defer c.refreshes.Delete(key)
+		defer func() {
+			if r := recover(); r != nil {
+				c.integration.LogError("failed to refresh a response", key, fmt.Errorf("panic in refresh: %v", r))
+			}
+		}()
+		res, err := call(ctx)
+		if err == nil {
+			c.store(ctx, key, res)
+		}
+	})
+	if !started {
+		c.refreshes.Delete(key)
+	}
+}
+
+// store caches a response message
+func (c *cache) store(ctx context.Context, key string, res interface{}) {
+	message, ok := res.(proto.Message)
+	if !ok {
+		return
+	}
+	payload, err := proto.Marshal(message)
+	if err == nil {
+		err = c.instance.Set(ctx, key, &CachedMessage{Type: string(proto.MessageName(message)), Payload: payload})
+	}
+	if err != nil {
+		c.integration.LogError("failed to cache a response", key, err)
+	}
+}
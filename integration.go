@@ -0,0 +1,80 @@
+package mnemosyne
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// IBatchCacheInstance is a cache instance which also reads many keys at once, like MnemosyneInstance
+type IBatchCacheInstance interface {
+	ICacheInstance
+	GetEntries(ctx context.Context, keys []string, refrences []interface{}) ([]*Entry, []error)
+}
+
+var _ IBatchCacheInstance = (*MnemosyneInstance)(nil)
+
+// Integration is what the integrations of an instance with a framework (like the batch loader, the middleware
+// or the transport) need of it besides its cache operations. Instances other than MnemosyneInstance
+// (e.g. mnemosynetest.Fake) get defaults: their background work isn't waited for by Close, their background
+// spans come from the global tracer provider and their errors go to the default logger
+type Integration struct {
+	name                string
+	logger              Logger
+	clock               Clock
+	goBackground        func(f func()) bool
+	startBackgroundSpan func(origin context.Context, op string) (context.Context, trace.Span)
+}
+
+// IntegrationOf returns the Integration of instance
+func IntegrationOf(instance ICacheInstance) Integration {
+	if mn, ok := instance.(*MnemosyneInstance); ok {
+		return Integration{
+			name:                mn.name,
+			logger:              mn.logger,
+			clock:               mn.clock,
+			goBackground:        mn.goBackground,
+			startBackgroundSpan: mn.startBackgroundSpan,
+		}
+	}
+	tracer := newTracer(nil)
+	return Integration{
+		logger: defaultLogger,
+		clock:  systemClock{},
+		goBackground: func(f func()) bool {
+			go f()
+			return true
+		},
+		startBackgroundSpan: func(origin context.Context, op string) (context.Context, trace.Span) {
+			return tracer.Start(context.Background(), "mnemosyne."+op, trace.WithLinks(trace.LinkFromContext(origin)))
+		},
+	}
+}
+
+// Now returns the time by the clock of the instance
+func (in Integration) Now() time.Time {
+	return in.clock.Now()
+}
+
+// Go runs f in the background on behalf of the request of origin, e.g. to refresh a stale value. The context of f
+// isn't canceled with origin, is bounded by timeout and has a span named op linked to the span of origin.
+// It reports whether f was started, which it isn't once the instance is closed
+func (in Integration) Go(origin context.Context, op string, timeout time.Duration, f func(ctx context.Context)) bool {
+	return in.goBackground(func() {
+		ctx, span := in.startBackgroundSpan(origin, op)
+		defer span.End()
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		f(ctx)
+	})
+}
+
+// LogError logs failing to cache the value of key
+func (in Integration) LogError(msg string, key string, err error) {
+	in.logger.Error(msg, Fields{
+		FieldInstance: in.name,
+		FieldKeyHash:  keyHash(key),
+		FieldError:    err,
+	})
+}
@@ -0,0 +1,188 @@
+package mnemosyne
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Layer gives direct access to a single layer of an instance, bypassing the others.
+// It's meant for tooling (e.g. the mnemosyne command), services should use the instance itself
+type Layer struct {
+	instance *MnemosyneInstance
+	index    int
+}
+
+// layerScanner is implemented by the layers which can list their keys,
+// remote layers may use the pattern to filter keys on the server but must still check them with match
+type layerScanner interface {
+	scan(ctx context.Context, pattern string, match func(string) bool, limit int) ([]string, error)
+}
+
+// LayerNames returns the names of the layers of the instance, in order of precedence
+func (mn *MnemosyneInstance) LayerNames() []string {
+	names := make([]string, len(mn.cacheLayers))
+	for i, layer := range mn.cacheLayers {
+		names[i] = layer.Name()
+	}
+	return names
+}
+
+// Layer returns a single layer of the instance selected by name
+func (mn *MnemosyneInstance) Layer(name string) (*Layer, error) {
+	for i, layer := range mn.cacheLayers {
+		if layer.Name() == name {
+			return &Layer{instance: mn, index: i}, nil
+		}
+	}
+	return nil, fmt.Errorf("Layer Named: %v Not Found", name)
+}
+
+// Name returns the name of the layer
+func (l *Layer) Name() string {
+	return l.instance.cacheLayers[l.index].Name()
+}
+
+// Cache returns the ICache behind the layer. Operations on it bypass the instance,
+// so they're neither observed (metrics, tracing and statistics) nor stopped by Close
+func (l *Layer) Cache() ICache {
+	return l.instance.cacheLayers[l.index]
+}
+
+// Explain reports what the layer holds for key, see MnemosyneInstance.Explain
+func (l *Layer) Explain(ctx context.Context, key string) LayerExplanation {
+	return l.instance.explainLayer(ctx, l.index, key)
+}
+
+// Set writes a value into the layer alone. The value is stored without a type fingerprint,
+// so it's accepted by any refrence (e.g. a json.RawMessage written by an operator)
+func (l *Layer) Set(ctx context.Context, key string, value interface{}) error {
+	if err := l.instance.enter(); err != nil {
+		return err
+	}
+	defer l.instance.leave()
+	return l.instance.layerSet(ctx, l.index, key, &Cachable{Time: l.instance.clock.Now(), CachedObject: value})
+}
+
+// Delete removes key from the layer alone
+func (l *Layer) Delete(ctx context.Context, key string) error {
+	if err := l.instance.enter(); err != nil {
+		return err
+	}
+	defer l.instance.leave()
+	return l.instance.layerDelete(ctx, l.index, key)
+}
+
+// TTL returns the remaining TTL of key in the layer (zero if the layer can't tell)
+func (l *Layer) TTL(ctx context.Context, key string) time.Duration {
+	return l.instance.cacheLayers[l.index].TTL(ctx, key)
+}
+
+// Flush completly clears the layer
+func (l *Layer) Flush() error {
+	if err := l.instance.enter(); err != nil {
+		return err
+	}
+	defer l.instance.leave()
+	return l.instance.cacheLayers[l.index].Clear()
+}
+
+// Scan returns up to limit keys of the layer matching a glob pattern (* and ? wildcards), zero means no limit.
+// Keys are listed in no particular order, and scanning a large layer is slow
+func (l *Layer) Scan(ctx context.Context, pattern string, limit int) ([]string, error) {
+	if err := l.instance.enter(); err != nil {
+		return nil, err
+	}
+	defer l.instance.leave()
+	layer := l.instance.cacheLayers[l.index]
+	scanner, ok := unwrapLayer(layer).(layerScanner)
+	if !ok {
+		return nil, fmt.Errorf("Layer Named: %v doesn't support scanning", layer.Name())
+	}
+	matcher, err := globMatcher(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return scanner.scan(ctx, pattern, matcher.MatchString, limit)
+}
+
+// globMatcher compiles a glob pattern into a regexp matching the same keys redis' SCAN MATCH does: * and ?
+// wildcards, [...] classes (negated with ^, holding ranges like a-z) and \ escaping the next character
+func globMatcher(pattern string) (*regexp.Regexp, error) {
+	runes := []rune(pattern)
+	var sb strings.Builder
+	sb.WriteString("(?s)^")
+	for i := 0; i < len(runes); i++ {
+		switch runes[i] {
+		case '*':
+			sb.WriteString(".*")
+		case '?':
+			sb.WriteString(".")
+		case '[':
+			i = globClass(runes, i+1, &sb)
+		case '\\':
+			// a trailing backslash matches itself
+			if i+1 < len(runes) {
+				i++
+			}
+			sb.WriteString(regexp.QuoteMeta(string(runes[i])))
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(runes[i])))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}
+
+// globClass writes the class whose body starts at runes[start] and returns the index of its closing bracket.
+// As in redis, an unclosed class runs to the end of the pattern and a range's end may be the closing bracket
+func globClass(runes []rune, start int, sb *strings.Builder) int {
+	i := start
+	negated := i < len(runes) && runes[i] == '^'
+	if negated {
+		i++
+	}
+	var items strings.Builder
+	for ; i < len(runes) && runes[i] != ']'; i++ {
+		switch {
+		case runes[i] == '\\' && i+1 < len(runes):
+			i++
+			items.WriteString(globClassLiteral(runes[i]))
+		case i+2 < len(runes) && runes[i+1] == '-':
+			low, high := runes[i], runes[i+2]
+			if low > high {
+				low, high = high, low
+			}
+			items.WriteString(globClassLiteral(low) + "-" + globClassLiteral(high))
+			i += 2
+		default:
+			items.WriteString(globClassLiteral(runes[i]))
+		}
+	}
+	switch {
+	case items.Len() == 0 && negated:
+		sb.WriteString(".")
+	case items.Len() == 0:
+		// an empty class matches nothing
+		sb.WriteString(`[^\x00-\x{10FFFF}]`)
+	case negated:
+		sb.WriteString("[^" + items.String() + "]")
+	default:
+		sb.WriteString("[" + items.String() + "]")
+	}
+	return i
+}
+
+func globClassLiteral(r rune) string {
+	if strings.ContainsRune(`\[]^-`, r) {
+		return `\` + string(r)
+	}
+	return string(r)
+}
+
+// scanLimitReached tells whether a scan has collected enough keys
+func scanLimitReached(keys []string, limit int) bool {
+	return limit > 0 && len(keys) >= limit
+}
@@ -0,0 +1,121 @@
+package mnemosyne
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// layerCloser is implemented by the layers which hold connections or background goroutines
+type layerCloser interface {
+	close() error
+}
+
+// lifecycleClosed marks the state of a closed lifecycle, the bits below it count the operations in flight
+const lifecycleClosed = 1 << 62
+
+// lifecycle tracks the operations and background work of an instance, so it can be drained on Close.
+// Its state is only changed by atomic adds on the hot path
+type lifecycle struct {
+	state     int64
+	drainOnce sync.Once
+	// drained is closed once the instance is closed and its operations and background work are done
+	drained chan struct{}
+}
+
+// enter starts tracking an operation, unless the instance is closed. Every successful enter must be
+// paired with a leave
+func (mn *MnemosyneInstance) enter() error {
+	if atomic.AddInt64(&mn.lifecycle.state, 1)&lifecycleClosed != 0 {
+		mn.leave()
+		return ErrClosed
+	}
+	return nil
+}
+
+// leave ends an operation started by enter, the last one to leave a closed instance drains it
+func (mn *MnemosyneInstance) leave() {
+	lc := &mn.lifecycle
+	if atomic.AddInt64(&lc.state, -1) == lifecycleClosed {
+		lc.drainOnce.Do(func() { close(lc.drained) })
+	}
+}
+
+// goBackground runs f in a tracked goroutine, unless the instance is closed, and reports whether it did
+func (mn *MnemosyneInstance) goBackground(f func()) bool {
+	if mn.enter() != nil {
+		return false
+	}
+	go func() {
+		defer mn.leave()
+		f()
+	}()
+	return true
+}
+
+// Close stops the instance: it waits for the operations, background fills and writes in flight until ctx is done,
+// then stops the janitors of the layers and closes their connections (the idle connection reaper of
+// the redis client exits on its next tick though).
+// Operations on the instance return ErrClosed afterwards, closing it again does nothing
+func (mn *MnemosyneInstance) Close(ctx context.Context) error {
+	lc := &mn.lifecycle
+	for {
+		state := atomic.LoadInt64(&lc.state)
+		if state&lifecycleClosed != 0 {
+			return nil
+		}
+		if atomic.CompareAndSwapInt64(&lc.state, state, state|lifecycleClosed) {
+			if state == 0 {
+				lc.drainOnce.Do(func() { close(lc.drained) })
+			}
+			break
+		}
+	}
+
+	var errs []error
+	select {
+	case <-lc.drained:
+	default:
+		select {
+		case <-lc.drained:
+		case <-ctx.Done():
+			// the layers are closed anyway, so the remaining operations and background work fail fast
+			errs = append(errs, ctx.Err())
+		}
+	}
+	if err := mn.background.close(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	for i, layer := range mn.cacheLayers {
+		if closer, ok := unwrapLayer(layer).(layerCloser); ok {
+			if err := closer.close(); err != nil {
+				errs = append(errs, &LayerError{Layer: layer.Name(), Index: i, Op: "close", Err: err})
+			}
+		}
+	}
+	return closeError(errs)
+}
+
+// Close closes all cache instances, see MnemosyneInstance.Close
+func (m *Mnemosyne) Close(ctx context.Context) error {
+	var errs []error
+	for _, name := range m.Instances() {
+		if err := m.childs[name].Close(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if m.collector != nil {
+		m.registerer.Unregister(m.collector)
+	}
+	return closeError(errs)
+}
+
+func closeError(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	return &MultiError{Errors: errs}
+}
@@ -0,0 +1,206 @@
+package mnemosyne
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// BatchFetch loads the values of the keys which missed the cache, values and errs are aligned with keys.
+// errs may be nil, or hold a single error to fail all of the keys
+type BatchFetch[T any] func(ctx context.Context, keys []string) (values []T, errs []error)
+
+// BatchLoaderOptions controls how a BatchLoader collects keys
+type BatchLoaderOptions struct {
+	// Wait is how long a batch collects keys after its first Load (default: 2ms)
+	Wait time.Duration
+	// MaxBatch is the number of keys after which a batch is dispatched without waiting (default: 100)
+	MaxBatch int
+	// Timeout bounds the lookup, fetch and writes of a batch, which don't stop when the callers give up (default: 5s)
+	Timeout time.Duration
+}
+
+// BatchLoader collects the keys loaded one by one within a short window (e.g. by GraphQL resolvers),
+// looks them all up in the cache at once, and fetches the ones which missed (or whose lookup failed) with a single call
+type BatchLoader[T any] struct {
+	instance    IBatchCacheInstance
+	integration Integration
+	typed       *TypedInstance[T]
+	fetch       BatchFetch[T]
+	options     BatchLoaderOptions
+
+	mu    sync.Mutex
+	batch *loaderBatch[T]
+}
+
+type loaderBatch[T any] struct {
+	origin  context.Context
+	keys    []string
+	index   map[string]int
+	results []T
+	errs    []error
+	done    chan struct{}
+}
+
+// NewBatchLoader creates a loader of values of type T, the values fetched are set in all the layers of instance
+func NewBatchLoader[T any](instance IBatchCacheInstance, fetch BatchFetch[T], options BatchLoaderOptions) *BatchLoader[T] {
+	if options.Wait <= 0 {
+		options.Wait = 2 * time.Millisecond
+	}
+	if options.MaxBatch <= 0 {
+		options.MaxBatch = 100
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = 5 * time.Second
+	}
+	return &BatchLoader[T]{
+		instance:    instance,
+		integration: IntegrationOf(instance),
+		typed:       Typed[T](instance),
+		fetch:       fetch,
+		options:     options,
+	}
+}
+
+// Load returns the value of key, from the cache or from the fetch of the batch it joined
+func (l *BatchLoader[T]) Load(ctx context.Context, key string) (T, error) {
+	batch, i := l.enqueue(ctx, key)
+	return batch.wait(ctx, i)
+}
+
+// LoadMany returns the values of keys, values and errs are aligned with keys
+func (l *BatchLoader[T]) LoadMany(ctx context.Context, keys []string) ([]T, []error) {
+	batches := make([]*loaderBatch[T], len(keys))
+	indexes := make([]int, len(keys))
+	for i, key := range keys {
+		batches[i], indexes[i] = l.enqueue(ctx, key)
+	}
+	values := make([]T, len(keys))
+	errs := make([]error, len(keys))
+	for i := range keys {
+		values[i], errs[i] = batches[i].wait(ctx, indexes[i])
+	}
+	return values, errs
+}
+
+// enqueue adds key to the pending batch (starting one if there is none), and returns its index in the batch
+func (l *BatchLoader[T]) enqueue(ctx context.Context, key string) (*loaderBatch[T], int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.batch == nil {
+		batch := &loaderBatch[T]{origin: ctx, index: make(map[string]int), done: make(chan struct{})}
+		l.batch = batch
+		time.AfterFunc(l.options.Wait, func() { l.dispatch(batch) })
+	}
+	batch := l.batch
+	i, ok := batch.index[key]
+	if !ok {
+		i = len(batch.keys)
+		batch.index[key] = i
+		batch.keys = append(batch.keys, key)
+	}
+	if len(batch.keys) >= l.options.MaxBatch {
+		l.batch = nil
+		go l.run(batch)
+	}
+	return batch, i
+}
+
+// dispatch runs batch once its window is over, unless it was already run for being full
+func (l *BatchLoader[T]) dispatch(batch *loaderBatch[T]) {
+	l.mu.Lock()
+	if l.batch != batch {
+		l.mu.Unlock()
+		return
+	}
+	l.batch = nil
+	l.mu.Unlock()
+	l.run(batch)
+}
+
+func (l *BatchLoader[T]) run(batch *loaderBatch[T]) {
+	defer close(batch.done)
+	ctx, span := l.integration.startBackgroundSpan(batch.origin, "batchLoad")
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, l.options.Timeout)
+	defer cancel()
+
+	batch.results = make([]T, len(batch.keys))
+	batch.errs = make([]error, len(batch.keys))
+	refrences := make([]interface{}, len(batch.keys))
+	for i := range refrences {
+		refrences[i] = l.typed.newRefrence()
+	}
+	entries, errs := l.instance.GetEntries(ctx, batch.keys, refrences)
+	var missed []int
+	for i, entry := range entries {
+		switch {
+		case entry != nil:
+			batch.results[i], batch.errs[i] = l.typed.value(entry.Value)
+		case errors.Is(errs[i], ErrMiss):
+			missed = append(missed, i)
+		default:
+			// a failing layer shouldn't fail the load, the value is fetched as if it missed
+			l.integration.LogError("failed to look a batch loaded value up", batch.keys[i], errs[i])
+			missed = append(missed, i)
+		}
+	}
+	if len(missed) == 0 {
+		return
+	}
+
+	keys := make([]string, len(missed))
+	for j, i := range missed {
+		keys[j] = batch.keys[i]
+	}
+	values, fetchErrs := l.safeFetch(ctx, keys)
+	for j, i := range missed {
+		switch {
+		case len(fetchErrs) == 1 && len(keys) > 1:
+			batch.errs[i] = fetchErrs[0]
+		case len(fetchErrs) != 0 && len(fetchErrs) != len(keys):
+			batch.errs[i] = fmt.Errorf("batch fetch returned %d errors for %d keys", len(fetchErrs), len(keys))
+		case len(fetchErrs) != 0 && fetchErrs[j] != nil:
+			batch.errs[i] = fetchErrs[j]
+		case len(values) != len(keys):
+			batch.errs[i] = fmt.Errorf("batch fetch returned %d values for %d keys", len(values), len(keys))
+		default:
+			batch.results[i] = values[j]
+			l.store(ctx, batch.keys[i], values[j])
+		}
+	}
+}
+
+// safeFetch calls fetch, turning a panic into an error for all of the keys, as nobody else would recover it
+func (l *BatchLoader[T]) safeFetch(ctx context.Context, keys []string) (values []T, errs []error) {
+	defer func() {
+		if r := recover(); r != nil {
+			values, errs = nil, []error{fmt.Errorf("panic in batch fetch: %v", r)}
+		}
+	}()
+	return l.fetch(ctx, keys)
+}
+
+// store sets a fetched value in all the layers, nil values are left out as they can't be told apart from a miss
+func (l *BatchLoader[T]) store(ctx context.Context, key string, value T) {
+	if v := reflect.ValueOf(value); !v.IsValid() || (v.Kind() == reflect.Ptr && v.IsNil()) {
+		return
+	}
+	if err := l.instance.Set(ctx, key, value); err != nil {
+		l.integration.LogError("failed to cache a batch loaded value", key, err)
+	}
+}
+
+// wait returns the result of the key at index i, unless ctx is done first
+func (b *loaderBatch[T]) wait(ctx context.Context, i int) (T, error) {
+	select {
+	case <-b.done:
+		return b.results[i], b.errs[i]
+	case <-ctx.Done():
+		var zero T
+		return zero, &kindError{kind: ErrTimeout, err: ctx.Err()}
+	}
+}
@@ -0,0 +1,181 @@
+package mnemosyne
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Names of the structured fields attached to log messages
+const (
+	FieldInstance   = "instance"
+	FieldLayer      = "layer"
+	FieldKeyHash    = "key_hash"
+	FieldError      = "error"
+	FieldSuppressed = "suppressed"
+)
+
+// Fields are the structured fields of a log message
+type Fields map[string]interface{}
+
+// Logger is the structured logger used by Mnemosyne
+type Logger interface {
+	Info(msg string, fields Fields)
+	Warn(msg string, fields Fields)
+	Error(msg string, fields Fields)
+}
+
+var defaultLogger = NewLogrusLogger(logrus.StandardLogger())
+
+// keyHash is used instead of the keys themselves in logs, as keys may contain sensitive data
+func keyHash(key string) string {
+	hasher := fnv.New64a()
+	hasher.Write([]byte(key))
+	return fmt.Sprintf("%016x", hasher.Sum64())
+}
+
+type logrusLogger struct {
+	base logrus.FieldLogger
+}
+
+// NewLogrusLogger adapts a logrus logger (or entry) to Logger
+func NewLogrusLogger(base logrus.FieldLogger) Logger {
+	return &logrusLogger{base: base}
+}
+
+func (l *logrusLogger) Info(msg string, fields Fields) {
+	l.base.WithFields(logrus.Fields(fields)).Info(msg)
+}
+
+func (l *logrusLogger) Warn(msg string, fields Fields) {
+	l.base.WithFields(logrus.Fields(fields)).Warn(msg)
+}
+
+func (l *logrusLogger) Error(msg string, fields Fields) {
+	l.base.WithFields(logrus.Fields(fields)).Error(msg)
+}
+
+type stdLogger struct {
+	base *log.Logger
+}
+
+// NewStdLogger adapts a standard library logger to Logger, fields are written as key=value pairs
+func NewStdLogger(base *log.Logger) Logger {
+	return &stdLogger{base: base}
+}
+
+func (l *stdLogger) print(level, msg string, fields Fields) {
+	var sb strings.Builder
+	sb.WriteString(level)
+	sb.WriteString(" ")
+	sb.WriteString(msg)
+	for _, name := range sortedFieldNames(fields) {
+		fmt.Fprintf(&sb, " %s=%q", name, fmt.Sprint(fields[name]))
+	}
+	l.base.Print(sb.String())
+}
+
+func (l *stdLogger) Info(msg string, fields Fields) {
+	l.print("INFO", msg, fields)
+}
+
+func (l *stdLogger) Warn(msg string, fields Fields) {
+	l.print("WARN", msg, fields)
+}
+
+func (l *stdLogger) Error(msg string, fields Fields) {
+	l.print("ERROR", msg, fields)
+}
+
+func sortedFieldNames(fields Fields) []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// rateLimitedLogger logs each distinct warning or error (per instance and layer) at most once per interval,
+// the number of suppressed repetitions is reported with the next logged one
+type rateLimitedLogger struct {
+	base     Logger
+	interval time.Duration
+	lock     sync.Mutex
+	seen     map[string]*rateLimitState
+}
+
+type rateLimitState struct {
+	last       time.Time
+	suppressed int
+}
+
+func newRateLimitedLogger(base Logger, interval time.Duration) Logger {
+	if interval <= 0 {
+		return base
+	}
+	return &rateLimitedLogger{
+		base:     base,
+		interval: interval,
+		seen:     make(map[string]*rateLimitState),
+	}
+}
+
+// allow decides whether a message should be logged and returns the number of its suppressed repetitions
+func (l *rateLimitedLogger) allow(level, msg string, fields Fields) (bool, int) {
+	id := fmt.Sprintf("%s|%s|%v|%v", level, msg, fields[FieldInstance], fields[FieldLayer])
+	now := time.Now()
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	state, ok := l.seen[id]
+	if !ok {
+		if len(l.seen) > 1024 {
+			// forget everything rather than growing without bounds
+			l.seen = make(map[string]*rateLimitState)
+		}
+		l.seen[id] = &rateLimitState{last: now}
+		return true, 0
+	}
+	if now.Sub(state.last) < l.interval {
+		state.suppressed++
+		return false, 0
+	}
+	suppressed := state.suppressed
+	state.last, state.suppressed = now, 0
+	return true, suppressed
+}
+
+func (l *rateLimitedLogger) log(level string, logFunc func(string, Fields), msg string, fields Fields) {
+	ok, suppressed := l.allow(level, msg, fields)
+	if !ok {
+		return
+	}
+	if suppressed > 0 {
+		withSuppressed := make(Fields, len(fields)+1)
+		for name, value := range fields {
+			withSuppressed[name] = value
+		}
+		withSuppressed[FieldSuppressed] = suppressed
+		fields = withSuppressed
+	}
+	logFunc(msg, fields)
+}
+
+// Info is never rate limited, it's used for rare events which must not be missed
+func (l *rateLimitedLogger) Info(msg string, fields Fields) {
+	l.base.Info(msg, fields)
+}
+
+func (l *rateLimitedLogger) Warn(msg string, fields Fields) {
+	l.log("warn", l.base.Warn, msg, fields)
+}
+
+func (l *rateLimitedLogger) Error(msg string, fields Fields) {
+	l.log("error", l.base.Error, msg, fields)
+}
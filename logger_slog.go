@@ -0,0 +1,38 @@
+//go:build go1.21
+// +build go1.21
+
+package mnemosyne
+
+import (
+	"context"
+	"log/slog"
+)
+
+type slogLogger struct {
+	base *slog.Logger
+}
+
+// NewSlogLogger adapts a log/slog logger to Logger
+func NewSlogLogger(base *slog.Logger) Logger {
+	return &slogLogger{base: base}
+}
+
+func (l *slogLogger) log(level slog.Level, msg string, fields Fields) {
+	attrs := make([]slog.Attr, 0, len(fields))
+	for _, name := range sortedFieldNames(fields) {
+		attrs = append(attrs, slog.Any(name, fields[name]))
+	}
+	l.base.LogAttrs(context.Background(), level, msg, attrs...)
+}
+
+func (l *slogLogger) Info(msg string, fields Fields) {
+	l.log(slog.LevelInfo, msg, fields)
+}
+
+func (l *slogLogger) Warn(msg string, fields Fields) {
+	l.log(slog.LevelWarn, msg, fields)
+}
+
+func (l *slogLogger) Error(msg string, fields Fields) {
+	l.log(slog.LevelError, msg, fields)
+}
@@ -0,0 +1,274 @@
+package mnemosyne
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxPlainArgLength is the length after which an argument is hashed rather than put into the key as-is
+const maxPlainArgLength = 64
+
+// MemoizeOptions controls how the results of a memoized function are cached
+type MemoizeOptions struct {
+	// SoftTTL is how long a result is fresh, after which it is computed again (default: the soft-ttl of the instance)
+	SoftTTL time.Duration
+	// TTL picks the soft-TTL of each result, e.g. from an expiry in the result itself, zero falls back to SoftTTL
+	TTL func(result interface{}) time.Duration
+	// ErrorTTL caches the errors of the function for this long, so a failing call isn't repeated by every caller.
+	// The cached errors keep their message but not their identity (default: errors aren't cached)
+	ErrorTTL time.Duration
+	// FailOnStale returns the error of computing a stale result again, instead of serving the stale result
+	FailOnStale bool
+	// Timeout bounds computing and storing a result, which doesn't stop when the callers give up (default: 30s)
+	Timeout time.Duration
+}
+
+// memoized is what a memoized function stores in the cache
+type memoized[R any] struct {
+	Value R
+	Err   string        `json:",omitempty"`
+	TTL   time.Duration `json:",omitempty"`
+}
+
+// memoizer caches the results of a single function
+type memoizer[R any] struct {
+	instance    ICacheInstance
+	integration Integration
+	options     MemoizeOptions
+	flights     flightGroup
+}
+
+func newMemoizer[R any](instance ICacheInstance, options MemoizeOptions) *memoizer[R] {
+	if options.Timeout <= 0 {
+		options.Timeout = 30 * time.Second
+	}
+	return &memoizer[R]{instance: instance, integration: IntegrationOf(instance), options: options}
+}
+
+// Memoize wraps fn, caching its results in instance under keys derived from name and the argument (see MemoizeKey).
+// Concurrent callers missing the same key share a single call of fn, and results are computed again once their
+// soft-TTL passes. The shared call gets the values of the first caller's context but not its cancellation, and
+// each caller waits for it only until its own context is done. Failing to cache a result doesn't fail the call
+func Memoize[A, R any](instance ICacheInstance, name string, fn func(context.Context, A) (R, error), options MemoizeOptions) func(context.Context, A) (R, error) {
+	m := newMemoizer[R](instance, options)
+	return func(ctx context.Context, a A) (R, error) {
+		return m.call(ctx, MemoizeKey(name, a), func(ctx context.Context) (R, error) { return fn(ctx, a) })
+	}
+}
+
+// Memoize2 is Memoize for functions of two arguments
+func Memoize2[A, B, R any](instance ICacheInstance, name string, fn func(context.Context, A, B) (R, error), options MemoizeOptions) func(context.Context, A, B) (R, error) {
+	m := newMemoizer[R](instance, options)
+	return func(ctx context.Context, a A, b B) (R, error) {
+		return m.call(ctx, MemoizeKey(name, a, b), func(ctx context.Context) (R, error) { return fn(ctx, a, b) })
+	}
+}
+
+// Memoize3 is Memoize for functions of three arguments
+func Memoize3[A, B, C, R any](instance ICacheInstance, name string, fn func(context.Context, A, B, C) (R, error), options MemoizeOptions) func(context.Context, A, B, C) (R, error) {
+	m := newMemoizer[R](instance, options)
+	return func(ctx context.Context, a A, b B, c C) (R, error) {
+		return m.call(ctx, MemoizeKey(name, a, b, c), func(ctx context.Context) (R, error) { return fn(ctx, a, b, c) })
+	}
+}
+
+// MemoizeKey returns the key a memoized function named name caches its result for args under, e.g. to Delete it.
+// Short strings, numbers and booleans are kept as-is, long strings and structured arguments are hashed
+// (structs and maps by their JSON encoding, so the order of map keys doesn't matter). Only arguments that
+// can't be encoded in JSON are hashed by their String method, or their printed form otherwise
+func MemoizeKey(name string, args ...interface{}) string {
+	parts := make([]string, 0, len(args)+2)
+	parts = append(parts, "memoize", name)
+	for _, arg := range args {
+		parts = append(parts, memoizeArg(arg))
+	}
+	return MakeKey(parts...)
+}
+
+func memoizeArg(arg interface{}) string {
+	switch v := arg.(type) {
+	case string:
+		if len(v) <= maxPlainArgLength && !strings.Contains(v, ";") {
+			return strconv.Quote(v)
+		}
+		return hashArg([]byte(v))
+	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return fmt.Sprint(v)
+	}
+	encoded, err := json.Marshal(arg)
+	if err != nil {
+		// not JSON-encodable (e.g. a channel), what it prints is the best left to tell the arguments apart
+		if stringer, ok := arg.(fmt.Stringer); ok {
+			encoded = []byte(stringer.String())
+		} else {
+			encoded = []byte(fmt.Sprintf("%#v", arg))
+		}
+	}
+	return hashArg(encoded)
+}
+
+func hashArg(arg []byte) string {
+	sum := sha256.Sum256(arg)
+	return "#" + hex.EncodeToString(sum[:16])
+}
+
+// call serves the result cached under key while it is fresh, and computes it otherwise
+func (m *memoizer[R]) call(ctx context.Context, key string, compute func(context.Context) (R, error)) (R, error) {
+	cached, fresh := m.cached(ctx, key)
+	if cached != nil && fresh {
+		return cached.result()
+	}
+	origin := ctx
+	res, err := m.flights.doContext(ctx, key, func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(detach(origin), m.options.Timeout)
+		defer cancel()
+		value, err := compute(ctx)
+		stored := &memoized[R]{Value: value, TTL: m.options.SoftTTL}
+		if err != nil {
+			if m.options.ErrorTTL <= 0 {
+				return nil, err
+			}
+			stored = &memoized[R]{Err: err.Error(), TTL: m.options.ErrorTTL}
+		} else if m.options.TTL != nil {
+			if ttl := m.options.TTL(value); ttl > 0 {
+				stored.TTL = ttl
+			}
+		}
+		if err := m.instance.Set(ctx, key, stored); err != nil {
+			m.integration.LogError("failed to cache a memoized result", key, err)
+		}
+		return stored, nil
+	})
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			err = &kindError{kind: ErrTimeout, err: err}
+		}
+		if cached != nil && cached.Err == "" && !m.options.FailOnStale {
+			return cached.Value, nil
+		}
+		var zero R
+		return zero, err
+	}
+	return res.(*memoized[R]).result()
+}
+
+// cached returns the result cached under key (if any) and whether it is still fresh
+func (m *memoizer[R]) cached(ctx context.Context, key string) (*memoized[R], bool) {
+	entry, err := m.instance.GetEntry(ctx, key, &memoized[R]{})
+	if err != nil {
+		return nil, false
+	}
+	cached, ok := entry.Value.(*memoized[R])
+	if !ok {
+		return nil, false
+	}
+	if cached.TTL > 0 {
+		return cached, entry.Age <= cached.TTL
+	}
+	return cached, !entry.Stale
+}
+
+func (res *memoized[R]) result() (R, error) {
+	if res.Err != "" {
+		var zero R
+		return zero, errors.New(res.Err)
+	}
+	return res.Value, nil
+}
+
+// detachedContext keeps the values of a context but neither its deadline nor its cancellation
+type detachedContext struct {
+	context.Context
+}
+
+func detach(ctx context.Context) context.Context {
+	return detachedContext{ctx}
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+var errFlightPanicked = errors.New("the shared call panicked")
+
+// flightGroup shares a single call among the concurrent callers asking for the same key
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flight
+}
+
+type flight struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+// join returns the call in flight for key, starting a new one if there is none
+func (g *flightGroup) join(key string) (f *flight, started bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flight)
+	}
+	if f, ok := g.calls[key]; ok {
+		return f, false
+	}
+	f = &flight{done: make(chan struct{})}
+	g.calls[key] = f
+	return f, true
+}
+
+// run calls fn for the flight, turning a panic into its error as nobody else would recover it when fn runs apart
+func (g *flightGroup) run(key string, f *flight, fn func() (interface{}, error)) {
+	defer func() {
+		if r := recover(); r != nil {
+			f.value, f.err = nil, fmt.Errorf("%w: %v", errFlightPanicked, r)
+		}
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(f.done)
+	}()
+	f.value, f.err = fn()
+}
+
+// do calls fn unless a call for key is already in flight, and waits for the call
+func (g *flightGroup) do(key string, fn func() (interface{}, error)) (interface{}, error) {
+	f, started := g.join(key)
+	if started {
+		g.run(key, f, fn)
+	} else {
+		<-f.done
+	}
+	return f.value, f.err
+}
+
+// doContext is do, but fn runs apart from the caller, which waits for it only until ctx is done
+func (g *flightGroup) doContext(ctx context.Context, key string, fn func() (interface{}, error)) (interface{}, error) {
+	f, started := g.join(key)
+	if started {
+		go g.run(key, f, fn)
+	}
+	select {
+	case <-f.done:
+		return f.value, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// inFlight tells whether a call for key is in flight
+func (g *flightGroup) inFlight(key string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	_, ok := g.calls[key]
+	return ok
+}
@@ -0,0 +1,345 @@
+package mnemosyne
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HeaderXCache tells whether a response was served from the cache, e.g. "HIT from user-redis", "STALE from user-redis",
+// "MISS" or "BYPASS"
+const HeaderXCache = "X-Cache"
+
+// cacheableStatuses are the statuses cached without being asked to by the response (RFC 9110 section 15.1)
+var cacheableStatuses = map[int]bool{
+	http.StatusOK: true, http.StatusNonAuthoritativeInfo: true, http.StatusNoContent: true,
+	http.StatusMultipleChoices: true, http.StatusMovedPermanently: true, http.StatusPermanentRedirect: true,
+	http.StatusNotFound: true, http.StatusMethodNotAllowed: true, http.StatusGone: true,
+	http.StatusRequestURITooLong: true, http.StatusNotImplemented: true,
+}
+
+// CachedResponse is an HTTP response as stored in the cache
+type CachedResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+	// MaxAge is how long the response is fresh as it asked with s-maxage or max-age, for the middleware
+	// zero means the soft-TTL of the instance
+	MaxAge time.Duration
+	// Age is the age the response already had when it was stored, e.g. from its Age header (used by the transport)
+	Age time.Duration `json:",omitempty"`
+	// Revalidate shows the response must be revalidated before every use (used by the transport)
+	Revalidate bool `json:",omitempty"`
+	// RequestHeader holds the headers of the request the response varies on (used by the transport)
+	RequestHeader http.Header `json:",omitempty"`
+}
+
+// fresh tells whether the response found in entry is still fresh
+func (res *CachedResponse) fresh(entry *Entry) bool {
+	if res.MaxAge > 0 {
+		return entry.Age <= res.MaxAge
+	}
+	return !entry.Stale
+}
+
+// MiddlewareOptions controls how NewMiddleware caches the responses
+type MiddlewareOptions struct {
+	// QueryParams are the query parameters which are part of the key, nil means all of them
+	QueryParams []string
+	// VaryHeaders are the request headers which are part of the key, responses varying on other headers aren't cached
+	VaryHeaders []string
+	// Key replaces the key made of the method, host, path, query parameters and headers of the request,
+	// e.g. to leave the host out when a handler serves the same responses under several names
+	Key func(r *http.Request) string
+	// MaxBodySize is the size of the largest body cached (default: 1MB)
+	MaxBodySize int
+	// RevalidateTimeout bounds revalidating a stale response in the background (default: 30s)
+	RevalidateTimeout time.Duration
+}
+
+type cachingHandler struct {
+	instance      ICacheInstance
+	integration   Integration
+	options       MiddlewareOptions
+	next          http.Handler
+	revalidations flightGroup
+}
+
+// NewMiddleware caches the GET and HEAD responses of a handler in instance. Responses are fresh for their
+// s-maxage or max-age, or else the soft-TTL of the instance, after which they are served stale while being
+// revalidated in the background. Requests with an Authorization header, and responses which are private
+// or set cookies, are never cached
+func NewMiddleware(instance ICacheInstance, options MiddlewareOptions) func(http.Handler) http.Handler {
+	if options.MaxBodySize <= 0 {
+		options.MaxBodySize = 1 << 20
+	}
+	if options.RevalidateTimeout <= 0 {
+		options.RevalidateTimeout = 30 * time.Second
+	}
+	in := IntegrationOf(instance)
+	return func(next http.Handler) http.Handler {
+		return &cachingHandler{instance: instance, integration: in, options: options, next: next}
+	}
+}
+
+func (h *cachingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	requestCC := parseCacheControl(r.Header.Get("Cache-Control"))
+	if (r.Method != http.MethodGet && r.Method != http.MethodHead) ||
+		requestCC.has("no-store") || r.Header.Get("Authorization") != "" {
+		w.Header().Set(HeaderXCache, "BYPASS")
+		h.next.ServeHTTP(w, r)
+		return
+	}
+	key := h.key(r)
+	if !requestCC.has("no-cache") {
+		entry, err := h.instance.GetEntry(r.Context(), key, &CachedResponse{})
+		if err == nil {
+			maxAge, limited := requestCC.duration("max-age")
+			if res, ok := entry.Value.(*CachedResponse); ok && !(limited && entry.Age > maxAge) {
+				state := "HIT"
+				if !res.fresh(entry) {
+					state = "STALE"
+					h.revalidate(r, key)
+				}
+				h.serveCached(w, r, res, entry, state)
+				return
+			}
+		}
+	}
+	if requestCC.has("only-if-cached") {
+		w.WriteHeader(http.StatusGatewayTimeout)
+		return
+	}
+	w.Header().Set(HeaderXCache, "MISS")
+	capture := &responseCapture{w: w, maxBodySize: h.options.MaxBodySize}
+	h.next.ServeHTTP(capture, r)
+	h.store(r.Context(), key, capture)
+}
+
+// key is made of the method, host, path, the query parameters and headers the key is configured with
+func (h *cachingHandler) key(r *http.Request) string {
+	if h.options.Key != nil {
+		return h.options.Key(r)
+	}
+	query := r.URL.Query()
+	if h.options.QueryParams != nil {
+		selected := url.Values{}
+		for _, name := range h.options.QueryParams {
+			if values, ok := query[name]; ok {
+				selected[name] = values
+			}
+		}
+		query = selected
+	}
+	parts := []string{"http", r.Method, r.Host, r.URL.Path, query.Encode()}
+	for _, name := range h.options.VaryHeaders {
+		parts = append(parts, http.CanonicalHeaderKey(name)+"="+strings.Join(r.Header.Values(name), ","))
+	}
+	return MakeKey(parts...)
+}
+
+func (h *cachingHandler) serveCached(w http.ResponseWriter, r *http.Request, res *CachedResponse, entry *Entry, state string) {
+	header := w.Header()
+	for name, values := range res.Header {
+		header[name] = values
+	}
+	header.Set("Age", strconv.Itoa(int(entry.Age/time.Second)))
+	header.Set(HeaderXCache, state+" from "+entry.LayerName)
+	if etagMatches(r.Header.Get("If-None-Match"), res.Header.Get("ETag")) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.WriteHeader(res.Status)
+	if r.Method != http.MethodHead {
+		w.Write(res.Body)
+	}
+}
+
+// revalidate runs the handler again for a stale response in the background, once per key at a time. A panic of
+// the handler is logged, as there is no server to recover it
+func (h *cachingHandler) revalidate(r *http.Request, key string) {
+	if h.revalidations.inFlight(key) {
+		return
+	}
+	h.integration.Go(r.Context(), "revalidate", h.options.RevalidateTimeout, func(ctx context.Context) {
+		_, err := h.revalidations.do(key, func() (interface{}, error) {
+			revalidation := r.Clone(ctx)
+			revalidation.Body = http.NoBody
+			revalidation.Header.Del("If-None-Match")
+			revalidation.Header.Del("If-Modified-Since")
+			capture := &responseCapture{header: http.Header{}, maxBodySize: h.options.MaxBodySize}
+			h.next.ServeHTTP(capture, revalidation)
+			h.store(ctx, key, capture)
+			return nil, nil
+		})
+		if err != nil {
+			h.integration.LogError("failed to revalidate a response", key, err)
+		}
+	})
+}
+
+// store caches a response the handler wrote, if it may be cached
+func (h *cachingHandler) store(ctx context.Context, key string, capture *responseCapture) {
+	header := capture.Header().Clone()
+	header.Del(HeaderXCache)
+	header.Del("Age")
+	status := capture.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	responseCC := parseCacheControl(header.Get("Cache-Control"))
+	if capture.overflow || !cacheableStatuses[status] || header.Get("Set-Cookie") != "" ||
+		responseCC.has("no-store") || responseCC.has("no-cache") || responseCC.has("private") ||
+		!h.varies(header) {
+		return
+	}
+	maxAge, ok := responseCC.duration("s-maxage")
+	if !ok {
+		maxAge, ok = responseCC.duration("max-age")
+	}
+	if ok && maxAge == 0 {
+		// it would be stale as soon as it is stored
+		return
+	}
+	res := &CachedResponse{Status: status, Header: header, Body: capture.body.Bytes(), MaxAge: maxAge}
+	if header.Get("ETag") == "" {
+		sum := sha256.Sum256(res.Body)
+		header.Set("ETag", `"`+hex.EncodeToString(sum[:8])+`"`)
+	}
+	if err := h.instance.Set(ctx, key, res); err != nil {
+		h.integration.LogError("failed to cache a response", key, err)
+	}
+}
+
+// varies tells whether the headers a response varies on are all part of the key
+func (h *cachingHandler) varies(header http.Header) bool {
+	for _, vary := range header.Values("Vary") {
+		for _, name := range strings.Split(vary, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if name == "*" || !containsHeader(h.options.VaryHeaders, name) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func containsHeader(names []string, name string) bool {
+	for _, candidate := range names {
+		if strings.EqualFold(candidate, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// responseCapture records what a handler writes, passing it through to w (if any)
+type responseCapture struct {
+	// w is nil when revalidating in the background
+	w           http.ResponseWriter
+	header      http.Header
+	status      int
+	body        bytes.Buffer
+	maxBodySize int
+	overflow    bool
+}
+
+func (c *responseCapture) Header() http.Header {
+	if c.w != nil {
+		return c.w.Header()
+	}
+	return c.header
+}
+
+func (c *responseCapture) WriteHeader(status int) {
+	if c.status == 0 {
+		c.status = status
+	}
+	if c.w != nil {
+		c.w.WriteHeader(status)
+	}
+}
+
+func (c *responseCapture) Write(p []byte) (int, error) {
+	if c.status == 0 {
+		c.WriteHeader(http.StatusOK)
+	}
+	if !c.overflow {
+		if c.body.Len()+len(p) > c.maxBodySize {
+			c.overflow = true
+			c.body = bytes.Buffer{}
+		} else {
+			c.body.Write(p)
+		}
+	}
+	if c.w != nil {
+		return c.w.Write(p)
+	}
+	return len(p), nil
+}
+
+// Flush keeps streaming handlers working, the streamed responses are still cached once complete
+func (c *responseCapture) Flush() {
+	if flusher, ok := c.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// cacheControl holds the directives of a Cache-Control header, by their lower-cased names
+type cacheControl map[string]string
+
+func parseCacheControl(header string) cacheControl {
+	cc := cacheControl{}
+	for _, part := range strings.Split(header, ",") {
+		name, value := strings.TrimSpace(part), ""
+		if i := strings.IndexByte(name, '='); i >= 0 {
+			name, value = strings.TrimSpace(name[:i]), strings.Trim(strings.TrimSpace(name[i+1:]), `"`)
+		}
+		if name != "" {
+			cc[strings.ToLower(name)] = value
+		}
+	}
+	return cc
+}
+
+func (cc cacheControl) has(directive string) bool {
+	_, ok := cc[directive]
+	return ok
+}
+
+// duration returns a directive given in seconds, like max-age
+func (cc cacheControl) duration(directive string) (time.Duration, bool) {
+	value, ok := cc[directive]
+	if !ok {
+		return 0, false
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// etagMatches tells whether an If-None-Match header matches etag, using the weak comparison of RFC 9110
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" || etag == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
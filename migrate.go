@@ -0,0 +1,85 @@
+package mnemosyne
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// ConfigMigration is the result of MigrateConfig
+type ConfigMigration struct {
+	// Config is the migrated config, holding everything the original one did
+	Config *viper.Viper
+	// Migrated are the keys of the migrated layers, e.g. cache.results.results-redis
+	Migrated []string
+	// Problems are the changes of behaviour caused by the migration, along with the layers which couldn't be migrated
+	Problems []ConfigProblem
+}
+
+// MigrateConfig rewrites the deprecated gaurdian layers, as well as the redis ones, into the equivalent
+// rediscluster form. All other settings of the layers (db, ttl, compression, ...) are kept as they are and
+// the data already in redis stays readable, as a single shard cluster stores keys exactly the same way.
+// The original config is left untouched. Note that viper lowercases all keys and drops comments
+func MigrateConfig(config *viper.Viper) *ConfigMigration {
+	settings := config.AllSettings()
+	migration := &ConfigMigration{}
+	report := func(key string, warning bool, message string) {
+		migration.Problems = append(migration.Problems, ConfigProblem{Key: key, Warning: warning, Message: message})
+	}
+	caches, _ := settings["cache"].(map[string]interface{})
+	for name, instance := range caches {
+		instanceSettings, ok := instance.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, layerName := range cast.ToStringSlice(instanceSettings["layers"]) {
+			layerSettings, ok := instanceSettings[strings.ToLower(layerName)].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			key := "cache." + name + "." + layerName
+			if migrateRedisLayer(key, layerSettings, report) {
+				migration.Migrated = append(migration.Migrated, key)
+			}
+		}
+	}
+	sort.Strings(migration.Migrated)
+	sort.SliceStable(migration.Problems, func(i, j int) bool { return migration.Problems[i].Key < migration.Problems[j].Key })
+
+	migration.Config = viper.New()
+	if err := migration.Config.MergeConfigMap(settings); err != nil {
+		report("cache", false, err.Error())
+	}
+	return migration
+}
+
+// migrateRedisLayer rewrites the settings of a redis or gaurdian layer in place, and tells whether it did
+func migrateRedisLayer(key string, layerSettings map[string]interface{}, report func(string, bool, string)) bool {
+	layerType := cast.ToString(layerSettings["type"])
+	if layerType != "redis" && layerType != "gaurdian" {
+		return false
+	}
+	address := cast.ToString(layerSettings["address"])
+	if address == "" {
+		report(key+".address", false, "is not set, so the layer is left as it is")
+		return false
+	}
+	if _, ok := layerSettings["cluster"]; ok {
+		report(key+".cluster", true, "is ignored by "+layerType+" layers and is replaced")
+	}
+	shard := map[string]interface{}{"address": address}
+	slaves := cast.ToStringSlice(layerSettings["slaves"])
+	if layerType == "gaurdian" && len(slaves) > 0 {
+		shard["slaves"] = slaves
+	} else if len(slaves) > 0 {
+		// reading from the slaves would change behaviour (e.g. replication lag), so they're left out
+		report(key+".slaves", true, "is ignored by redis layers and is dropped, add it to the shard to read from the slaves")
+	}
+	delete(layerSettings, "address")
+	delete(layerSettings, "slaves")
+	layerSettings["cluster"] = []interface{}{shard}
+	layerSettings["type"] = "rediscluster"
+	return true
+}
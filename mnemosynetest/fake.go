@@ -0,0 +1,401 @@
+// Package mnemosynetest provides an in-memory fake of a Mnemosyne cache instance for the unit tests of the services using it.
+//
+//	cache := mnemosynetest.New(mnemosynetest.WithSoftTTL(time.Hour))
+//	cache.Preload("user:1", &User{Name: "old"}, 2*time.Hour) // stale
+//	cache.Inject(mnemosynetest.Fault{Op: mnemosynetest.OpSet, Err: mnemosyne.ErrLayerUnavailable})
+//	service := NewService(cache) // depends on mnemosyne.ICacheInstance
+//	...
+//	calls := cache.Calls()
+package mnemosynetest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mghayour/mnemosyne"
+)
+
+// LayerName is the name of the single layer the fake pretends to have, as reported in entries and errors
+const LayerName = "fake"
+
+// The operations faults can be injected into
+const (
+	// OpGet covers Get, GetEntry, GetAndShouldUpdate, ShouldUpdate and ShouldUpdateDeep
+	OpGet    = "get"
+	OpSet    = "set"
+	OpDelete = "delete"
+	OpTTL    = "ttl"
+	OpFlush  = "flush"
+)
+
+// Call is a call made to the fake
+type Call struct {
+	// Method is the name of the method called, e.g. GetEntry
+	Method string
+	Op     string
+	// Key is empty for Flush
+	Key string
+	// Value is the value given to Set
+	Value interface{}
+	// Err is the error returned to the caller
+	Err error
+}
+
+// Fault is an error and/or a delay injected into the calls matching Op and Key
+type Fault struct {
+	// Op is one of the Op constants, empty matches all operations
+	Op string
+	// Key is the key of the calls affected, empty matches all keys
+	Key string
+	// Err is returned the way MnemosyneInstance reports a failing layer: reads return an ErrCacheMiss
+	// holding it as the layer error (matching Err, and ErrMiss only if Err is a miss), writes a MultiError
+	Err error
+	// Latency delays the calls, a call whose context is done before the delay is over fails with ErrTimeout
+	Latency time.Duration
+	// Times is the number of calls affected, zero means all of them
+	Times int
+}
+
+// Option configures a Fake
+type Option func(*Fake)
+
+// WithSoftTTL sets the soft-TTL after which values are reported as stale (default: zero, so all values are stale
+// like in an instance without soft-ttl)
+func WithSoftTTL(softTTL time.Duration) Option {
+	return func(f *Fake) {
+		f.softTTL = softTTL
+	}
+}
+
+// WithTTL sets the hard TTL after which values expire (default: zero, values never expire and their TTL is unknown)
+func WithTTL(ttl time.Duration) Option {
+	return func(f *Fake) {
+		f.ttl = ttl
+	}
+}
+
+// WithClock sets the clock which stamps and ages the values, e.g. a mnemosyne.FakeClock (default: the wall clock)
+func WithClock(clock mnemosyne.Clock) Option {
+	return func(f *Fake) {
+		f.clock = clock
+	}
+}
+
+type entry struct {
+	value []byte
+	time  time.Time
+}
+
+// Fake is an in-memory mnemosyne.IBatchCacheInstance, safe for concurrent use. Values are stored JSON encoded
+// and decoded into the given refrence, the same way the layers of a real instance do
+type Fake struct {
+	lock    sync.Mutex
+	clock   mnemosyne.Clock
+	softTTL time.Duration
+	ttl     time.Duration
+	entries map[string]*entry
+	faults  []*Fault
+	calls   []Call
+}
+
+var _ mnemosyne.IBatchCacheInstance = (*Fake)(nil)
+
+type wallClock struct{}
+
+func (wallClock) Now() time.Time {
+	return time.Now()
+}
+
+// New creates an empty Fake
+func New(opts ...Option) *Fake {
+	f := &Fake{
+		clock:   wallClock{},
+		entries: make(map[string]*entry),
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+// Preload stores a value which was set age ago, without recording a call. It panics if value can't be encoded
+func (f *Fake) Preload(key string, value interface{}, age time.Duration) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		panic(fmt.Sprintf("mnemosynetest: can't preload %q: %v", key, err))
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.entries[key] = &entry{value: encoded, time: f.clock.Now().Add(-age)}
+}
+
+// Has tells whether the fake holds a value (even an expired one) for key
+func (f *Fake) Has(key string) bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	_, ok := f.entries[key]
+	return ok
+}
+
+// Inject adds a fault, faults are matched in the order they were added
+func (f *Fake) Inject(fault Fault) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.faults = append(f.faults, &fault)
+}
+
+// ClearFaults removes all the injected faults
+func (f *Fake) ClearFaults() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.faults = nil
+}
+
+// Calls returns the calls made so far, in order
+func (f *Fake) Calls() []Call {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return append([]Call(nil), f.calls...)
+}
+
+// ClearCalls forgets the calls made so far
+func (f *Fake) ClearCalls() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.calls = nil
+}
+
+// Get retrieves the value for key
+func (f *Fake) Get(ctx context.Context, key string, refrence interface{}) (res interface{}, err error) {
+	defer f.record("Get", OpGet, key, nil, &err)
+	res, _, err = f.getAndShouldUpdate(ctx, key, refrence)
+	return res, err
+}
+
+// GetEntry retrieves the value for key along with its metadata
+func (f *Fake) GetEntry(ctx context.Context, key string, refrence interface{}) (res *mnemosyne.Entry, err error) {
+	defer f.record("GetEntry", OpGet, key, nil, &err)
+	return f.getEntry(ctx, key, refrence)
+}
+
+// GetEntries retrieves the values of keys along with their metadata, each key being recorded as a call of its own
+func (f *Fake) GetEntries(ctx context.Context, keys []string, refrences []interface{}) ([]*mnemosyne.Entry, []error) {
+	entries := make([]*mnemosyne.Entry, len(keys))
+	errs := make([]error, len(keys))
+	if len(refrences) != len(keys) {
+		err := fmt.Errorf("got %d refrences for %d keys", len(refrences), len(keys))
+		for i := range errs {
+			errs[i] = err
+		}
+		return entries, errs
+	}
+	for i, key := range keys {
+		func() {
+			defer f.record("GetEntries", OpGet, key, nil, &errs[i])
+			entries[i], errs[i] = f.getEntry(ctx, key, refrences[i])
+		}()
+	}
+	return entries, errs
+}
+
+// GetAndShouldUpdate retrieves the value for key and also shows whether its soft-TTL has passed
+func (f *Fake) GetAndShouldUpdate(ctx context.Context, key string, refrence interface{}) (res interface{}, shouldUpdate bool, err error) {
+	defer f.record("GetAndShouldUpdate", OpGet, key, nil, &err)
+	return f.getAndShouldUpdate(ctx, key, refrence)
+}
+
+// ShouldUpdate shows whether the soft-TTL of key has passed
+func (f *Fake) ShouldUpdate(ctx context.Context, key string) (shouldUpdate bool, err error) {
+	defer f.record("ShouldUpdate", OpGet, key, nil, &err)
+	_, shouldUpdate, err = f.getAndShouldUpdate(ctx, key, nil)
+	return shouldUpdate, err
+}
+
+// ShouldUpdateDeep is the same as GetAndShouldUpdate for the fake, as it has a single layer
+func (f *Fake) ShouldUpdateDeep(ctx context.Context, key string, refrence interface{}) (shouldUpdate bool, err error) {
+	defer f.record("ShouldUpdateDeep", OpGet, key, nil, &err)
+	_, shouldUpdate, err = f.getAndShouldUpdate(ctx, key, refrence)
+	return shouldUpdate, err
+}
+
+// Set stores value for key
+func (f *Fake) Set(ctx context.Context, key string, value interface{}) (err error) {
+	defer f.record("Set", OpSet, key, value, &err)
+	if err := f.fault(ctx, OpSet, key); err != nil {
+		return &mnemosyne.MultiError{Errors: []error{layerError(OpSet, err)}}
+	}
+	if value == nil {
+		return fmt.Errorf("cannot set nil value in cache")
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return &mnemosyne.MultiError{Errors: []error{layerError(OpSet, err)}}
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.entries[key] = &entry{value: encoded, time: f.clock.Now()}
+	return nil
+}
+
+// Delete removes key
+func (f *Fake) Delete(ctx context.Context, key string) (err error) {
+	defer f.record("Delete", OpDelete, key, nil, &err)
+	if err := f.fault(ctx, OpDelete, key); err != nil {
+		return &mnemosyne.MultiError{Errors: []error{layerError(OpDelete, err)}}
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	delete(f.entries, key)
+	return nil
+}
+
+// TTL returns the remaining TTL of key and the layer it was found on (-1 if the TTL is unknown)
+func (f *Fake) TTL(ctx context.Context, key string) (int, time.Duration) {
+	var err error
+	defer f.record("TTL", OpTTL, key, nil, &err)
+	if err = f.fault(ctx, OpTTL, key); err != nil || f.ttl == 0 {
+		return -1, 0
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	e, ok := f.entries[key]
+	if !ok {
+		return -1, 0
+	}
+	if remaining := f.ttl - f.clock.Now().Sub(e.time); remaining > 0 {
+		return 0, remaining
+	}
+	return -1, 0
+}
+
+// Flush removes all the values, whatever the layer name is
+func (f *Fake) Flush(targetLayerName string) (err error) {
+	defer f.record("Flush", OpFlush, "", nil, &err)
+	if err := f.fault(context.Background(), OpFlush, ""); err != nil {
+		return err
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.entries = make(map[string]*entry)
+	return nil
+}
+
+func (f *Fake) getAndShouldUpdate(ctx context.Context, key string, refrence interface{}) (interface{}, bool, error) {
+	res, err := f.getEntry(ctx, key, refrence)
+	if err != nil {
+		// like the real instance, only a miss calls for an update, not a layer failing to answer
+		return nil, errors.Is(err, mnemosyne.ErrMiss), err
+	}
+	return res.Value, res.Stale, nil
+}
+
+func (f *Fake) getEntry(ctx context.Context, key string, refrence interface{}) (*mnemosyne.Entry, error) {
+	if err := f.fault(ctx, OpGet, key); err != nil {
+		return nil, &mnemosyne.ErrCacheMiss{Errors: []error{layerError(OpGet, err)}}
+	}
+	now := f.clock.Now()
+	f.lock.Lock()
+	e, ok := f.entries[key]
+	f.lock.Unlock()
+	if !ok || (f.ttl > 0 && now.Sub(e.time) >= f.ttl) {
+		return nil, &mnemosyne.ErrCacheMiss{}
+	}
+	if refrence != nil {
+		if err := json.Unmarshal(e.value, refrence); err != nil {
+			return nil, &mnemosyne.ErrCacheMiss{Errors: []error{layerError(OpGet, &decodeError{err: err})}}
+		}
+	}
+	age := now.Sub(e.time)
+	res := &mnemosyne.Entry{
+		Value:     refrence,
+		Layer:     0,
+		LayerName: LayerName,
+		Time:      e.time,
+		Age:       age,
+		Stale:     age > f.softTTL,
+	}
+	if f.ttl > 0 {
+		res.TTL = f.ttl - age
+	}
+	return res, nil
+}
+
+// fault applies the first fault matching the call, if any
+func (f *Fake) fault(ctx context.Context, op, key string) error {
+	f.lock.Lock()
+	var matched *Fault
+	for i, fault := range f.faults {
+		if (fault.Op == "" || fault.Op == op) && (fault.Key == "" || fault.Key == key) {
+			matched = fault
+			if fault.Times > 0 {
+				fault.Times--
+				if fault.Times == 0 {
+					f.faults = append(f.faults[:i:i], f.faults[i+1:]...)
+				}
+			}
+			break
+		}
+	}
+	f.lock.Unlock()
+	if matched == nil {
+		return nil
+	}
+	if matched.Latency > 0 {
+		timer := time.NewTimer(matched.Latency)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return &timeoutError{err: ctx.Err()}
+		}
+	}
+	return matched.Err
+}
+
+func (f *Fake) record(method, op, key string, value interface{}, err *error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.calls = append(f.calls, Call{Method: method, Op: op, Key: key, Value: value, Err: *err})
+}
+
+func layerError(op string, err error) error {
+	return &mnemosyne.LayerError{Layer: LayerName, Index: 0, Op: op, Err: err}
+}
+
+// timeoutError matches mnemosyne.ErrTimeout, like the errors of a real layer running out of time
+type timeoutError struct {
+	err error
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("%v: %v", mnemosyne.ErrTimeout, e.err)
+}
+
+func (e *timeoutError) Is(target error) bool {
+	return target == mnemosyne.ErrTimeout
+}
+
+func (e *timeoutError) Unwrap() error {
+	return e.err
+}
+
+// decodeError matches mnemosyne.ErrDecode
+type decodeError struct {
+	err error
+}
+
+func (e *decodeError) Error() string {
+	return fmt.Sprintf("%v: %v", mnemosyne.ErrDecode, e.err)
+}
+
+func (e *decodeError) Is(target error) bool {
+	return target == mnemosyne.ErrDecode
+}
+
+func (e *decodeError) Unwrap() error {
+	return e.err
+}
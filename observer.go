@@ -0,0 +1,95 @@
+package mnemosyne
+
+import (
+	"errors"
+	"time"
+)
+
+// Outcomes of a single layer operation, as reported to observers
+const (
+	outcomeOK      = "ok"
+	outcomeMiss    = "miss"
+	outcomeAmnesia = "amnesia"
+	outcomeError   = "error"
+)
+
+// observer receives the events of cache instances, e.g. to export them as metrics
+type observer interface {
+	// observeOperation is called for each Get/Set/Delete call on an instance
+	observeOperation(instance, op string, took time.Duration)
+	// observeLayerOperation is called for each operation on a layer, err is the error returned by the layer
+	observeLayerOperation(instance, layer, op string, err error, took time.Duration)
+	// observeHit is called when a read from the instance is served by a layer
+	observeHit(instance, layer string)
+	// observeMiss is called when none of the layers had the key
+	observeMiss(instance string)
+	// observeBackfill is called when a value is written to a layer after being found in a lower one
+	observeBackfill(instance, layer string)
+	// observeEviction is called when a layer drops a value on its own
+	observeEviction(instance, layer, reason string)
+	// observeHotness is called with the hotness (hot, warm or cold) of each value read
+	observeHotness(instance, hotness string)
+}
+
+// layerStatter is implemented by the layers which can report their size,
+// sizeBytes is negative when the layer can't tell its size
+type layerStatter interface {
+	layerStats() (entries int, sizeBytes int)
+}
+
+func outcomeOf(err error) string {
+	switch {
+	case err == nil:
+		return outcomeOK
+	case errors.Is(err, ErrAmnesia):
+		return outcomeAmnesia
+	case errors.Is(err, ErrMiss):
+		return outcomeMiss
+	default:
+		return outcomeError
+	}
+}
+
+func (mn *MnemosyneInstance) observeOperation(op string, start time.Time) {
+	took := time.Since(start)
+	for _, o := range mn.observers {
+		o.observeOperation(mn.name, op, took)
+	}
+}
+
+func (mn *MnemosyneInstance) observeLayerOperation(layer int, op string, err error, start time.Time) {
+	took := time.Since(start)
+	for _, o := range mn.observers {
+		o.observeLayerOperation(mn.name, mn.cacheLayers[layer].Name(), op, err, took)
+	}
+}
+
+func (mn *MnemosyneInstance) observeHit(layer int) {
+	for _, o := range mn.observers {
+		o.observeHit(mn.name, mn.cacheLayers[layer].Name())
+	}
+}
+
+func (mn *MnemosyneInstance) observeMiss() {
+	for _, o := range mn.observers {
+		o.observeMiss(mn.name)
+	}
+}
+
+func (mn *MnemosyneInstance) observeBackfill(layer int) {
+	for _, o := range mn.observers {
+		o.observeBackfill(mn.name, mn.cacheLayers[layer].Name())
+	}
+}
+
+func (mn *MnemosyneInstance) observeEviction(layerName, reason string) {
+	for _, o := range mn.observers {
+		o.observeEviction(mn.name, layerName, reason)
+	}
+}
+
+func (mn *MnemosyneInstance) observeHotness(hotness string) {
+	for _, o := range mn.observers {
+		o.observeHotness(mn.name, hotness)
+	}
+}
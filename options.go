@@ -0,0 +1,80 @@
+package mnemosyne
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Option configures the optional features of Mnemosyne
+type Option func(*options)
+
+type options struct {
+	registerer     prometheus.Registerer
+	tracerProvider trace.TracerProvider
+	logger         Logger
+	logRateLimit   time.Duration
+	clock          Clock
+	random         RandomSource
+}
+
+func defaultOptions() options {
+	return options{
+		logger:       defaultLogger,
+		logRateLimit: 10 * time.Second,
+		clock:        systemClock{},
+		random:       globalRandom{},
+	}
+}
+
+// WithPrometheus exports the metrics of all cache instances through a collector registered on registerer
+func WithPrometheus(registerer prometheus.Registerer) Option {
+	return func(o *options) {
+		o.registerer = registerer
+	}
+}
+
+// WithLogger sets the logger used by Mnemosyne, nil keeps the default (default: the standard logrus logger)
+func WithLogger(logger Logger) Option {
+	return func(o *options) {
+		if logger == nil {
+			logger = defaultLogger
+		}
+		o.logger = logger
+	}
+}
+
+// WithLogRateLimit sets the minimum interval between repetitions of the same warning or error
+// of a cache layer in the logs, zero disables rate limiting (default: 10s)
+func WithLogRateLimit(interval time.Duration) Option {
+	return func(o *options) {
+		o.logRateLimit = interval
+	}
+}
+
+// WithTracerProvider sets the OpenTelemetry tracer provider used for the spans of cache operations (default: the global one)
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(o *options) {
+		o.tracerProvider = provider
+	}
+}
+
+// WithClock sets the clock used to stamp and age the values, e.g. a FakeClock in tests, nil keeps the default
+// (default: the wall clock)
+func WithClock(clock Clock) Option {
+	return func(o *options) {
+		if clock == nil {
+			clock = systemClock{}
+		}
+		o.clock = clock
+	}
+}
+
+// WithRandomSource sets the source of randomness for amnesia and picking slaves, e.g. NewRandomSource with a fixed seed
+// in tests (default: the shared source of math/rand)
+func WithRandomSource(source RandomSource) Option {
+	return func(o *options) {
+		o.random = source
+	}
+}
@@ -0,0 +1,226 @@
+package mnemosyne
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	// DropNewest rejects new background writes while the queue is full
+	DropNewest = "drop-newest"
+	// DropOldest discards the oldest queued background write to make room for a new one
+	DropOldest = "drop-oldest"
+
+	defaultBackgroundWorkers   = 16
+	defaultBackgroundQueueSize = 1024
+)
+
+// BackgroundStats is a snapshot of the background writes (filling upper layers and syncing them) of an instance
+type BackgroundStats struct {
+	// QueueDepth is the number of writes waiting for a worker
+	QueueDepth int
+	// Workers is the number of running workers
+	Workers int
+	// Dropped is the number of writes discarded because the queue was full
+	Dropped uint64
+	// Coalesced is the number of writes merged into an identical pending one
+	Coalesced uint64
+}
+
+// backgroundTask is a queued background write, tasks with the same id are coalesced
+type backgroundTask struct {
+	id    string
+	value *Cachable
+	run   func(value *Cachable)
+}
+
+// workerPool runs the background writes of an instance with a bounded number of workers and a bounded queue.
+// Workers are started on demand and exit once the queue is empty, so an idle pool holds no goroutines
+type workerPool struct {
+	// counters come first to keep them 64-bit aligned for atomic operations
+	dropped    uint64
+	coalesced  uint64
+	lock       sync.Mutex
+	maxWorkers int
+	queueSize  int
+	dropOldest bool
+	workers    int
+	queue      []*backgroundTask
+	pending    map[string]*backgroundTask
+	closed     bool
+	// idle is closed once the pool is closed and all of its workers have exited
+	idle chan struct{}
+}
+
+// newBackgroundPool creates the worker pool of an instance from its background config
+func newBackgroundPool(config *viper.Viper, instanceName string, logger Logger) *workerPool {
+	keyPrefix := "cache." + instanceName + ".background"
+	workers := defaultBackgroundWorkers
+	if config.IsSet(keyPrefix + ".workers") {
+		workers = config.GetInt(keyPrefix + ".workers")
+	}
+	queueSize := defaultBackgroundQueueSize
+	if config.IsSet(keyPrefix + ".queue-size") {
+		queueSize = config.GetInt(keyPrefix + ".queue-size")
+	}
+	dropPolicy := config.GetString(keyPrefix + ".drop-policy")
+	if dropPolicy == "" {
+		dropPolicy = DropNewest
+	} else if dropPolicy != DropNewest && dropPolicy != DropOldest {
+		logger.Error(fmt.Sprintf("Malformed: Unknown drop-policy %s, using %s", dropPolicy, DropNewest), Fields{FieldInstance: instanceName})
+		dropPolicy = DropNewest
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	if queueSize < 1 {
+		queueSize = 1
+	}
+	return newWorkerPool(workers, queueSize, dropPolicy)
+}
+
+func newWorkerPool(maxWorkers, queueSize int, dropPolicy string) *workerPool {
+	return &workerPool{
+		maxWorkers: maxWorkers,
+		queueSize:  queueSize,
+		dropOldest: dropPolicy == DropOldest,
+		pending:    make(map[string]*backgroundTask),
+	}
+}
+
+// submit queues a task, and tells whether it was queued (or coalesced into a pending one)
+// and whether a task (either this one or the oldest queued one) was dropped because the queue was full
+func (p *workerPool) submit(task *backgroundTask) (queued bool, dropped bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.closed {
+		return false, false
+	}
+	if pending, ok := p.pending[task.id]; ok {
+		// the pending write takes the newest value of the two
+		if task.value.Time.After(pending.value.Time) {
+			pending.value = task.value
+		}
+		atomic.AddUint64(&p.coalesced, 1)
+		return true, false
+	}
+	if len(p.queue) >= p.queueSize {
+		atomic.AddUint64(&p.dropped, 1)
+		if !p.dropOldest || len(p.queue) == 0 {
+			return false, true
+		}
+		delete(p.pending, p.queue[0].id)
+		p.queue[0] = nil
+		p.queue = p.queue[1:]
+		dropped = true
+	}
+	p.queue = append(p.queue, task)
+	p.pending[task.id] = task
+	if p.workers < p.maxWorkers {
+		p.workers++
+		go p.work()
+	}
+	return true, dropped
+}
+
+func (p *workerPool) work() {
+	for {
+		p.lock.Lock()
+		if len(p.queue) == 0 {
+			p.workers--
+			if p.closed && p.workers == 0 {
+				close(p.idle)
+			}
+			p.lock.Unlock()
+			return
+		}
+		task := p.queue[0]
+		p.queue[0] = nil
+		p.queue = p.queue[1:]
+		delete(p.pending, task.id)
+		// the value may be replaced by a coalesced write until the task leaves the pending set
+		value := task.value
+		p.lock.Unlock()
+		task.run(value)
+	}
+}
+
+// close stops accepting tasks and waits for the queued ones to finish until ctx is done,
+// then discards whatever is left in the queue
+func (p *workerPool) close(ctx context.Context) error {
+	p.lock.Lock()
+	p.closed = true
+	p.idle = make(chan struct{})
+	if p.workers == 0 {
+		close(p.idle)
+	}
+	p.lock.Unlock()
+	select {
+	case <-p.idle:
+		return nil
+	default:
+	}
+	select {
+	case <-p.idle:
+		return nil
+	case <-ctx.Done():
+		p.lock.Lock()
+		discarded := len(p.queue)
+		p.queue, p.pending = nil, make(map[string]*backgroundTask)
+		p.lock.Unlock()
+		atomic.AddUint64(&p.dropped, uint64(discarded))
+		return fmt.Errorf("%d background writes were discarded: %w", discarded, ctx.Err())
+	}
+}
+
+func (p *workerPool) stats() BackgroundStats {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return BackgroundStats{
+		QueueDepth: len(p.queue),
+		Workers:    p.workers,
+		Dropped:    atomic.LoadUint64(&p.dropped),
+		Coalesced:  atomic.LoadUint64(&p.coalesced),
+	}
+}
+
+// scheduleFill queues filling the layers above the one a value was found on, and tells whether it was queued
+func (mn *MnemosyneInstance) scheduleFill(origin context.Context, key string, value *Cachable, layer int) bool {
+	if layer == 0 {
+		return false
+	}
+	return mn.schedule(&backgroundTask{
+		id:    fmt.Sprintf("fill|%d|%s", layer, key),
+		value: value,
+		run: func(value *Cachable) {
+			mn.fillUpperLayers(origin, key, value, layer)
+		},
+	}, key, layer)
+}
+
+// scheduleSync queues replacing the older value of a layer found by getAndSyncLayers
+func (mn *MnemosyneInstance) scheduleSync(origin context.Context, key string, value *Cachable, layer int) bool {
+	return mn.schedule(&backgroundTask{
+		id:    fmt.Sprintf("sync|%d|%s", layer, key),
+		value: value,
+		run: func(value *Cachable) {
+			mn.syncLayer(origin, key, value, layer)
+		},
+	}, key, layer)
+}
+
+func (mn *MnemosyneInstance) schedule(task *backgroundTask, key string, layer int) bool {
+	queued, dropped := mn.background.submit(task)
+	if dropped {
+		mn.logger.Warn("background write dropped, the queue is full", Fields{
+			FieldInstance: mn.name,
+			FieldLayer:    mn.cacheLayers[layer].Name(),
+			FieldKeyHash:  keyHash(key),
+		})
+	}
+	return queued
+}
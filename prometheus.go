@@ -0,0 +1,218 @@
+package mnemosyne
+
+import (
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Label names used by the Prometheus metrics
+const (
+	LabelCache     = "cache"
+	LabelLayer     = "layer"
+	LabelOperation = "operation"
+	LabelReason    = "reason"
+	LabelHotness   = "hotness"
+)
+
+// prometheusCollector exports the events of all instances of a Mnemosyne as Prometheus metrics.
+// The cache label holds the name of the instance, since the instance label is used by Prometheus for scrape targets:
+//
+//	mnemosyne_operation_duration_seconds{cache,operation}             histogram of Get/Set/Delete latency of instances
+//	mnemosyne_layer_operation_duration_seconds{cache,layer,operation} histogram of get/set/delete latency of layers
+//	mnemosyne_hits_total{cache,layer}                                 values served by each layer
+//	mnemosyne_layer_misses_total{cache,layer}                         keys missing from each layer
+//	mnemosyne_misses_total{cache}                                     keys missing from all layers
+//	mnemosyne_amnesia_total{cache,layer}                              misses caused by amnesia
+//	mnemosyne_errors_total{cache,layer,operation}                     failed layer operations
+//	mnemosyne_fingerprint_mismatches_total{cache,layer}               entries ignored because of a schema change
+//	mnemosyne_backfills_total{cache,layer}                            values written to upper layers after a lower layer hit
+//	mnemosyne_evictions_total{cache,layer,reason}                     values dropped by memory layers (reason: expired, no-space)
+//	mnemosyne_hotness_total{cache,hotness}                            values read by their soft-TTL hotness (hot, warm, cold)
+//	mnemosyne_layer_entries{cache,layer}                              number of entries in memory layers
+//	mnemosyne_layer_size_bytes{cache,layer}                           memory used by memory layers
+//	mnemosyne_background_queue_depth{cache}                           background writes waiting for a worker
+//	mnemosyne_background_dropped_total{cache}                         background writes dropped because the queue was full
+//	mnemosyne_background_coalesced_total{cache}                       background writes merged into an identical pending one
+type prometheusCollector struct {
+	mnemosyne *Mnemosyne
+
+	operationDuration      *prometheus.HistogramVec
+	layerOperationDuration *prometheus.HistogramVec
+	hits                   *prometheus.CounterVec
+	layerMisses            *prometheus.CounterVec
+	misses                 *prometheus.CounterVec
+	amnesia                *prometheus.CounterVec
+	errors                 *prometheus.CounterVec
+	fingerprintMismatches  *prometheus.CounterVec
+	backfills              *prometheus.CounterVec
+	evictions              *prometheus.CounterVec
+	hotness                *prometheus.CounterVec
+	entriesDesc            *prometheus.Desc
+	sizeDesc               *prometheus.Desc
+	queueDepthDesc         *prometheus.Desc
+	droppedDesc            *prometheus.Desc
+	coalescedDesc          *prometheus.Desc
+}
+
+func newPrometheusCollector() *prometheusCollector {
+	const namespace = "mnemosyne"
+	return &prometheusCollector{
+		operationDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "operation_duration_seconds",
+			Help:      "Latency of operations on cache instances.",
+			Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 10),
+		}, []string{LabelCache, LabelOperation}),
+		layerOperationDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "layer_operation_duration_seconds",
+			Help:      "Latency of operations on cache layers.",
+			Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 10),
+		}, []string{LabelCache, LabelLayer, LabelOperation}),
+		hits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "hits_total",
+			Help:      "Number of values served by each cache layer.",
+		}, []string{LabelCache, LabelLayer}),
+		layerMisses: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "layer_misses_total",
+			Help:      "Number of keys missing from each cache layer.",
+		}, []string{LabelCache, LabelLayer}),
+		misses: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "misses_total",
+			Help:      "Number of keys missing from all layers of a cache instance.",
+		}, []string{LabelCache}),
+		amnesia: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "amnesia_total",
+			Help:      "Number of misses caused by amnesia.",
+		}, []string{LabelCache, LabelLayer}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "errors_total",
+			Help:      "Number of failed operations on cache layers.",
+		}, []string{LabelCache, LabelLayer, LabelOperation}),
+		fingerprintMismatches: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "fingerprint_mismatches_total",
+			Help:      "Number of cached values ignored because of a schema fingerprint mismatch.",
+		}, []string{LabelCache, LabelLayer}),
+		backfills: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "backfills_total",
+			Help:      "Number of values written to upper layers after being found in a lower layer.",
+		}, []string{LabelCache, LabelLayer}),
+		evictions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "evictions_total",
+			Help:      "Number of values dropped by memory layers.",
+		}, []string{LabelCache, LabelLayer, LabelReason}),
+		hotness: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "hotness_total",
+			Help:      "Number of values read by their soft-TTL hotness.",
+		}, []string{LabelCache, LabelHotness}),
+		entriesDesc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "layer_entries"),
+			"Number of entries in memory layers.", []string{LabelCache, LabelLayer}, nil),
+		sizeDesc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "layer_size_bytes"),
+			"Memory used by memory layers.", []string{LabelCache, LabelLayer}, nil),
+		queueDepthDesc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "background", "queue_depth"),
+			"Background writes waiting for a worker.", []string{LabelCache}, nil),
+		droppedDesc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "background", "dropped_total"),
+			"Background writes dropped because the queue was full.", []string{LabelCache}, nil),
+		coalescedDesc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "background", "coalesced_total"),
+			"Background writes merged into an identical pending one.", []string{LabelCache}, nil),
+	}
+}
+
+func (pc *prometheusCollector) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		pc.operationDuration, pc.layerOperationDuration, pc.hits, pc.layerMisses, pc.misses, pc.amnesia,
+		pc.errors, pc.fingerprintMismatches, pc.backfills, pc.evictions, pc.hotness,
+	}
+}
+
+// Describe implements prometheus.Collector
+func (pc *prometheusCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range pc.collectors() {
+		c.Describe(ch)
+	}
+	ch <- pc.entriesDesc
+	ch <- pc.sizeDesc
+	ch <- pc.queueDepthDesc
+	ch <- pc.droppedDesc
+	ch <- pc.coalescedDesc
+}
+
+// Collect implements prometheus.Collector
+func (pc *prometheusCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range pc.collectors() {
+		c.Collect(ch)
+	}
+	if pc.mnemosyne == nil {
+		return
+	}
+	for name, instance := range pc.mnemosyne.childs {
+		background := instance.background.stats()
+		ch <- prometheus.MustNewConstMetric(pc.queueDepthDesc, prometheus.GaugeValue, float64(background.QueueDepth), name)
+		ch <- prometheus.MustNewConstMetric(pc.droppedDesc, prometheus.CounterValue, float64(background.Dropped), name)
+		ch <- prometheus.MustNewConstMetric(pc.coalescedDesc, prometheus.CounterValue, float64(background.Coalesced), name)
+		for _, layer := range instance.cacheLayers {
+			statter, ok := unwrapLayer(layer).(layerStatter)
+			if !ok {
+				continue
+			}
+			entries, size := statter.layerStats()
+			ch <- prometheus.MustNewConstMetric(pc.entriesDesc, prometheus.GaugeValue,
+				float64(entries), name, layer.Name())
+			if size >= 0 {
+				ch <- prometheus.MustNewConstMetric(pc.sizeDesc, prometheus.GaugeValue,
+					float64(size), name, layer.Name())
+			}
+		}
+	}
+}
+
+func (pc *prometheusCollector) observeOperation(instance, op string, took time.Duration) {
+	pc.operationDuration.WithLabelValues(instance, op).Observe(took.Seconds())
+}
+
+func (pc *prometheusCollector) observeLayerOperation(instance, layer, op string, err error, took time.Duration) {
+	pc.layerOperationDuration.WithLabelValues(instance, layer, op).Observe(took.Seconds())
+	switch outcomeOf(err) {
+	case outcomeMiss:
+		pc.layerMisses.WithLabelValues(instance, layer).Inc()
+		var mismatch *fingerprintMismatchError
+		if errors.As(err, &mismatch) {
+			pc.fingerprintMismatches.WithLabelValues(instance, layer).Inc()
+		}
+	case outcomeAmnesia:
+		pc.amnesia.WithLabelValues(instance, layer).Inc()
+	case outcomeError:
+		pc.errors.WithLabelValues(instance, layer, op).Inc()
+	}
+}
+
+func (pc *prometheusCollector) observeHit(instance, layer string) {
+	pc.hits.WithLabelValues(instance, layer).Inc()
+}
+
+func (pc *prometheusCollector) observeMiss(instance string) {
+	pc.misses.WithLabelValues(instance).Inc()
+}
+
+func (pc *prometheusCollector) observeBackfill(instance, layer string) {
+	pc.backfills.WithLabelValues(instance, layer).Inc()
+}
+
+func (pc *prometheusCollector) observeEviction(instance, layer, reason string) {
+	pc.evictions.WithLabelValues(instance, layer, reason).Inc()
+}
+
+func (pc *prometheusCollector) observeHotness(instance, hotness string) {
+	pc.hotness.WithLabelValues(instance, hotness).Inc()
+}
@@ -0,0 +1,375 @@
+package mnemosyne
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// StatsWindow is the length of the sliding window of the Window* statistics
+	StatsWindow       = time.Minute
+	statsWindowBucket = time.Second
+	// number of recent samples per operation used for latency percentiles
+	latencySamples = 1024
+)
+
+// LayerStats is a snapshot of the statistics of a single layer,
+// unlike the instance a layer counts a lookup for every read of it (e.g. each read of ShouldUpdateDeep)
+type LayerStats struct {
+	Name          string
+	Lookups       uint64
+	Hits          uint64
+	Misses        uint64
+	AmnesiaMisses uint64
+	Errors        uint64
+	Backfills     uint64
+	// HitRate is the ratio of hits to lookups since the start
+	HitRate float64
+	// WindowHitRate is the ratio of hits to lookups in the last StatsWindow
+	WindowHitRate float64
+}
+
+// LatencyStats is a snapshot of the latency of an operation, percentiles are computed over the most recent calls
+type LatencyStats struct {
+	Count   uint64
+	Average time.Duration
+	P50     time.Duration
+	P90     time.Duration
+	P99     time.Duration
+	Max     time.Duration
+}
+
+// HotnessStats counts the values read by their soft-TTL hotness
+type HotnessStats struct {
+	Hot  uint64
+	Warm uint64
+	Cold uint64
+}
+
+// InstanceStats is a snapshot of the statistics of a cache instance
+type InstanceStats struct {
+	Name   string
+	Layers []LayerStats
+	// Lookups is the number of reads from the instance, each one is either a hit on a layer or a miss
+	Lookups       uint64
+	Hits          uint64
+	Misses        uint64
+	AmnesiaMisses uint64
+	Backfills     uint64
+	HitRate       float64
+	WindowHitRate float64
+	// Errors is the number of failed layer operations by operation (get, set, delete)
+	Errors map[string]uint64
+	// Latency is the latency of the instance's operations by operation (get, set, delete)
+	Latency    map[string]LatencyStats
+	Hotness    HotnessStats
+	Background BackgroundStats
+}
+
+// Stats is a snapshot of the statistics of all cache instances
+type Stats struct {
+	Instances     map[string]InstanceStats
+	Lookups       uint64
+	Hits          uint64
+	Misses        uint64
+	AmnesiaMisses uint64
+	Backfills     uint64
+	HitRate       float64
+	WindowHitRate float64
+	Errors        map[string]uint64
+	Hotness       HotnessStats
+	Background    BackgroundStats
+}
+
+// Stats returns the statistics of the instance since it was created
+func (mn *MnemosyneInstance) Stats() InstanceStats {
+	stats := mn.stats.snapshot()
+	stats.Background = mn.background.stats()
+	return stats
+}
+
+// Stats returns the statistics of all instances, along with their aggregation
+func (m *Mnemosyne) Stats() Stats {
+	total := Stats{
+		Instances: make(map[string]InstanceStats, len(m.childs)),
+		Errors:    make(map[string]uint64),
+	}
+	var windowHits, windowLookups uint64
+	for name, instance := range m.childs {
+		instanceStats := instance.Stats()
+		total.Instances[name] = instanceStats
+		total.Lookups += instanceStats.Lookups
+		total.Hits += instanceStats.Hits
+		total.Misses += instanceStats.Misses
+		total.AmnesiaMisses += instanceStats.AmnesiaMisses
+		total.Backfills += instanceStats.Backfills
+		total.Hotness.Hot += instanceStats.Hotness.Hot
+		total.Hotness.Warm += instanceStats.Hotness.Warm
+		total.Hotness.Cold += instanceStats.Hotness.Cold
+		total.Background.QueueDepth += instanceStats.Background.QueueDepth
+		total.Background.Workers += instanceStats.Background.Workers
+		total.Background.Dropped += instanceStats.Background.Dropped
+		total.Background.Coalesced += instanceStats.Background.Coalesced
+		for op, count := range instanceStats.Errors {
+			total.Errors[op] += count
+		}
+		hits, lookups := instance.stats.window.sum()
+		windowHits += hits
+		windowLookups += lookups
+	}
+	total.HitRate = ratio(total.Hits, total.Lookups)
+	total.WindowHitRate = ratio(windowHits, windowLookups)
+	return total
+}
+
+func ratio(part, whole uint64) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return float64(part) / float64(whole)
+}
+
+// statsRecorder is the observer which keeps the statistics of a single instance in memory
+type statsRecorder struct {
+	// counters come first to keep them 64-bit aligned for atomic operations
+	hits    uint64
+	misses  uint64
+	hot     uint64
+	warm    uint64
+	cold    uint64
+	name    string
+	layers  []string
+	byLayer map[string]*layerCounters
+	errors  map[string]*uint64
+	latency map[string]*latencyRecorder
+	window  *slidingWindow
+}
+
+type layerCounters struct {
+	lookups   uint64
+	hits      uint64
+	misses    uint64
+	amnesia   uint64
+	errors    uint64
+	backfills uint64
+	window    *slidingWindow
+}
+
+func newStatsRecorder(name string, layerNames []string) *statsRecorder {
+	sr := &statsRecorder{
+		name:    name,
+		layers:  layerNames,
+		byLayer: make(map[string]*layerCounters, len(layerNames)),
+		errors:  make(map[string]*uint64),
+		latency: make(map[string]*latencyRecorder),
+		window:  newSlidingWindow(StatsWindow, statsWindowBucket),
+	}
+	for _, layerName := range layerNames {
+		sr.byLayer[layerName] = &layerCounters{window: newSlidingWindow(StatsWindow, statsWindowBucket)}
+	}
+	// operations are known beforehand, so the maps are never written after this
+	for _, op := range []string{"get", "set", "delete"} {
+		sr.errors[op] = new(uint64)
+		sr.latency[op] = &latencyRecorder{}
+	}
+	return sr
+}
+
+func (sr *statsRecorder) observeOperation(instance, op string, took time.Duration) {
+	if recorder, ok := sr.latency[op]; ok {
+		recorder.observe(took)
+	}
+}
+
+func (sr *statsRecorder) observeLayerOperation(instance, layer, op string, err error, took time.Duration) {
+	counters, ok := sr.byLayer[layer]
+	if !ok {
+		return
+	}
+	outcome := outcomeOf(err)
+	if outcome == outcomeError {
+		atomic.AddUint64(&counters.errors, 1)
+		if opErrors, ok := sr.errors[op]; ok {
+			atomic.AddUint64(opErrors, 1)
+		}
+	}
+	if op != "get" {
+		return
+	}
+	atomic.AddUint64(&counters.lookups, 1)
+	counters.window.add(outcome == outcomeOK)
+	switch outcome {
+	case outcomeOK:
+		atomic.AddUint64(&counters.hits, 1)
+	case outcomeMiss:
+		atomic.AddUint64(&counters.misses, 1)
+	case outcomeAmnesia:
+		atomic.AddUint64(&counters.amnesia, 1)
+	}
+}
+
+func (sr *statsRecorder) observeHit(instance, layer string) {
+	atomic.AddUint64(&sr.hits, 1)
+	sr.window.add(true)
+}
+
+func (sr *statsRecorder) observeMiss(instance string) {
+	atomic.AddUint64(&sr.misses, 1)
+	sr.window.add(false)
+}
+
+func (sr *statsRecorder) observeBackfill(instance, layer string) {
+	if counters, ok := sr.byLayer[layer]; ok {
+		atomic.AddUint64(&counters.backfills, 1)
+	}
+}
+
+func (sr *statsRecorder) observeEviction(instance, layer, reason string) {
+}
+
+func (sr *statsRecorder) observeHotness(instance, hotness string) {
+	switch hotness {
+	case "hot":
+		atomic.AddUint64(&sr.hot, 1)
+	case "warm":
+		atomic.AddUint64(&sr.warm, 1)
+	case "cold":
+		atomic.AddUint64(&sr.cold, 1)
+	}
+}
+
+func (sr *statsRecorder) snapshot() InstanceStats {
+	stats := InstanceStats{
+		Name:    sr.name,
+		Layers:  make([]LayerStats, len(sr.layers)),
+		Hits:    atomic.LoadUint64(&sr.hits),
+		Misses:  atomic.LoadUint64(&sr.misses),
+		Errors:  make(map[string]uint64, len(sr.errors)),
+		Latency: make(map[string]LatencyStats, len(sr.latency)),
+		Hotness: HotnessStats{
+			Hot:  atomic.LoadUint64(&sr.hot),
+			Warm: atomic.LoadUint64(&sr.warm),
+			Cold: atomic.LoadUint64(&sr.cold),
+		},
+	}
+	for i, layerName := range sr.layers {
+		counters := sr.byLayer[layerName]
+		layerStats := LayerStats{
+			Name:          layerName,
+			Lookups:       atomic.LoadUint64(&counters.lookups),
+			Hits:          atomic.LoadUint64(&counters.hits),
+			Misses:        atomic.LoadUint64(&counters.misses),
+			AmnesiaMisses: atomic.LoadUint64(&counters.amnesia),
+			Errors:        atomic.LoadUint64(&counters.errors),
+			Backfills:     atomic.LoadUint64(&counters.backfills),
+		}
+		layerStats.HitRate = ratio(layerStats.Hits, layerStats.Lookups)
+		layerStats.WindowHitRate = ratio(counters.window.sum())
+		stats.Layers[i] = layerStats
+		stats.AmnesiaMisses += layerStats.AmnesiaMisses
+		stats.Backfills += layerStats.Backfills
+	}
+	stats.Lookups = stats.Hits + stats.Misses
+	stats.HitRate = ratio(stats.Hits, stats.Lookups)
+	stats.WindowHitRate = ratio(sr.window.sum())
+	for op, count := range sr.errors {
+		stats.Errors[op] = atomic.LoadUint64(count)
+	}
+	for op, recorder := range sr.latency {
+		stats.Latency[op] = recorder.snapshot()
+	}
+	return stats
+}
+
+// slidingWindow counts hits and lookups in time buckets, forgetting the ones older than the window
+type slidingWindow struct {
+	lock       sync.Mutex
+	bucketSize time.Duration
+	epochs     []int64
+	hits       []uint64
+	lookups    []uint64
+}
+
+func newSlidingWindow(window, bucketSize time.Duration) *slidingWindow {
+	buckets := int(window / bucketSize)
+	return &slidingWindow{
+		bucketSize: bucketSize,
+		epochs:     make([]int64, buckets),
+		hits:       make([]uint64, buckets),
+		lookups:    make([]uint64, buckets),
+	}
+}
+
+func (sw *slidingWindow) add(hit bool) {
+	epoch := time.Now().UnixNano() / int64(sw.bucketSize)
+	slot := int(epoch % int64(len(sw.epochs)))
+	sw.lock.Lock()
+	defer sw.lock.Unlock()
+	if sw.epochs[slot] != epoch {
+		sw.epochs[slot], sw.hits[slot], sw.lookups[slot] = epoch, 0, 0
+	}
+	sw.lookups[slot]++
+	if hit {
+		sw.hits[slot]++
+	}
+}
+
+func (sw *slidingWindow) sum() (hits uint64, lookups uint64) {
+	oldest := time.Now().UnixNano()/int64(sw.bucketSize) - int64(len(sw.epochs))
+	sw.lock.Lock()
+	defer sw.lock.Unlock()
+	for slot, epoch := range sw.epochs {
+		if epoch > oldest {
+			hits += sw.hits[slot]
+			lookups += sw.lookups[slot]
+		}
+	}
+	return hits, lookups
+}
+
+// latencyRecorder keeps the count and total of all samples along with the most recent ones
+type latencyRecorder struct {
+	lock    sync.Mutex
+	count   uint64
+	total   time.Duration
+	samples []time.Duration
+	next    int
+}
+
+func (lr *latencyRecorder) observe(took time.Duration) {
+	lr.lock.Lock()
+	defer lr.lock.Unlock()
+	lr.count++
+	lr.total += took
+	if len(lr.samples) < latencySamples {
+		lr.samples = append(lr.samples, took)
+		return
+	}
+	lr.samples[lr.next] = took
+	lr.next = (lr.next + 1) % latencySamples
+}
+
+func (lr *latencyRecorder) snapshot() LatencyStats {
+	lr.lock.Lock()
+	stats := LatencyStats{Count: lr.count}
+	if lr.count > 0 {
+		stats.Average = lr.total / time.Duration(lr.count)
+	}
+	samples := append([]time.Duration(nil), lr.samples...)
+	lr.lock.Unlock()
+
+	if len(samples) == 0 {
+		return stats
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	percentile := func(p float64) time.Duration {
+		return samples[int(p*float64(len(samples)-1))]
+	}
+	stats.P50 = percentile(0.5)
+	stats.P90 = percentile(0.9)
+	stats.P99 = percentile(0.99)
+	stats.Max = samples[len(samples)-1]
+	return stats
+}
@@ -0,0 +1,137 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mghayour/mnemosyne"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func newAdminTestCache(t *testing.T, opts ...mnemosyne.AdminOption) (*mnemosyne.Mnemosyne, http.Handler, *recordingLogger) {
+	config := viper.New()
+	config.Set("cache.admin.soft-ttl", "2h")
+	config.Set("cache.admin.layers", []string{"admin-tiny", "admin-memory"})
+	config.Set("cache.admin.admin-tiny.type", "tiny")
+	config.Set("cache.admin.admin-memory.type", "memory")
+	config.Set("cache.admin.admin-memory.ttl", "1h")
+	config.Set("cache.admin.admin-memory.max-memory", 16)
+	logger := &recordingLogger{}
+	manager := mnemosyne.NewMnemosyne(config, nil, nil, mnemosyne.WithLogger(logger))
+	t.Cleanup(func() { manager.Close(context.Background()) })
+	return manager, mnemosyne.NewAdminHandler(manager, opts...), logger
+}
+
+func serveAdmin(handler http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return recorder
+}
+
+func TestAdminInspection(t *testing.T) {
+	manager, handler, _ := newAdminTestCache(t, mnemosyne.WithAdminAuthorizer(func(r *http.Request) error {
+		return nil
+	}))
+	cacheInstance := manager.Select("admin")
+	ctx := context.Background()
+	assert.Nil(t, cacheInstance.Set(ctx, "user", &TestTypeUser{UserName: "admin"}))
+	_, err := cacheInstance.Get(ctx, "user", &TestTypeUser{})
+	assert.Nil(t, err)
+
+	res := serveAdmin(handler, http.MethodGet, "/instances", "")
+	assert.Equal(t, http.StatusOK, res.Code)
+	var instances []mnemosyne.AdminInstance
+	assert.Nil(t, json.Unmarshal(res.Body.Bytes(), &instances))
+	assert.Len(t, instances, 1)
+	assert.Equal(t, "admin", instances[0].Name)
+	assert.Equal(t, uint64(1), instances[0].Hits)
+	assert.Equal(t, "admin-tiny", instances[0].Layers[0].Name)
+	assert.Equal(t, uint64(1), instances[0].Layers[0].Hits)
+
+	res = serveAdmin(handler, http.MethodGet, "/instances/admin/entry?key=user", "")
+	assert.Equal(t, http.StatusOK, res.Code)
+	var explanation mnemosyne.Explanation
+	assert.Nil(t, json.Unmarshal(res.Body.Bytes(), &explanation))
+	assert.Equal(t, 0, explanation.ServedBy)
+	var decoded TestTypeUser
+	assert.Nil(t, json.Unmarshal(explanation.Layers[1].Value, &decoded))
+	assert.Equal(t, "admin", decoded.UserName)
+
+	assert.Equal(t, http.StatusNotFound, serveAdmin(handler, http.MethodGet, "/instances/unknown", "").Code)
+	assert.Equal(t, http.StatusBadRequest, serveAdmin(handler, http.MethodGet, "/instances/admin/entry", "").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, serveAdmin(handler, http.MethodPost, "/instances", "").Code)
+}
+
+func TestAdminMutationsRequireAuthorization(t *testing.T) {
+	manager, handler, logger := newAdminTestCache(t)
+	assert.Nil(t, manager.Select("admin").Set(context.Background(), "user", &TestTypeUser{}))
+
+	res := serveAdmin(handler, http.MethodDelete, "/instances/admin/entry?key=user", "")
+	assert.Equal(t, http.StatusForbidden, res.Code)
+	_, err := manager.Select("admin").Get(context.Background(), "user", &TestTypeUser{})
+	assert.Nil(t, err)
+	assert.Len(t, logger.logs, 1)
+	assert.Equal(t, "info", logger.logs[0].level)
+	assert.Equal(t, "delete (denied)", logger.logs[0].fields["action"])
+
+	_, handler, _ = newAdminTestCache(t, mnemosyne.WithAdminAuthorizer(func(r *http.Request) error {
+		return errors.New("not an admin")
+	}))
+	res = serveAdmin(handler, http.MethodPost, "/instances/admin/layers/admin-tiny/flush", "")
+	assert.Equal(t, http.StatusForbidden, res.Code)
+	assert.Contains(t, res.Body.String(), "not an admin")
+}
+
+func TestAdminEntryRequiresAuthorization(t *testing.T) {
+	manager, handler, logger := newAdminTestCache(t)
+	assert.Nil(t, manager.Select("admin").Set(context.Background(), "user", &TestTypeUser{UserName: "secret"}))
+
+	res := serveAdmin(handler, http.MethodGet, "/instances/admin/entry?key=user", "")
+	assert.Equal(t, http.StatusForbidden, res.Code)
+	assert.NotContains(t, res.Body.String(), "secret")
+	assert.Equal(t, "read-entry (denied)", logger.logs[len(logger.logs)-1].fields["action"])
+
+	// the listings don't reveal values, so they stay open
+	assert.Equal(t, http.StatusOK, serveAdmin(handler, http.MethodGet, "/instances", "").Code)
+}
+
+func TestAdminMutations(t *testing.T) {
+	manager, handler, logger := newAdminTestCache(t, mnemosyne.WithAdminAuthorizer(func(r *http.Request) error {
+		return nil
+	}))
+	cacheInstance := manager.Select("admin")
+	ctx := context.Background()
+	assert.Nil(t, cacheInstance.Set(ctx, "user", &TestTypeUser{}))
+
+	res := serveAdmin(handler, http.MethodPut, "/instances/admin/layers/admin-tiny/amnesia", `{"chance": 100}`)
+	assert.Equal(t, http.StatusNoContent, res.Code)
+	entry, err := cacheInstance.GetEntry(ctx, "user", &TestTypeUser{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, entry.Layer)
+	assert.Equal(t, http.StatusBadRequest,
+		serveAdmin(handler, http.MethodPut, "/instances/admin/layers/admin-tiny/amnesia", `{"chance": 101}`).Code)
+
+	res = serveAdmin(handler, http.MethodPost, "/instances/admin/layers/admin-memory/flush", "")
+	assert.Equal(t, http.StatusNoContent, res.Code)
+	assert.Equal(t, http.StatusNotFound,
+		serveAdmin(handler, http.MethodPost, "/instances/admin/layers/unknown/flush", "").Code)
+
+	res = serveAdmin(handler, http.MethodDelete, "/instances/admin/entry?key=user", "")
+	assert.Equal(t, http.StatusNoContent, res.Code)
+	_, err = cacheInstance.Get(ctx, "user", &TestTypeUser{})
+	assert.True(t, errors.Is(err, mnemosyne.ErrMiss))
+
+	var actions []interface{}
+	for _, log := range logger.logs {
+		if log.msg == "mnemosyne admin call" {
+			actions = append(actions, log.fields["action"])
+		}
+	}
+	assert.Equal(t, []interface{}{"set-amnesia", "set-amnesia", "flush", "delete"}, actions)
+}
@@ -2,10 +2,11 @@ package tests
 
 import (
 	"context"
+	"errors"
+	"strings"
 	"testing"
 	"time"
 
-	"bou.ke/monkey"
 	"github.com/alicebob/miniredis"
 	"github.com/mghayour/mnemosyne"
 	"github.com/spf13/viper"
@@ -39,16 +40,42 @@ func newTestRedis() string {
 	return mr.Addr()
 }
 
-func setUp() *mnemosyne.MnemosyneInstance {
+func setUp(opts ...mnemosyne.Option) *mnemosyne.MnemosyneInstance {
 	config := NewConfig()
 	addr := newTestRedis()
 	config.SetDefault("cache.result.user-redis.address", addr)
-	mnemosyneManager := mnemosyne.NewMnemosyne(config, nil, nil)
+	mnemosyneManager := mnemosyne.NewMnemosyne(config, nil, nil, opts...)
 	cacheInstance := mnemosyneManager.Select("result")
 	return cacheInstance
 }
+
+// newTestInstance creates an instance named name with a single layer of layerType, named "<name>-<layerType>",
+// and closes it when the test ends. The settings are relative to the instance (e.g. soft-ttl, default 1h),
+// those prefixed with "layer." to the layer (e.g. layer.ttl)
+func newTestInstance(t *testing.T, name, layerType string, settings map[string]interface{}, opts ...mnemosyne.Option) *mnemosyne.MnemosyneInstance {
+	layer := name + "-" + layerType
+	config := viper.New()
+	config.Set("cache."+name+".soft-ttl", "1h")
+	config.Set("cache."+name+".layers", []string{layer})
+	config.Set("cache."+name+"."+layer+".type", layerType)
+	for key, value := range settings {
+		if strings.HasPrefix(key, "layer.") {
+			config.Set("cache."+name+"."+layer+"."+strings.TrimPrefix(key, "layer."), value)
+		} else {
+			config.Set("cache."+name+"."+key, value)
+		}
+	}
+	return closeOnCleanup(t, mnemosyne.NewMnemosyne(config, nil, nil, opts...).Select(name))
+}
+
+// closeOnCleanup closes instance when the test ends
+func closeOnCleanup(t *testing.T, instance *mnemosyne.MnemosyneInstance) *mnemosyne.MnemosyneInstance {
+	t.Cleanup(func() { instance.Close(context.Background()) })
+	return instance
+}
 func TestGetAndShouldUpdate(t *testing.T) {
-	cacheInstance := setUp()
+	clock := mnemosyne.NewFakeClock(time.Now())
+	cacheInstance := setUp(mnemosyne.WithClock(clock))
 
 	cacheCtx, cacheCancelFunc := context.WithTimeout(context.Background(), 50*time.Millisecond)
 	defer cacheCancelFunc()
@@ -71,12 +98,53 @@ func TestGetAndShouldUpdate(t *testing.T) {
 	assert.Equal(t, nil, err)
 	assert.Equal(t, false, shouldUpdate)
 
-	wayback := time.Now().Add(time.Hour * 3)
-	patch := monkey.Patch(time.Now, func() time.Time { return wayback })
-	defer patch.Unpatch()
-	patch2 := monkey.Patch(time.Since, func(t time.Time) time.Duration { return time.Hour * 3 })
-	defer patch2.Unpatch()
+	clock.Advance(time.Hour * 3)
 
 	_, shouldUpdate, _ = cacheInstance.GetAndShouldUpdate(cacheCtx, "test_item1", &TestTypeUser{})
 	assert.Equal(t, true, shouldUpdate)
 }
+
+// fixedRandom rolls the same number every time
+type fixedRandom int
+
+func (r fixedRandom) Intn(n int) int {
+	return int(r) % n
+}
+
+func TestAmnesiaRolls(t *testing.T) {
+	config := viper.New()
+	config.Set("cache.forgetful.soft-ttl", "2h")
+	config.Set("cache.forgetful.layers", []string{"forgetful-tiny"})
+	config.Set("cache.forgetful.forgetful-tiny.type", "tiny")
+	config.Set("cache.forgetful.forgetful-tiny.amnesia", 30)
+	ctx := context.Background()
+
+	remembering := mnemosyne.NewMnemosyne(config, nil, nil, mnemosyne.WithRandomSource(fixedRandom(30))).Select("forgetful")
+	assert.Nil(t, remembering.Set(ctx, "user", &TestTypeUser{UserName: "amnesia"}))
+	_, err := remembering.Get(ctx, "user", &TestTypeUser{})
+	assert.Nil(t, err)
+
+	forgetting := mnemosyne.NewMnemosyne(config, nil, nil, mnemosyne.WithRandomSource(fixedRandom(29))).Select("forgetful")
+	assert.Nil(t, forgetting.Set(ctx, "user", &TestTypeUser{UserName: "amnesia"}))
+	_, err = forgetting.Get(ctx, "user", &TestTypeUser{})
+	assert.True(t, errors.Is(err, mnemosyne.ErrAmnesia))
+}
+
+func TestFakeClockAges(t *testing.T) {
+	clock := mnemosyne.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	cacheInstance := setUp(mnemosyne.WithClock(clock))
+	ctx := context.Background()
+	assert.Nil(t, cacheInstance.Set(ctx, "user", &TestTypeUser{}))
+	clock.Advance(time.Hour)
+
+	entry, err := cacheInstance.GetEntry(ctx, "user", &TestTypeUser{})
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), entry.Time.UTC())
+	assert.Equal(t, time.Hour, entry.Age)
+	assert.False(t, entry.Stale)
+
+	clock.Advance(time.Hour + time.Second)
+	shouldUpdate, err := cacheInstance.ShouldUpdateDeep(ctx, "user", &TestTypeUser{})
+	assert.Nil(t, err)
+	assert.True(t, shouldUpdate)
+}
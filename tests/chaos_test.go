@@ -0,0 +1,114 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mghayour/mnemosyne"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func newChaosConfig() *viper.Viper {
+	config := viper.New()
+	config.Set("cache.chaotic.soft-ttl", "2h")
+	config.Set("cache.chaotic.layers", []string{"chaotic-tiny", "chaotic-fast"})
+	config.Set("cache.chaotic.chaotic-tiny.type", "tiny")
+	config.Set("cache.chaotic.chaotic-tiny.chaos.error", 100)
+	config.Set("cache.chaotic.chaotic-fast.type", "fastmemory")
+	config.Set("cache.chaotic.chaotic-fast.ttl", "1h")
+	return config
+}
+
+func TestChaosFromConfig(t *testing.T) {
+	cacheInstance := closeOnCleanup(t, mnemosyne.NewMnemosyne(newChaosConfig(), nil, nil).Select("chaotic"))
+	ctx := context.Background()
+
+	err := cacheInstance.Set(ctx, "user", &TestTypeUser{UserName: "chaos"})
+	assert.True(t, errors.Is(err, mnemosyne.ErrLayerUnavailable))
+	var layerErr *mnemosyne.LayerError
+	assert.True(t, errors.As(err, &layerErr))
+	assert.Equal(t, "chaotic-tiny", layerErr.Layer)
+
+	// the failing layer is skipped, like a Redis layer which is down
+	entry, err := cacheInstance.GetEntry(ctx, "user", &TestTypeUser{})
+	assert.Nil(t, err)
+	assert.Equal(t, "chaotic-fast", entry.LayerName)
+	assert.Equal(t, "chaos", entry.Value.(*TestTypeUser).UserName)
+
+	chaos, err := cacheInstance.Chaos("chaotic-tiny")
+	assert.Nil(t, err)
+	assert.Equal(t, mnemosyne.ChaosConfig{ErrorChance: 100}, chaos)
+	_, err = cacheInstance.Chaos("chaotic-fast")
+	assert.NotNil(t, err, "layers without a chaos block don't inject faults")
+	assert.NotNil(t, cacheInstance.SetChaos("chaotic-fast", mnemosyne.ChaosConfig{ErrorChance: 1}))
+	assert.NotNil(t, cacheInstance.SetChaos("chaotic-tiny", mnemosyne.ChaosConfig{ErrorChance: 101}))
+}
+
+func TestChaosAtRuntime(t *testing.T) {
+	cacheInstance := closeOnCleanup(t, mnemosyne.NewMnemosyne(newChaosConfig(), nil, nil).Select("chaotic"))
+	ctx := context.Background()
+	tiny, err := cacheInstance.Layer("chaotic-tiny")
+	assert.Nil(t, err)
+
+	assert.Nil(t, cacheInstance.SetChaos("chaotic-tiny", mnemosyne.ChaosConfig{DropWriteChance: 100}))
+	assert.Nil(t, cacheInstance.Set(ctx, "user", &TestTypeUser{UserName: "chaos"}))
+	assert.False(t, tiny.Explain(ctx, "user").Present, "the write was dropped")
+
+	assert.Nil(t, cacheInstance.SetChaos("chaotic-tiny", mnemosyne.ChaosConfig{CorruptChance: 100}))
+	assert.Nil(t, tiny.Set(ctx, "user", &TestTypeUser{UserName: "chaos"}))
+	_, err = tiny.Cache().Get(ctx, "user", &TestTypeUser{})
+	assert.True(t, errors.Is(err, mnemosyne.ErrDecode))
+	assert.True(t, tiny.Explain(ctx, "user").Decoded, "explaining bypasses the faults")
+
+	assert.Nil(t, cacheInstance.SetChaos("chaotic-tiny", mnemosyne.ChaosConfig{TimeoutChance: 100, TimeoutAfter: time.Minute}))
+	timeoutCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = tiny.Delete(timeoutCtx, "user")
+	assert.True(t, errors.Is(err, mnemosyne.ErrTimeout))
+	assert.True(t, time.Since(start) < time.Minute, "the operation hangs until the context is done")
+
+	assert.Nil(t, cacheInstance.SetChaos("chaotic-tiny", mnemosyne.ChaosConfig{Latency: 30 * time.Millisecond, LatencyChance: 100}))
+	start = time.Now()
+	_, err = tiny.Cache().Get(ctx, "user", &TestTypeUser{})
+	assert.Nil(t, err)
+	assert.True(t, time.Since(start) >= 30*time.Millisecond)
+}
+
+func TestChaosAdmin(t *testing.T) {
+	manager := mnemosyne.NewMnemosyne(newChaosConfig(), nil, nil)
+	t.Cleanup(func() { manager.Close(context.Background()) })
+	handler := mnemosyne.NewAdminHandler(manager, mnemosyne.WithAdminAuthorizer(func(r *http.Request) error { return nil }))
+
+	res := serveAdmin(handler, http.MethodPut, "/instances/chaotic/layers/chaotic-tiny/chaos",
+		`{"error": 5, "latency": "50ms", "latency_chance": 20}`)
+	assert.Equal(t, http.StatusNoContent, res.Code)
+	res = serveAdmin(handler, http.MethodPut, "/instances/chaotic/layers/chaotic-fast/chaos", `{"error": 5}`)
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+
+	res = serveAdmin(handler, http.MethodGet, "/instances/chaotic", "")
+	var instance mnemosyne.AdminInstance
+	assert.Nil(t, json.Unmarshal(res.Body.Bytes(), &instance))
+	assert.Equal(t, &mnemosyne.ChaosConfig{ErrorChance: 5, Latency: 50 * time.Millisecond, LatencyChance: 20}, instance.Layers[0].Chaos)
+	assert.Nil(t, instance.Layers[1].Chaos)
+}
+
+func TestValidateChaosConfig(t *testing.T) {
+	config := newChaosConfig()
+	config.Set("cache.chaotic.chaotic-tiny.chaos.corrupt", 200)
+	config.Set("cache.chaotic.chaotic-tiny.chaos.latency", "fast")
+	var problems []string
+	for _, problem := range mnemosyne.ValidateConfig(config) {
+		problems = append(problems, problem.Key)
+	}
+	assert.Equal(t, []string{
+		"cache.chaotic.chaotic-tiny.chaos",
+		"cache.chaotic.chaotic-tiny.chaos.corrupt",
+		"cache.chaotic.chaotic-tiny.chaos.latency",
+	}, problems)
+}
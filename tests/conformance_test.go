@@ -0,0 +1,98 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis"
+	"github.com/mghayour/mnemosyne"
+	"github.com/mghayour/mnemosyne/cachetest"
+	"github.com/spf13/viper"
+)
+
+// conformanceFactory creates a single layer instance of layerType for each compression setting,
+// and hands it to the suite after clearing it. Only one instance is kept at a time, as each memory layer
+// preallocates hundreds of megabytes
+func conformanceFactory(t *testing.T, layerType string, configure func(config *viper.Viper, keyPrefix string)) (cachetest.Factory, func()) {
+	var manager *mnemosyne.Mnemosyne
+	var managerCompression, used bool
+	closeAll := func() {
+		if manager != nil {
+			manager.Close(context.Background())
+		}
+	}
+	factory := func(t *testing.T, compression bool) mnemosyne.ICache {
+		if manager == nil || managerCompression != compression {
+			closeAll()
+			config := viper.New()
+			config.Set("cache.conformance.soft-ttl", "2h")
+			config.Set("cache.conformance.layers", []string{"conformance-layer"})
+			config.Set("cache.conformance.conformance-layer.type", layerType)
+			config.Set("cache.conformance.conformance-layer.ttl", "1h")
+			config.Set("cache.conformance.conformance-layer.compression", compression)
+			configure(config, "cache.conformance.conformance-layer")
+			manager = mnemosyne.NewMnemosyne(config, nil, nil)
+			managerCompression, used = compression, false
+		}
+		layer, err := manager.Select("conformance").Layer("conformance-layer")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if used {
+			if err := layer.Cache().Clear(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		used = true
+		return layer.Cache()
+	}
+	return factory, closeAll
+}
+
+func TestLayerConformance(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	layers := []struct {
+		layerType string
+		configure func(config *viper.Viper, keyPrefix string)
+		options   cachetest.Options
+	}{
+		{"tiny", func(config *viper.Viper, keyPrefix string) {}, cachetest.Options{}},
+		{"memory", func(config *viper.Viper, keyPrefix string) {
+			// bigcache splits max-memory between 1024 shards, and an entry must fit in one
+			config.Set(keyPrefix+".max-memory", 512)
+		}, cachetest.Options{MaxValueSize: 256 << 10}},
+		{"fastmemory", func(config *viper.Viper, keyPrefix string) {
+			config.Set(keyPrefix+".value-mode", mnemosyne.ValueModeCodec)
+		}, cachetest.Options{TTL: time.Hour, ReportsTTL: true}},
+		{"redis", func(config *viper.Viper, keyPrefix string) {
+			config.Set(keyPrefix+".address", mr.Addr())
+		}, cachetest.Options{TTL: time.Hour, ReportsTTL: true}},
+		{"rediscluster", func(config *viper.Viper, keyPrefix string) {
+			config.Set(keyPrefix+".cluster", []map[string]interface{}{{"address": mr.Addr()}})
+			config.Set(keyPrefix+".db", 1)
+		}, cachetest.Options{TTL: time.Hour, ReportsTTL: true}},
+	}
+	for _, layer := range layers {
+		layer := layer
+		t.Run(fmt.Sprintf("type=%s", layer.layerType), func(t *testing.T) {
+			factory, closeAll := conformanceFactory(t, layer.layerType, layer.configure)
+			defer closeAll()
+			cachetest.Run(t, factory, layer.options)
+		})
+	}
+}
+
+func TestLayerConformanceWithEncryption(t *testing.T) {
+	factory, closeAll := conformanceFactory(t, "tiny", func(config *viper.Viper, keyPrefix string) {
+		config.Set(keyPrefix+".encryption.primary", "key-1")
+		config.Set(keyPrefix+".encryption.keys", map[string]string{"key-1": "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="})
+	})
+	defer closeAll()
+	cachetest.Run(t, factory, cachetest.Options{})
+}
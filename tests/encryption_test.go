@@ -0,0 +1,68 @@
+package tests
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis"
+	"github.com/mghayour/mnemosyne"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testKeyOne = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+	testKeyTwo = "ZmVkY2JhOTg3NjU0MzIxMGZlZGNiYTk4NzY1NDMyMTA="
+)
+
+func newEncryptedConfig(addr string, primary string, keys map[string]string) *viper.Viper {
+	config := viper.New()
+	config.Set("cache.profile.soft-ttl", "2h")
+	config.Set("cache.profile.layers", []string{"profile-redis"})
+	config.Set("cache.profile.profile-redis", map[string]interface{}{
+		"type":        "redis",
+		"address":     addr,
+		"ttl":         "1h",
+		"compression": true,
+		"encryption": map[string]interface{}{
+			"primary": primary,
+			"keys":    keys,
+		},
+	})
+	return config
+}
+
+func TestEncryptionKeyRotation(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	ctx := context.Background()
+
+	writer := closeOnCleanup(t, mnemosyne.NewMnemosyne(newEncryptedConfig(mr.Addr(), "k1",
+		map[string]string{"k1": testKeyOne}), nil, nil).Select("profile"))
+	profile := TestTypeUser{UserName: "secret-user", Meta: map[string]string{"phone": "0912"}}
+	assert.Nil(t, writer.Set(ctx, "user-1", &profile))
+
+	stored, err := mr.Get("user-1")
+	assert.Nil(t, err)
+	assert.False(t, strings.Contains(stored, "secret-user"))
+
+	rotated := closeOnCleanup(t, mnemosyne.NewMnemosyne(newEncryptedConfig(mr.Addr(), "k2",
+		map[string]string{"k1": testKeyOne, "k2": testKeyTwo}), nil, nil).Select("profile"))
+	var result TestTypeUser
+	_, err = rotated.Get(ctx, "user-1", &result)
+	assert.Nil(t, err)
+	assert.Equal(t, profile, result)
+
+	retired := closeOnCleanup(t, mnemosyne.NewMnemosyne(newEncryptedConfig(mr.Addr(), "k2",
+		map[string]string{"k2": testKeyTwo}), nil, nil).Select("profile"))
+	_, err = retired.Get(ctx, "user-1", &TestTypeUser{})
+	assert.NotNil(t, err)
+
+	assert.Nil(t, rotated.Set(ctx, "user-1", &profile))
+	_, err = retired.Get(ctx, "user-1", &result)
+	assert.Nil(t, err)
+}
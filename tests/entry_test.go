@@ -0,0 +1,51 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis"
+	"github.com/mghayour/mnemosyne"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetEntryMetadata(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	config := viper.New()
+	config.Set("cache.entry.soft-ttl", "2h")
+	config.Set("cache.entry.layers", []string{"entry-tiny", "entry-redis"})
+	config.Set("cache.entry.entry-tiny.type", "tiny")
+	config.Set("cache.entry.entry-redis.type", "redis")
+	config.Set("cache.entry.entry-redis.address", mr.Addr())
+	config.Set("cache.entry.entry-redis.ttl", "1h")
+	cacheInstance := mnemosyne.NewMnemosyne(config, nil, nil).Select("entry")
+	ctx := context.Background()
+
+	user := TestTypeUser{UserName: "entry"}
+	assert.Nil(t, cacheInstance.Set(ctx, "user", &user))
+	assert.Nil(t, cacheInstance.Flush("entry-tiny"))
+
+	var result TestTypeUser
+	entry, err := cacheInstance.GetEntry(ctx, "user", &result)
+	assert.Nil(t, err)
+	assert.Equal(t, &result, entry.Value)
+	assert.Equal(t, user, result)
+	assert.Equal(t, 1, entry.Layer)
+	assert.Equal(t, "entry-redis", entry.LayerName)
+	assert.True(t, entry.Backfilled)
+	assert.False(t, entry.Stale)
+	assert.Equal(t, time.Hour, entry.TTL)
+	assert.True(t, entry.Age < time.Minute)
+
+	assert.Eventually(t, func() bool {
+		entry, err = cacheInstance.GetEntry(ctx, "user", &TestTypeUser{})
+		return err == nil && entry.Layer == 0
+	}, time.Second, 10*time.Millisecond)
+	assert.False(t, entry.Backfilled)
+}
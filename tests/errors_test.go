@@ -0,0 +1,100 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/alicebob/miniredis"
+	"github.com/mghayour/mnemosyne"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func newErrorsInstance(t *testing.T, redisAddr string) *mnemosyne.MnemosyneInstance {
+	config := viper.New()
+	config.Set("cache.errors.soft-ttl", "2h")
+	config.Set("cache.errors.layers", []string{"errors-tiny", "errors-redis"})
+	config.Set("cache.errors.errors-tiny.type", "tiny")
+	config.Set("cache.errors.errors-redis.type", "redis")
+	config.Set("cache.errors.errors-redis.address", redisAddr)
+	return closeOnCleanup(t, mnemosyne.NewMnemosyne(config, nil, nil).Select("errors"))
+}
+
+func TestMissErrorsAreInspectable(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	cacheInstance := newErrorsInstance(t, mr.Addr())
+	ctx := context.Background()
+
+	_, shouldUpdate, err := cacheInstance.GetAndShouldUpdate(ctx, "absent", &TestTypeUser{})
+	assert.True(t, errors.Is(err, mnemosyne.ErrMiss))
+	assert.False(t, errors.Is(err, mnemosyne.ErrLayerUnavailable))
+	assert.True(t, shouldUpdate)
+
+	var layerErr *mnemosyne.LayerError
+	assert.True(t, errors.As(err, &layerErr))
+	assert.Equal(t, "errors-tiny", layerErr.Layer)
+
+	assert.Nil(t, cacheInstance.Set(ctx, "string", "not a user"))
+	_, err = cacheInstance.Get(ctx, "string", &TestTypeUser{})
+	assert.True(t, errors.Is(err, mnemosyne.ErrDecode))
+}
+
+func TestUnavailableLayerErrors(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cacheInstance := newErrorsInstance(t, mr.Addr())
+	mr.Close()
+	ctx := context.Background()
+
+	_, shouldUpdate, err := cacheInstance.GetAndShouldUpdate(ctx, "absent", &TestTypeUser{})
+	assert.False(t, errors.Is(err, mnemosyne.ErrMiss), "a layer being down isn't a miss")
+	assert.True(t, errors.Is(err, mnemosyne.ErrLayerUnavailable))
+	assert.False(t, shouldUpdate)
+
+	err = cacheInstance.Set(ctx, "key", &TestTypeUser{})
+	assert.True(t, errors.Is(err, mnemosyne.ErrLayerUnavailable))
+	var multiErr *mnemosyne.MultiError
+	assert.True(t, errors.As(err, &multiErr))
+	assert.Len(t, multiErr.Errors, 1)
+}
+
+func TestAllLayersDownIsNotAMiss(t *testing.T) {
+	config := viper.New()
+	config.Set("cache.down.soft-ttl", "2h")
+	config.Set("cache.down.layers", []string{"down-first", "down-second"})
+	for _, layer := range []string{"down-first", "down-second"} {
+		mr, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		config.Set("cache.down."+layer+".type", "redis")
+		config.Set("cache.down."+layer+".address", mr.Addr())
+		mr.Close()
+	}
+	cacheInstance := mnemosyne.NewMnemosyne(config, nil, nil).Select("down")
+	ctx := context.Background()
+
+	_, shouldUpdate, err := cacheInstance.GetAndShouldUpdate(ctx, "key", &TestTypeUser{})
+	assert.False(t, shouldUpdate, "an outage mustn't send every caller to the origin")
+	assert.False(t, errors.Is(err, mnemosyne.ErrMiss))
+	assert.True(t, errors.Is(err, mnemosyne.ErrLayerUnavailable))
+	var miss *mnemosyne.ErrCacheMiss
+	if assert.True(t, errors.As(err, &miss)) {
+		assert.Len(t, miss.Errors, 2)
+	}
+
+	_, errs := cacheInstance.GetEntries(ctx, []string{"a", "b"}, []interface{}{&TestTypeUser{}, &TestTypeUser{}})
+	for _, err := range errs {
+		assert.False(t, errors.Is(err, mnemosyne.ErrMiss))
+	}
+	values, err := mnemosyne.Typed[*TestTypeUser](cacheInstance).MGet(ctx, "a", "b")
+	assert.Empty(t, values)
+	assert.True(t, errors.Is(err, mnemosyne.ErrLayerUnavailable), "MGet reports the outage")
+}
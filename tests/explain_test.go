@@ -0,0 +1,92 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis"
+	"github.com/mghayour/mnemosyne"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExplain(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	config := viper.New()
+	config.Set("cache.explain.soft-ttl", "2h")
+	config.Set("cache.explain.layers", []string{"explain-tiny", "explain-redis"})
+	config.Set("cache.explain.explain-tiny.type", "tiny")
+	config.Set("cache.explain.explain-tiny.amnesia", 100)
+	config.Set("cache.explain.explain-redis.type", "redis")
+	config.Set("cache.explain.explain-redis.address", mr.Addr())
+	config.Set("cache.explain.explain-redis.ttl", "1h")
+	config.Set("cache.explain.explain-redis.compression", true)
+	cacheInstance := mnemosyne.NewMnemosyne(config, nil, nil).Select("explain")
+	ctx := context.Background()
+
+	user := TestTypeUser{UserName: "explain"}
+	assert.Nil(t, cacheInstance.Set(ctx, "user", &user))
+
+	explanation, err := cacheInstance.Explain(ctx, "user")
+	assert.Nil(t, err)
+	assert.Equal(t, "explain", explanation.Instance)
+	assert.Len(t, explanation.Layers, 2)
+	// the tiny layer always forgets on Get, but Explain ignores amnesia
+	assert.Equal(t, 0, explanation.ServedBy)
+	assert.False(t, explanation.Stale)
+
+	tiny := explanation.Layers[0]
+	assert.Equal(t, "explain-tiny", tiny.Name)
+	assert.True(t, tiny.Present)
+	assert.True(t, tiny.Decoded)
+	assert.False(t, tiny.Compressed)
+	assert.Equal(t, -1, tiny.Shard)
+
+	redisLayer := explanation.Layers[1]
+	assert.Equal(t, 1, redisLayer.Index)
+	assert.True(t, redisLayer.Present)
+	assert.True(t, redisLayer.Decoded)
+	assert.True(t, redisLayer.Compressed)
+	assert.True(t, redisLayer.PayloadSize > 0)
+	assert.Equal(t, time.Hour, redisLayer.TTL)
+	assert.Equal(t, 0, redisLayer.Shard)
+	assert.Equal(t, "master", redisLayer.Replica)
+	assert.Equal(t, mr.Addr(), redisLayer.Address)
+	assert.True(t, redisLayer.Age < time.Minute)
+	var decoded TestTypeUser
+	assert.Nil(t, json.Unmarshal(redisLayer.Value, &decoded))
+	assert.Equal(t, user, decoded)
+}
+
+func TestExplainUndecodablePayload(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	config := viper.New()
+	config.Set("cache.explain.layers", []string{"explain-redis"})
+	config.Set("cache.explain.explain-redis.type", "redis")
+	config.Set("cache.explain.explain-redis.address", mr.Addr())
+	config.Set("cache.explain.explain-redis.compression", true)
+	cacheInstance := mnemosyne.NewMnemosyne(config, nil, nil).Select("explain")
+	mr.Set("broken", "not zlib")
+
+	explanation, err := cacheInstance.Explain(context.Background(), "broken")
+	assert.Nil(t, err)
+	assert.Equal(t, -1, explanation.ServedBy)
+	assert.True(t, explanation.Layers[0].Present)
+	assert.False(t, explanation.Layers[0].Decoded)
+	assert.Contains(t, explanation.Layers[0].DecodeError, "decompress")
+
+	explanation, err = cacheInstance.Explain(context.Background(), "missing")
+	assert.Nil(t, err)
+	assert.False(t, explanation.Layers[0].Present)
+	assert.Empty(t, explanation.Layers[0].Error)
+}
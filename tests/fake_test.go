@@ -0,0 +1,144 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mghayour/mnemosyne"
+	"github.com/mghayour/mnemosyne/mnemosynetest"
+	"github.com/stretchr/testify/assert"
+)
+
+// userService is the kind of code the fake is meant for, it only knows the cache through the interface
+type userService struct {
+	cache mnemosyne.ICacheInstance
+	loads int
+}
+
+func (s *userService) user(ctx context.Context, name string) (*TestTypeUser, error) {
+	user := &TestTypeUser{}
+	if _, shouldUpdate, err := s.cache.GetAndShouldUpdate(ctx, name, user); err == nil && !shouldUpdate {
+		return user, nil
+	}
+	s.loads++
+	user = &TestTypeUser{UserName: name}
+	if err := s.cache.Set(ctx, name, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func TestFakeServesPreloadedEntries(t *testing.T) {
+	clock := mnemosyne.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	cache := mnemosynetest.New(mnemosynetest.WithSoftTTL(time.Hour), mnemosynetest.WithClock(clock))
+	cache.Preload("fresh", &TestTypeUser{UserName: "fresh", Info: TestTypeUserInfo{RoomNumber: 7}}, time.Minute)
+	cache.Preload("stale", &TestTypeUser{UserName: "stale"}, 2*time.Hour)
+	service := &userService{cache: cache}
+	ctx := context.Background()
+
+	user, err := service.user(ctx, "fresh")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(7), user.Info.RoomNumber)
+	assert.Equal(t, 0, service.loads)
+	_, err = service.user(ctx, "stale")
+	assert.Nil(t, err)
+	_, err = service.user(ctx, "missing")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, service.loads)
+
+	entry, err := cache.GetEntry(ctx, "stale", &TestTypeUser{})
+	assert.Nil(t, err)
+	assert.Equal(t, time.Duration(0), entry.Age, "the reload reset the age")
+	assert.Equal(t, mnemosynetest.LayerName, entry.LayerName)
+	clock.Advance(2 * time.Hour)
+	shouldUpdate, err := cache.ShouldUpdate(ctx, "stale")
+	assert.Nil(t, err)
+	assert.True(t, shouldUpdate)
+
+	var methods []string
+	for _, call := range cache.Calls() {
+		methods = append(methods, call.Method+" "+call.Key)
+	}
+	assert.Equal(t, []string{
+		"GetAndShouldUpdate fresh",
+		"GetAndShouldUpdate stale", "Set stale",
+		"GetAndShouldUpdate missing", "Set missing",
+		"GetEntry stale", "ShouldUpdate stale",
+	}, methods)
+	assert.True(t, errors.Is(cache.Calls()[3].Err, mnemosyne.ErrMiss))
+	assert.Equal(t, &TestTypeUser{UserName: "missing"}, cache.Calls()[4].Value)
+}
+
+func TestFakeFaults(t *testing.T) {
+	cache := mnemosynetest.New()
+	cache.Preload("user", &TestTypeUser{UserName: "user"}, 0)
+	ctx := context.Background()
+
+	cache.Inject(mnemosynetest.Fault{Op: mnemosynetest.OpGet, Key: "user", Err: mnemosyne.ErrLayerUnavailable, Times: 1})
+	_, err := cache.Get(ctx, "user", &TestTypeUser{})
+	assert.False(t, errors.Is(err, mnemosyne.ErrMiss))
+	assert.True(t, errors.Is(err, mnemosyne.ErrLayerUnavailable))
+	var layerErr *mnemosyne.LayerError
+	assert.True(t, errors.As(err, &layerErr))
+	_, err = cache.Get(ctx, "user", &TestTypeUser{})
+	assert.Nil(t, err, "the fault only applied once")
+
+	cache.Inject(mnemosynetest.Fault{Op: mnemosynetest.OpSet, Err: mnemosyne.ErrLayerUnavailable})
+	err = cache.Set(ctx, "other", &TestTypeUser{})
+	var multiErr *mnemosyne.MultiError
+	assert.True(t, errors.As(err, &multiErr))
+	assert.True(t, errors.Is(err, mnemosyne.ErrLayerUnavailable))
+	assert.False(t, cache.Has("other"))
+	cache.ClearFaults()
+	assert.Nil(t, cache.Set(ctx, "other", &TestTypeUser{}))
+
+	cache.Inject(mnemosynetest.Fault{Key: "slow", Latency: time.Second})
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = cache.Get(timeoutCtx, "slow", &TestTypeUser{})
+	assert.True(t, errors.Is(err, mnemosyne.ErrTimeout))
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestFakeShouldUpdate(t *testing.T) {
+	cache := mnemosynetest.New(mnemosynetest.WithSoftTTL(time.Minute))
+	cache.Preload("fresh", &TestTypeUser{UserName: "fresh"}, 0)
+	cache.Preload("stale", &TestTypeUser{UserName: "stale"}, time.Hour)
+	ctx := context.Background()
+
+	shouldUpdate, err := cache.ShouldUpdate(ctx, "fresh")
+	assert.Nil(t, err)
+	assert.False(t, shouldUpdate)
+	shouldUpdate, _ = cache.ShouldUpdate(ctx, "stale")
+	assert.True(t, shouldUpdate)
+	shouldUpdate, err = cache.ShouldUpdate(ctx, "missing")
+	assert.True(t, errors.Is(err, mnemosyne.ErrMiss))
+	assert.True(t, shouldUpdate, "a miss calls for an update")
+
+	cache.Inject(mnemosynetest.Fault{Op: mnemosynetest.OpGet, Key: "fresh", Err: mnemosyne.ErrLayerUnavailable})
+	_, shouldUpdate, err = cache.GetAndShouldUpdate(ctx, "fresh", &TestTypeUser{})
+	assert.True(t, errors.Is(err, mnemosyne.ErrLayerUnavailable))
+	assert.False(t, shouldUpdate, "like the real instance, a failing layer doesn't call for an update")
+}
+
+func TestFakeTTL(t *testing.T) {
+	clock := mnemosyne.NewFakeClock(time.Now())
+	cache := mnemosynetest.New(mnemosynetest.WithTTL(time.Hour), mnemosynetest.WithClock(clock))
+	ctx := context.Background()
+	assert.Nil(t, cache.Set(ctx, "user", &TestTypeUser{}))
+	clock.Advance(20 * time.Minute)
+	layer, ttl := cache.TTL(ctx, "user")
+	assert.Equal(t, 0, layer)
+	assert.Equal(t, 40*time.Minute, ttl)
+
+	clock.Advance(time.Hour)
+	_, err := cache.Get(ctx, "user", &TestTypeUser{})
+	assert.True(t, errors.Is(err, mnemosyne.ErrMiss), "values expire after the TTL")
+	layer, _ = cache.TTL(ctx, "user")
+	assert.Equal(t, -1, layer)
+
+	assert.Nil(t, cache.Flush("any-layer"))
+	assert.False(t, cache.Has("user"))
+}
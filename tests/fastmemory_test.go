@@ -0,0 +1,75 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mghayour/mnemosyne"
+	"github.com/stretchr/testify/assert"
+)
+
+func newFastMemoryInstance(t *testing.T, valueMode string, opts ...mnemosyne.Option) *mnemosyne.MnemosyneInstance {
+	return newTestInstance(t, "fast", "fastmemory", map[string]interface{}{
+		"soft-ttl":         "2h",
+		"layer.ttl":        "1h",
+		"layer.value-mode": valueMode,
+	}, opts...)
+}
+
+func TestFastMemoryCodecModeCopiesValues(t *testing.T) {
+	cacheInstance := newFastMemoryInstance(t, mnemosyne.ValueModeCodec)
+	ctx := context.Background()
+
+	original := &TestTypeUser{UserName: "before", Meta: map[string]string{"foo": "A1"}}
+	assert.Nil(t, cacheInstance.Set(ctx, "user", original))
+	original.UserName = "after"
+	original.Meta["foo"] = "mutated"
+
+	var result TestTypeUser
+	ret, err := cacheInstance.Get(ctx, "user", &result)
+	assert.Nil(t, err)
+	assert.Equal(t, &result, ret)
+	assert.Equal(t, "before", result.UserName)
+	assert.Equal(t, "A1", result.Meta["foo"])
+}
+
+func TestFastMemoryZeroCopyModeSharesValues(t *testing.T) {
+	cacheInstance := newFastMemoryInstance(t, mnemosyne.ValueModeZeroCopy)
+	ctx := context.Background()
+
+	original := &TestTypeUser{UserName: "shared"}
+	assert.Nil(t, cacheInstance.Set(ctx, "user", original))
+
+	ret, err := cacheInstance.Get(ctx, "user", &TestTypeUser{})
+	assert.Nil(t, err)
+	assert.True(t, ret == original)
+}
+
+func TestFastMemoryFollowsTheClock(t *testing.T) {
+	for _, valueMode := range []string{mnemosyne.ValueModeCodec, mnemosyne.ValueModeZeroCopy} {
+		clock := mnemosyne.NewFakeClock(time.Now())
+		cacheInstance := newFastMemoryInstance(t, valueMode, mnemosyne.WithClock(clock))
+		ctx := context.Background()
+		assert.Nil(t, cacheInstance.Set(ctx, "user", &TestTypeUser{}))
+
+		clock.Advance(20 * time.Minute)
+		entry, err := cacheInstance.GetEntry(ctx, "user", &TestTypeUser{})
+		assert.Nil(t, err)
+		assert.Equal(t, 20*time.Minute, entry.Age, valueMode)
+		assert.Equal(t, 40*time.Minute, entry.TTL, "the age and TTL agree (%s)", valueMode)
+
+		clock.Advance(time.Hour)
+		_, err = cacheInstance.Get(ctx, "user", &TestTypeUser{})
+		assert.True(t, errors.Is(err, mnemosyne.ErrMiss), "the value expired by the clock (%s)", valueMode)
+	}
+}
+
+func TestNilClockFallsBackToTheWallClock(t *testing.T) {
+	cacheInstance := newFastMemoryInstance(t, mnemosyne.ValueModeCodec, mnemosyne.WithClock(nil))
+	assert.Nil(t, cacheInstance.Set(context.Background(), "user", &TestTypeUser{}))
+	entry, err := cacheInstance.GetEntry(context.Background(), "user", &TestTypeUser{})
+	assert.Nil(t, err)
+	assert.InDelta(t, time.Hour, entry.TTL, float64(time.Second))
+}
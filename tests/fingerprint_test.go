@@ -0,0 +1,58 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type TestTypeUserV2 struct {
+	UserName string
+	Info     TestTypeUserInfo
+	Meta     map[string]string
+	Avatar   string
+}
+
+type TestTypeVersioned struct {
+	Name string
+}
+
+func (TestTypeVersioned) SchemaVersion() string {
+	return "3"
+}
+
+type TestTypeVersionedRenamed struct {
+	FullName string `json:"Name"`
+}
+
+func (*TestTypeVersionedRenamed) SchemaVersion() string {
+	return "3"
+}
+
+func TestFingerprintMismatchIsMiss(t *testing.T) {
+	cacheInstance := newTestInstance(t, "schema", "tiny", map[string]interface{}{"soft-ttl": "2h", "fingerprint": true})
+	ctx := context.Background()
+
+	assert.Nil(t, cacheInstance.Set(ctx, "user", &TestTypeUser{UserName: "old"}))
+
+	_, err := cacheInstance.Get(ctx, "user", &TestTypeUserV2{})
+	assert.NotNil(t, err)
+
+	var sameType TestTypeUser
+	_, err = cacheInstance.Get(ctx, "user", &sameType)
+	assert.Nil(t, err)
+	assert.Equal(t, "old", sameType.UserName)
+}
+
+func TestFingerprintExplicitVersion(t *testing.T) {
+	cacheInstance := newTestInstance(t, "schema", "tiny", map[string]interface{}{"soft-ttl": "2h", "fingerprint": true})
+	ctx := context.Background()
+
+	assert.Nil(t, cacheInstance.Set(ctx, "versioned", TestTypeVersioned{Name: "same schema"}))
+
+	var renamed TestTypeVersionedRenamed
+	_, err := cacheInstance.Get(ctx, "versioned", &renamed)
+	assert.Nil(t, err)
+	assert.Equal(t, "same schema", renamed.FullName)
+}
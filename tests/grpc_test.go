@@ -0,0 +1,284 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mghayour/mnemosyne"
+	"github.com/mghayour/mnemosyne/grpccache"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const (
+	echoMethod    = "/mnemosyne.test.Echo/Echo"
+	uncachedEcho  = "/mnemosyne.test.Echo/Uncached"
+	echoSoftTTL   = time.Minute
+	echoTTL       = 10 * time.Minute
+	failedRequest = "fail"
+)
+
+// echoServer answers with the request and the number of calls it served, failing for failedRequest and
+// panicking while panicking is set
+type echoServer struct {
+	served    int32
+	panicking int32
+}
+
+func (s *echoServer) echo(ctx context.Context, req interface{}) (interface{}, error) {
+	served := atomic.AddInt32(&s.served, 1)
+	if atomic.LoadInt32(&s.panicking) == 1 {
+		panic("boom")
+	}
+	value := req.(*wrapperspb.StringValue).GetValue()
+	if value == failedRequest {
+		return nil, errors.New("echo failed")
+	}
+	return wrapperspb.String(fmt.Sprintf("%s #%d", value, served)), nil
+}
+
+func (s *echoServer) calls() int32 {
+	return atomic.LoadInt32(&s.served)
+}
+
+// echoMethodDesc describes a method of the echo service by hand, so the tests need no generated code
+func echoMethodDesc(name string) grpc.MethodDesc {
+	fullMethod := "/mnemosyne.test.Echo/" + name
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			req := &wrapperspb.StringValue{}
+			if err := dec(req); err != nil {
+				return nil, err
+			}
+			if interceptor == nil {
+				return srv.(*echoServer).echo(ctx, req)
+			}
+			return interceptor(ctx, req, &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod}, srv.(*echoServer).echo)
+		},
+	}
+}
+
+var echoServiceDesc = grpc.ServiceDesc{
+	ServiceName: "mnemosyne.test.Echo",
+	HandlerType: (*interface{})(nil),
+	Methods:     []grpc.MethodDesc{echoMethodDesc("Echo"), echoMethodDesc("Uncached")},
+}
+
+var echoOptions = grpccache.Options{Methods: map[string]grpccache.MethodOptions{
+	echoMethod: {SoftTTL: echoSoftTTL, TTL: echoTTL},
+}}
+
+// newEchoConn serves the echo service over an in-memory listener, with the given interceptors
+func newEchoConn(t *testing.T, server grpc.UnaryServerInterceptor, client grpc.UnaryClientInterceptor) (*grpc.ClientConn, *echoServer) {
+	listener := bufconn.Listen(1 << 20)
+	var serverOptions []grpc.ServerOption
+	if server != nil {
+		serverOptions = append(serverOptions, grpc.UnaryInterceptor(server))
+	}
+	grpcServer := grpc.NewServer(serverOptions...)
+	echo := &echoServer{}
+	grpcServer.RegisterService(&echoServiceDesc, echo)
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	dialOptions := []grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+	}
+	if client != nil {
+		dialOptions = append(dialOptions, grpc.WithUnaryInterceptor(client))
+	}
+	conn, err := grpc.Dial("bufnet", dialOptions...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn, echo
+}
+
+// callEcho calls method with value, returning the answer and the x-cache header of the response
+func callEcho(t *testing.T, conn *grpc.ClientConn, method, value string, control string) (string, string, error) {
+	ctx := context.Background()
+	if control != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, grpccache.MetadataCacheControl, control)
+	}
+	res := &wrapperspb.StringValue{}
+	var header metadata.MD
+	err := conn.Invoke(ctx, method, wrapperspb.String(value), res, grpc.Header(&header))
+	state := ""
+	if values := header.Get(grpccache.MetadataXCache); len(values) > 0 {
+		state = values[0]
+	}
+	return res.GetValue(), state, err
+}
+
+func TestGRPCKey(t *testing.T) {
+	first, err := structpb.NewStruct(map[string]interface{}{"a": 1, "b": "two", "c": []interface{}{true, "x"}})
+	assert.Nil(t, err)
+	second, err := structpb.NewStruct(map[string]interface{}{"c": []interface{}{true, "x"}, "b": "two", "a": 1})
+	assert.Nil(t, err)
+	for i := 0; i < 10; i++ {
+		firstKey, err := grpccache.Key(echoMethod, first, nil)
+		assert.Nil(t, err)
+		secondKey, err := grpccache.Key(echoMethod, proto.Clone(second), nil)
+		assert.Nil(t, err)
+		assert.Equal(t, firstKey, secondKey, "map fields are serialized in order")
+	}
+	echoKey, _ := grpccache.Key(echoMethod, first, nil)
+	uncachedKey, _ := grpccache.Key(uncachedEcho, first, nil)
+	assert.NotEqual(t, echoKey, uncachedKey)
+	aliceKey, _ := grpccache.Key(echoMethod, first, metadata.Pairs("authorization", "alice"))
+	bobKey, _ := grpccache.Key(echoMethod, first, metadata.Pairs("authorization", "bob"))
+	assert.NotEqual(t, echoKey, aliceKey)
+	assert.NotEqual(t, aliceKey, bobKey)
+}
+
+func TestGRPCVaryMetadata(t *testing.T) {
+	cacheInstance := newTestInstance(t, "grpc", "tiny", nil)
+	options := grpccache.Options{Methods: map[string]grpccache.MethodOptions{
+		echoMethod: {VaryMetadata: []string{"authorization"}},
+	}}
+	conn, echo := newEchoConn(t, grpccache.UnaryServerInterceptor(cacheInstance, options), nil)
+	callAs := func(user string) (string, string) {
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", user, "x-request-id", user+"-request")
+		res := &wrapperspb.StringValue{}
+		var header metadata.MD
+		assert.Nil(t, conn.Invoke(ctx, echoMethod, wrapperspb.String("me"), res, grpc.Header(&header)))
+		return res.GetValue(), header.Get(grpccache.MetadataXCache)[0]
+	}
+
+	res, state := callAs("alice")
+	assert.Equal(t, "me #1", res)
+	assert.Equal(t, "MISS", state)
+	res, state = callAs("bob")
+	assert.Equal(t, "me #2", res, "callers never see each other's responses")
+	assert.Equal(t, "MISS", state)
+	res, state = callAs("alice")
+	assert.Equal(t, "me #1", res)
+	assert.Equal(t, "HIT from grpc-tiny", state)
+	assert.Equal(t, int32(2), echo.calls())
+
+	key, err := grpccache.Key(echoMethod, wrapperspb.String("me"), metadata.Pairs("authorization", "bob"))
+	assert.Nil(t, err)
+	_, err = cacheInstance.GetEntry(context.Background(), key, &grpccache.CachedMessage{})
+	assert.Nil(t, err, "the key is made of the metadata varied on only")
+}
+
+func TestGRPCServerInterceptor(t *testing.T) {
+	clock := mnemosyne.NewFakeClock(time.Now())
+	conn, echo := newEchoConn(t, grpccache.UnaryServerInterceptor(newTestInstance(t, "grpc", "tiny", nil, mnemosyne.WithClock(clock)), echoOptions), nil)
+
+	res, state, err := callEcho(t, conn, echoMethod, "a", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "a #1", res)
+	assert.Equal(t, "MISS", state)
+	res, state, _ = callEcho(t, conn, echoMethod, "a", "")
+	assert.Equal(t, "a #1", res)
+	assert.Equal(t, "HIT from grpc-tiny", state)
+	res, _, _ = callEcho(t, conn, echoMethod, "b", "")
+	assert.Equal(t, "b #2", res, "another request is another key")
+
+	callEcho(t, conn, uncachedEcho, "a", "")
+	res, state, _ = callEcho(t, conn, uncachedEcho, "a", "")
+	assert.Equal(t, "a #4", res, "only the configured methods are cached")
+	assert.Empty(t, state)
+	callEcho(t, conn, echoMethod, failedRequest, "")
+	_, _, err = callEcho(t, conn, echoMethod, failedRequest, "")
+	assert.NotNil(t, err, "errors aren't cached")
+	assert.Equal(t, int32(6), echo.calls())
+
+	// the metadata of a call skips the cache
+	res, state, _ = callEcho(t, conn, echoMethod, "a", grpccache.Bypass)
+	assert.Equal(t, "a #7", res)
+	assert.Equal(t, "BYPASS", state)
+	res, _, _ = callEcho(t, conn, echoMethod, "a", "")
+	assert.Equal(t, "a #1", res, "bypassing doesn't store the response")
+	res, state, _ = callEcho(t, conn, echoMethod, "a", grpccache.Refresh)
+	assert.Equal(t, "a #8", res)
+	assert.Equal(t, "MISS", state)
+	res, _, _ = callEcho(t, conn, echoMethod, "a", "")
+	assert.Equal(t, "a #8", res, "refreshing stores the response")
+}
+
+func TestGRPCServerInterceptorTTL(t *testing.T) {
+	clock := mnemosyne.NewFakeClock(time.Now())
+	conn, echo := newEchoConn(t, grpccache.UnaryServerInterceptor(newTestInstance(t, "grpc", "tiny", nil, mnemosyne.WithClock(clock)), echoOptions), nil)
+
+	callEcho(t, conn, echoMethod, "a", "")
+	clock.Advance(echoSoftTTL + time.Second)
+	res, state, _ := callEcho(t, conn, echoMethod, "a", "")
+	assert.Equal(t, "a #1", res, "the stale response is served right away")
+	assert.Equal(t, "STALE from grpc-tiny", state)
+	assert.Eventually(t, func() bool {
+		res, state, _ := callEcho(t, conn, echoMethod, "a", "")
+		return res == "a #2" && state == "HIT from grpc-tiny"
+	}, time.Second, 5*time.Millisecond, "the response was refreshed in the background")
+
+	clock.Advance(echoTTL + time.Second)
+	res, state, _ = callEcho(t, conn, echoMethod, "a", "")
+	assert.Equal(t, "a #3", res, "expired responses aren't served")
+	assert.Equal(t, "MISS", state)
+	assert.Equal(t, int32(3), echo.calls())
+}
+
+func TestGRPCServerInterceptorRecoversRefreshPanics(t *testing.T) {
+	clock := mnemosyne.NewFakeClock(time.Now())
+	logger := &recordingLogger{}
+	instance := newTestInstance(t, "grpc", "tiny", nil, mnemosyne.WithClock(clock), mnemosyne.WithLogger(logger), mnemosyne.WithLogRateLimit(0))
+	conn, echo := newEchoConn(t, grpccache.UnaryServerInterceptor(instance, echoOptions), nil)
+
+	callEcho(t, conn, echoMethod, "a", "")
+	clock.Advance(echoSoftTTL + time.Second)
+	atomic.StoreInt32(&echo.panicking, 1)
+	res, state, _ := callEcho(t, conn, echoMethod, "a", "")
+	assert.Equal(t, "a #1", res)
+	assert.Equal(t, "STALE from grpc-tiny", state)
+	assert.Eventually(t, func() bool { return loggedError(logger, "failed to refresh a response") }, time.Second, 5*time.Millisecond,
+		"the panic of the refresh is logged rather than crashing the server")
+
+	atomic.StoreInt32(&echo.panicking, 0)
+	assert.Eventually(t, func() bool {
+		res, _, _ := callEcho(t, conn, echoMethod, "a", "")
+		return res == "a #3"
+	}, time.Second, 5*time.Millisecond, "the response is refreshed again after the panic")
+}
+
+func TestGRPCClientInterceptor(t *testing.T) {
+	clock := mnemosyne.NewFakeClock(time.Now())
+	conn, echo := newEchoConn(t, nil, grpccache.UnaryClientInterceptor(newTestInstance(t, "grpc", "tiny", nil, mnemosyne.WithClock(clock)), echoOptions))
+
+	res, _, err := callEcho(t, conn, echoMethod, "a", "")
+	assert.Nil(t, err)
+	assert.Equal(t, "a #1", res)
+	res, _, _ = callEcho(t, conn, echoMethod, "a", "")
+	assert.Equal(t, "a #1", res)
+	assert.Equal(t, int32(1), echo.calls(), "cached calls don't reach the server")
+
+	res, _, _ = callEcho(t, conn, echoMethod, "a", grpccache.Bypass)
+	assert.Equal(t, "a #2", res)
+	res, _, _ = callEcho(t, conn, echoMethod, "a", grpccache.Refresh)
+	assert.Equal(t, "a #3", res)
+	res, _, _ = callEcho(t, conn, echoMethod, "a", "")
+	assert.Equal(t, "a #3", res)
+
+	clock.Advance(echoSoftTTL + time.Second)
+	res, _, _ = callEcho(t, conn, echoMethod, "a", "")
+	assert.Equal(t, "a #3", res)
+	assert.Eventually(t, func() bool {
+		res, _, _ := callEcho(t, conn, echoMethod, "a", "")
+		return res == "a #4"
+	}, time.Second, 5*time.Millisecond, "the response was refreshed in the background")
+	assert.Equal(t, int32(4), echo.calls())
+}
@@ -0,0 +1,158 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis"
+	"github.com/mghayour/mnemosyne"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLayerAccess(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	config := viper.New()
+	config.Set("cache.layer.soft-ttl", "2h")
+	config.Set("cache.layer.fingerprint", true)
+	config.Set("cache.layer.layers", []string{"layer-tiny", "layer-redis"})
+	config.Set("cache.layer.layer-tiny.type", "tiny")
+	config.Set("cache.layer.layer-redis.type", "redis")
+	config.Set("cache.layer.layer-redis.address", mr.Addr())
+	config.Set("cache.layer.layer-redis.ttl", "1h")
+	config.Set("cache.layer.layer-redis.compression", true)
+	cacheInstance := mnemosyne.NewMnemosyne(config, nil, nil).Select("layer")
+	ctx := context.Background()
+	assert.Equal(t, []string{"layer-tiny", "layer-redis"}, cacheInstance.LayerNames())
+
+	redisLayer, err := cacheInstance.Layer("layer-redis")
+	assert.Nil(t, err)
+	assert.Equal(t, "layer-redis", redisLayer.Name())
+	_, err = cacheInstance.Layer("unknown")
+	assert.NotNil(t, err)
+
+	// values written by operators carry no fingerprint, so typed reads accept them
+	assert.Nil(t, redisLayer.Set(ctx, "user:1", json.RawMessage(`{"UserName":"raw"}`)))
+	var user TestTypeUser
+	_, err = cacheInstance.Get(ctx, "user:1", &user)
+	assert.Nil(t, err)
+	assert.Equal(t, "raw", user.UserName)
+	assert.Equal(t, time.Hour, redisLayer.TTL(ctx, "user:1"))
+	assert.True(t, redisLayer.Explain(ctx, "user:1").Decoded)
+
+	assert.Nil(t, redisLayer.Set(ctx, "user:2", &TestTypeUser{}))
+	assert.Nil(t, redisLayer.Set(ctx, "order:1", &TestTypeUser{}))
+	keys, err := redisLayer.Scan(ctx, "user:*", 0)
+	assert.Nil(t, err)
+	sort.Strings(keys)
+	assert.Equal(t, []string{"user:1", "user:2"}, keys)
+	keys, err = redisLayer.Scan(ctx, "*", 2)
+	assert.Nil(t, err)
+	assert.Len(t, keys, 2)
+
+	tinyLayer, _ := cacheInstance.Layer("layer-tiny")
+	assert.Eventually(t, func() bool {
+		keys, err = tinyLayer.Scan(ctx, "user:?", 0)
+		return err == nil && len(keys) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	assert.Nil(t, redisLayer.Delete(ctx, "user:2"))
+	assert.False(t, redisLayer.Explain(ctx, "user:2").Present)
+	assert.Nil(t, redisLayer.Flush())
+	keys, err = redisLayer.Scan(ctx, "*", 0)
+	assert.Nil(t, err)
+	assert.Empty(t, keys)
+}
+
+func TestScanPatterns(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	config := viper.New()
+	config.Set("cache.scan.soft-ttl", "2h")
+	config.Set("cache.scan.layers", []string{"scan-tiny", "scan-redis"})
+	config.Set("cache.scan.scan-tiny.type", "tiny")
+	config.Set("cache.scan.scan-redis.type", "redis")
+	config.Set("cache.scan.scan-redis.address", mr.Addr())
+	cacheInstance := mnemosyne.NewMnemosyne(config, nil, nil).Select("scan")
+	ctx := context.Background()
+	tinyLayer, _ := cacheInstance.Layer("scan-tiny")
+	redisLayer, _ := cacheInstance.Layer("scan-redis")
+	for _, key := range []string{"user:1", "user:2", "user:12", "user:a", "hello", "hallo", "h*llo", "why?"} {
+		assert.Nil(t, tinyLayer.Set(ctx, key, &TestTypeUser{}))
+		assert.Nil(t, redisLayer.Set(ctx, key, &TestTypeUser{}))
+	}
+
+	patterns := map[string][]string{
+		"user:[12]":      {"user:1", "user:2"},
+		"user:[^1]":      {"user:2", "user:a"},
+		"user:[0-9]?":    {"user:12"},
+		"h[a-e]llo":      {"hallo", "hello"},
+		`h\*llo`:         {"h*llo"},
+		`why\?`:          {"why?"},
+		`h[\*]llo`:       {"h*llo"},
+		"user:[a-z0-9]*": {"user:1", "user:12", "user:2", "user:a"},
+	}
+	for pattern, expected := range patterns {
+		for _, layer := range []*mnemosyne.Layer{tinyLayer, redisLayer} {
+			keys, err := layer.Scan(ctx, pattern, 0)
+			assert.Nil(t, err)
+			sort.Strings(keys)
+			assert.Equal(t, expected, keys, "%s on %s", pattern, layer.Name())
+		}
+	}
+	// the corner cases of redis which miniredis doesn't follow
+	for pattern, expected := range map[string][]string{
+		"user:[9-0]": {"user:1", "user:2"},
+		"user:[]":    nil,
+		"user:[^]":   {"user:1", "user:2", "user:a"},
+		"user:[12":   {"user:1", "user:2"},
+	} {
+		keys, err := tinyLayer.Scan(ctx, pattern, 0)
+		assert.Nil(t, err)
+		sort.Strings(keys)
+		assert.Equal(t, expected, keys, pattern)
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	config := viper.New()
+	config.Set("cache.valid.soft-ttl", "2h")
+	config.Set("cache.valid.layers", []string{"valid-memory"})
+	config.Set("cache.valid.valid-memory.type", "memory")
+	config.Set("cache.valid.valid-memory.max-memory", 512)
+	config.Set("cache.valid.valid-memory.ttl", "1h")
+	assert.Empty(t, mnemosyne.ValidateConfig(config))
+
+	config.Set("cache.broken.layers", []string{"broken-redis", "broken-missing", "broken-fast"})
+	config.Set("cache.broken.soft-ttl", "2 hours")
+	config.Set("cache.broken.broken-redis.type", "redis")
+	config.Set("cache.broken.broken-redis.ttl", "1h")
+	config.Set("cache.broken.broken-fast.type", "fastmemory")
+	config.Set("cache.broken.broken-fast.amnesia", 150)
+	config.Set("cache.broken.background.workers", 0)
+	config.Set("cache.broken.background.drop-policy", "drop-random")
+	problems := mnemosyne.ValidateConfig(config)
+	var keys []string
+	for _, problem := range problems {
+		assert.False(t, problem.Warning, problem.Error())
+		keys = append(keys, problem.Key)
+	}
+	assert.Equal(t, []string{
+		"cache.broken.background.drop-policy",
+		"cache.broken.background.workers",
+		"cache.broken.broken-fast.amnesia",
+		"cache.broken.broken-missing",
+		"cache.broken.broken-redis.address",
+		"cache.broken.soft-ttl",
+	}, keys)
+}
@@ -0,0 +1,139 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis"
+	"github.com/mghayour/mnemosyne"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func newLifecycleConfig(redisAddr string) *viper.Viper {
+	config := viper.New()
+	config.Set("cache.lifecycle.soft-ttl", "2h")
+	config.Set("cache.lifecycle.layers", []string{"lifecycle-tiny", "lifecycle-memory", "lifecycle-fast", "lifecycle-redis"})
+	config.Set("cache.lifecycle.lifecycle-tiny.type", "tiny")
+	config.Set("cache.lifecycle.lifecycle-memory.type", "memory")
+	config.Set("cache.lifecycle.lifecycle-memory.max-memory", 16)
+	config.Set("cache.lifecycle.lifecycle-memory.ttl", "1h")
+	config.Set("cache.lifecycle.lifecycle-fast.type", "fastmemory")
+	config.Set("cache.lifecycle.lifecycle-fast.ttl", "1h")
+	config.Set("cache.lifecycle.lifecycle-fast.cleanup-interval", "1m")
+	config.Set("cache.lifecycle.lifecycle-redis.type", "redis")
+	config.Set("cache.lifecycle.lifecycle-redis.address", redisAddr)
+	config.Set("cache.lifecycle.lifecycle-redis.ttl", "1h")
+	return config
+}
+
+func TestCloseLeavesNoGoroutines(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	// the idle connection reaper of go-redis only notices its pool is closed on its next tick (a minute at most)
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent(),
+		goleak.IgnoreTopFunction("github.com/go-redis/redis/internal/pool.(*ConnPool).reaper"))
+
+	registry := prometheus.NewRegistry()
+	manager := mnemosyne.NewMnemosyne(newLifecycleConfig(mr.Addr()), nil, nil, mnemosyne.WithPrometheus(registry))
+	cacheInstance := manager.Select("lifecycle")
+	ctx := context.Background()
+	user := TestTypeUser{UserName: "lifecycle"}
+	assert.Nil(t, cacheInstance.Set(ctx, "user", &user))
+	assert.Nil(t, cacheInstance.Flush("lifecycle-tiny"))
+	assert.Nil(t, cacheInstance.Flush("lifecycle-memory"))
+	assert.Nil(t, cacheInstance.Flush("lifecycle-fast"))
+	// starts the background fill of the upper layers
+	_, err = cacheInstance.Get(ctx, "user", &TestTypeUser{})
+	assert.Nil(t, err)
+	_, err = cacheInstance.ShouldUpdateDeep(ctx, "user", &TestTypeUser{})
+	assert.Nil(t, err)
+
+	closeCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	assert.Nil(t, manager.Close(closeCtx))
+	assert.Nil(t, manager.Close(closeCtx))
+
+	families, err := registry.Gather()
+	assert.Nil(t, err)
+	assert.Empty(t, families)
+}
+
+func TestOperationsAfterClose(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	cacheInstance := mnemosyne.NewMnemosyne(newLifecycleConfig(mr.Addr()), nil, nil).Select("lifecycle")
+	ctx := context.Background()
+	assert.Nil(t, cacheInstance.Set(ctx, "user", &TestTypeUser{}))
+	assert.Nil(t, cacheInstance.Close(ctx))
+
+	_, err = cacheInstance.Get(ctx, "user", &TestTypeUser{})
+	assert.True(t, errors.Is(err, mnemosyne.ErrClosed))
+	assert.False(t, errors.Is(err, mnemosyne.ErrMiss))
+	_, err = cacheInstance.GetEntry(ctx, "user", &TestTypeUser{})
+	assert.True(t, errors.Is(err, mnemosyne.ErrClosed))
+	_, err = cacheInstance.ShouldUpdateDeep(ctx, "user", &TestTypeUser{})
+	assert.True(t, errors.Is(err, mnemosyne.ErrClosed))
+	assert.True(t, errors.Is(cacheInstance.Set(ctx, "user", &TestTypeUser{}), mnemosyne.ErrClosed))
+	assert.True(t, errors.Is(cacheInstance.Delete(ctx, "user"), mnemosyne.ErrClosed))
+	assert.True(t, errors.Is(cacheInstance.Flush("lifecycle-tiny"), mnemosyne.ErrClosed))
+	_, err = cacheInstance.Explain(ctx, "user")
+	assert.True(t, errors.Is(err, mnemosyne.ErrClosed))
+}
+
+func TestCloseDeadline(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	cacheInstance := mnemosyne.NewMnemosyne(newLifecycleConfig(mr.Addr()), nil, nil).Select("lifecycle")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// with nothing in flight, an expired context doesn't matter
+	assert.Nil(t, cacheInstance.Close(ctx))
+}
+
+func TestCloseWaitsForOperationsInFlight(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	config := viper.New()
+	config.Set("cache.slow.soft-ttl", "2h")
+	config.Set("cache.slow.layers", []string{"slow-redis"})
+	config.Set("cache.slow.slow-redis.type", "redis")
+	config.Set("cache.slow.slow-redis.address", mr.Addr())
+	config.Set("cache.slow.slow-redis.chaos.latency", "200ms")
+	config.Set("cache.slow.slow-redis.chaos.latency-chance", 100)
+	cacheInstance := mnemosyne.NewMnemosyne(config, nil, nil).Select("slow")
+	ctx := context.Background()
+	assert.Nil(t, cacheInstance.Set(ctx, "user", &TestTypeUser{UserName: "slow"}))
+
+	got := make(chan error, 1)
+	go func() {
+		_, err := cacheInstance.Get(ctx, "user", &TestTypeUser{})
+		got <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	assert.Nil(t, cacheInstance.Close(ctx))
+	select {
+	case err := <-got:
+		assert.Nil(t, err, "the layers weren't closed under the Get")
+	default:
+		t.Fatal("Close returned before the Get in flight")
+	}
+	_, err = cacheInstance.Get(ctx, "user", &TestTypeUser{})
+	assert.True(t, errors.Is(err, mnemosyne.ErrClosed))
+}
@@ -0,0 +1,212 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis"
+	"github.com/mghayour/mnemosyne"
+	"github.com/mghayour/mnemosyne/mnemosynetest"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// newBatchInstance creates an instance with a tiny layer over a redis layer of two shards
+func newBatchInstance(t *testing.T) *mnemosyne.MnemosyneInstance {
+	var shards []map[string]interface{}
+	for i := 0; i < 2; i++ {
+		mr, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(mr.Close)
+		shards = append(shards, map[string]interface{}{"address": mr.Addr()})
+	}
+	config := viper.New()
+	config.Set("cache.batch.soft-ttl", "2h")
+	config.Set("cache.batch.layers", []string{"batch-tiny", "batch-redis"})
+	config.Set("cache.batch.batch-tiny.type", "tiny")
+	config.Set("cache.batch.batch-redis.type", "rediscluster")
+	config.Set("cache.batch.batch-redis.ttl", "1h")
+	config.Set("cache.batch.batch-redis.cluster", shards)
+	return closeOnCleanup(t, mnemosyne.NewMnemosyne(config, nil, nil).Select("batch"))
+}
+
+func TestGetEntries(t *testing.T) {
+	cacheInstance := newBatchInstance(t)
+	ctx := context.Background()
+	redisLayer, err := cacheInstance.Layer("batch-redis")
+	assert.Nil(t, err)
+	for _, key := range []string{"a", "b", "c", "d"} {
+		assert.Nil(t, redisLayer.Set(ctx, key, &TestTypeUser{UserName: key}))
+	}
+	assert.Nil(t, cacheInstance.Set(ctx, "top", &TestTypeUser{UserName: "top"}))
+
+	keys := []string{"a", "top", "missing", "b", "c", "d"}
+	refrences := make([]interface{}, len(keys))
+	for i := range refrences {
+		refrences[i] = &TestTypeUser{}
+	}
+	entries, errs := cacheInstance.GetEntries(ctx, keys, refrences)
+	for i, key := range keys {
+		if key == "missing" {
+			assert.Nil(t, entries[i])
+			assert.True(t, errors.Is(errs[i], mnemosyne.ErrMiss))
+			var miss *mnemosyne.ErrCacheMiss
+			if assert.True(t, errors.As(errs[i], &miss)) {
+				assert.Len(t, miss.Errors, 2, "a miss holds the error of each layer")
+			}
+			continue
+		}
+		assert.Nil(t, errs[i], key)
+		assert.Equal(t, key, entries[i].Value.(*TestTypeUser).UserName)
+	}
+	assert.Equal(t, "batch-tiny", entries[1].LayerName)
+	assert.Equal(t, "batch-redis", entries[0].LayerName)
+	assert.True(t, entries[0].Backfilled)
+
+	// the keys found on redis are filled into the tiny layer
+	assert.Eventually(t, func() bool {
+		entries, _ := cacheInstance.GetEntries(ctx, []string{"a", "d"}, []interface{}{nil, nil})
+		return entries[0] != nil && entries[0].LayerName == "batch-tiny" &&
+			entries[1] != nil && entries[1].LayerName == "batch-tiny"
+	}, time.Second, 5*time.Millisecond)
+
+	_, errs = cacheInstance.GetEntries(ctx, keys, nil)
+	assert.NotNil(t, errs[0], "the refrences must be aligned with the keys")
+}
+
+// recordingFetch fetches users named after the keys, failing for the keys starting with "bad"
+type recordingFetch struct {
+	mu      sync.Mutex
+	batches [][]string
+}
+
+func (f *recordingFetch) fetch(ctx context.Context, keys []string) ([]*TestTypeUser, []error) {
+	f.mu.Lock()
+	f.batches = append(f.batches, append([]string(nil), keys...))
+	f.mu.Unlock()
+	values := make([]*TestTypeUser, len(keys))
+	errs := make([]error, len(keys))
+	for i, key := range keys {
+		if key[:3] == "bad" {
+			errs[i] = fmt.Errorf("no user %s", key)
+			continue
+		}
+		values[i] = &TestTypeUser{UserName: key}
+	}
+	return values, errs
+}
+
+func (f *recordingFetch) fetched() [][]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, batch := range f.batches {
+		sort.Strings(batch)
+	}
+	return f.batches
+}
+
+func TestBatchLoader(t *testing.T) {
+	cacheInstance := newBatchInstance(t)
+	ctx := context.Background()
+	assert.Nil(t, cacheInstance.Set(ctx, "cached", &TestTypeUser{UserName: "cached"}))
+	fetch := &recordingFetch{}
+	loader := mnemosyne.NewBatchLoader(cacheInstance, fetch.fetch, mnemosyne.BatchLoaderOptions{Wait: 20 * time.Millisecond})
+
+	keys := []string{"cached", "new-1", "new-2", "bad-1", "new-1"}
+	users := make([]*TestTypeUser, len(keys))
+	errs := make([]error, len(keys))
+	var wg sync.WaitGroup
+	for i, key := range keys {
+		wg.Add(1)
+		go func(i int, key string) {
+			defer wg.Done()
+			users[i], errs[i] = loader.Load(ctx, key)
+		}(i, key)
+	}
+	wg.Wait()
+
+	assert.Equal(t, [][]string{{"bad-1", "new-1", "new-2"}}, fetch.fetched(), "only the keys which missed are fetched, once")
+	for i, key := range keys {
+		if key == "bad-1" {
+			assert.EqualError(t, errs[i], "no user bad-1")
+			continue
+		}
+		assert.Nil(t, errs[i])
+		assert.Equal(t, key, users[i].UserName)
+	}
+
+	// the fetched values were set in all the layers
+	users, errs = loader.LoadMany(ctx, []string{"new-1", "new-2", "bad-1"})
+	assert.Equal(t, "new-2", users[1].UserName)
+	assert.Nil(t, errs[0])
+	assert.NotNil(t, errs[2])
+	assert.Equal(t, [][]string{{"bad-1", "new-1", "new-2"}, {"bad-1"}}, fetch.fetched())
+	entry, err := cacheInstance.GetEntry(ctx, "new-1", &TestTypeUser{})
+	assert.Nil(t, err)
+	assert.Equal(t, "batch-tiny", entry.LayerName)
+}
+
+func TestBatchLoaderMaxBatch(t *testing.T) {
+	cacheInstance := newBatchInstance(t)
+	fetch := &recordingFetch{}
+	loader := mnemosyne.NewBatchLoader(cacheInstance, fetch.fetch, mnemosyne.BatchLoaderOptions{Wait: time.Hour, MaxBatch: 2})
+	users, errs := loader.LoadMany(context.Background(), []string{"a-1", "a-2", "a-3", "a-4"})
+	assert.Equal(t, []error{nil, nil, nil, nil}, errs, "full batches don't wait")
+	assert.Equal(t, "a-4", users[3].UserName)
+	assert.Len(t, fetch.fetched(), 2)
+
+	// a caller giving up doesn't wait for the batch
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := loader.Load(ctx, "a-5")
+	assert.True(t, errors.Is(err, mnemosyne.ErrTimeout))
+}
+
+func TestBatchLoaderFetchFailure(t *testing.T) {
+	cacheInstance := newBatchInstance(t)
+	loader := mnemosyne.NewBatchLoader(cacheInstance, func(ctx context.Context, keys []string) ([]*TestTypeUser, []error) {
+		if len(keys) > 1 {
+			return nil, []error{errors.New("database is down")}
+		}
+		panic("broken fetch")
+	}, mnemosyne.BatchLoaderOptions{})
+
+	_, errs := loader.LoadMany(context.Background(), []string{"a", "b"})
+	assert.EqualError(t, errs[0], "database is down")
+	assert.EqualError(t, errs[1], "database is down")
+	_, err := loader.Load(context.Background(), "c")
+	assert.EqualError(t, err, "panic in batch fetch: broken fetch")
+}
+
+func TestBatchLoaderOverAnyInstance(t *testing.T) {
+	cache := mnemosynetest.New()
+	ctx := context.Background()
+	assert.Nil(t, cache.Set(ctx, "cached", &TestTypeUser{UserName: "cached"}))
+	fetch := &recordingFetch{}
+	loader := mnemosyne.NewBatchLoader[*TestTypeUser](cache, fetch.fetch, mnemosyne.BatchLoaderOptions{})
+	users, errs := loader.LoadMany(ctx, []string{"cached", "new-1"})
+	assert.Equal(t, []error{nil, nil}, errs)
+	assert.Equal(t, "cached", users[0].UserName)
+	assert.Equal(t, [][]string{{"new-1"}}, fetch.fetched())
+	assert.True(t, cache.Has("new-1"), "the fetched values were set")
+}
+
+func TestBatchLoaderFetchesWhenTheLookupFails(t *testing.T) {
+	cache := mnemosynetest.New()
+	ctx := context.Background()
+	assert.Nil(t, cache.Set(ctx, "cached", &TestTypeUser{UserName: "cached"}))
+	cache.Inject(mnemosynetest.Fault{Op: mnemosynetest.OpGet, Key: "unavailable", Err: mnemosyne.ErrLayerUnavailable})
+	fetch := &recordingFetch{}
+	loader := mnemosyne.NewBatchLoader[*TestTypeUser](cache, fetch.fetch, mnemosyne.BatchLoaderOptions{})
+	users, errs := loader.LoadMany(ctx, []string{"cached", "unavailable"})
+	assert.Equal(t, []error{nil, nil}, errs, "a failing layer doesn't fail the load")
+	assert.Equal(t, "unavailable", users[1].UserName)
+	assert.Equal(t, [][]string{{"unavailable"}}, fetch.fetched(), "the keys whose lookup failed are fetched as if they missed")
+}
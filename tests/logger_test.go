@@ -0,0 +1,116 @@
+package tests
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/mghayour/mnemosyne"
+	"github.com/mghayour/mnemosyne/zaplogger"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+type recordedLog struct {
+	level  string
+	msg    string
+	fields mnemosyne.Fields
+}
+
+type recordingLogger struct {
+	lock sync.Mutex
+	logs []recordedLog
+}
+
+func (l *recordingLogger) record(level, msg string, fields mnemosyne.Fields) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.logs = append(l.logs, recordedLog{level: level, msg: msg, fields: fields})
+}
+
+func (l *recordingLogger) Info(msg string, fields mnemosyne.Fields) {
+	l.record("info", msg, fields)
+}
+
+func (l *recordingLogger) Warn(msg string, fields mnemosyne.Fields) {
+	l.record("warn", msg, fields)
+}
+
+func (l *recordingLogger) Error(msg string, fields mnemosyne.Fields) {
+	l.record("error", msg, fields)
+}
+
+// loggedError tells whether an error was logged with msg
+func loggedError(logger *recordingLogger, msg string) bool {
+	logger.lock.Lock()
+	defer logger.lock.Unlock()
+	for _, log := range logger.logs {
+		if log.level == "error" && log.msg == msg {
+			return true
+		}
+	}
+	return false
+}
+
+func newUnreachableRedisConfig() *viper.Viper {
+	config := viper.New()
+	config.Set("cache.unreachable.soft-ttl", "2h")
+	config.Set("cache.unreachable.layers", []string{"unreachable-redis"})
+	config.Set("cache.unreachable.unreachable-redis.type", "gaurdian")
+	config.Set("cache.unreachable.unreachable-redis.address", "127.0.0.1:1")
+	config.Set("cache.unreachable.unreachable-redis.slaves", []string{"127.0.0.1:1", "127.0.0.1:1"})
+	return config
+}
+
+func TestLoggerReceivesStructuredFields(t *testing.T) {
+	logger := &recordingLogger{}
+	manager := mnemosyne.NewMnemosyne(newUnreachableRedisConfig(), nil, nil,
+		mnemosyne.WithLogger(logger), mnemosyne.WithLogRateLimit(0))
+	t.Cleanup(func() { manager.Close(context.Background()) })
+
+	var pingErrors []recordedLog
+	for _, log := range logger.logs {
+		if log.level == "error" && log.fields[mnemosyne.FieldLayer] == "unreachable-redis" {
+			pingErrors = append(pingErrors, log)
+		}
+	}
+	assert.Len(t, pingErrors, 3)
+	assert.Equal(t, "unreachable", pingErrors[0].fields[mnemosyne.FieldInstance])
+	assert.NotNil(t, pingErrors[0].fields[mnemosyne.FieldError])
+}
+
+func TestLoggerRateLimitsRepeatedErrors(t *testing.T) {
+	logger := &recordingLogger{}
+	manager := mnemosyne.NewMnemosyne(newUnreachableRedisConfig(), nil, nil, mnemosyne.WithLogger(logger))
+	t.Cleanup(func() { manager.Close(context.Background()) })
+
+	var pingErrors int
+	for _, log := range logger.logs {
+		if log.level == "error" && log.fields[mnemosyne.FieldLayer] == "unreachable-redis" {
+			pingErrors++
+		}
+	}
+	assert.Equal(t, 1, pingErrors)
+}
+
+func TestNilLoggerFallsBackToDefault(t *testing.T) {
+	assert.NotPanics(t, func() {
+		manager := mnemosyne.NewMnemosyne(newUnreachableRedisConfig(), nil, nil, mnemosyne.WithLogger(nil))
+		t.Cleanup(func() { manager.Close(context.Background()) })
+	})
+}
+
+func TestZapLogger(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	manager := mnemosyne.NewMnemosyne(newUnreachableRedisConfig(), nil, nil,
+		mnemosyne.WithLogger(zaplogger.New(zap.New(core))), mnemosyne.WithLogRateLimit(0))
+	t.Cleanup(func() { manager.Close(context.Background()) })
+
+	pingErrors := logs.FilterField(zap.String(mnemosyne.FieldLayer, "unreachable-redis")).All()
+	assert.Len(t, pingErrors, 3)
+	fields := pingErrors[0].ContextMap()
+	assert.Equal(t, "unreachable", fields[mnemosyne.FieldInstance])
+	assert.NotEmpty(t, fields[mnemosyne.FieldError])
+}
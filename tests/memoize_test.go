@@ -0,0 +1,236 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mghayour/mnemosyne"
+	"github.com/mghayour/mnemosyne/mnemosynetest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoizeKey(t *testing.T) {
+	assert.Equal(t, `memoize;user;"ali";42;true`, mnemosyne.MemoizeKey("user", "ali", 42, true))
+	assert.NotEqual(t, mnemosyne.MemoizeKey("user", "42"), mnemosyne.MemoizeKey("user", 42))
+	assert.NotEqual(t, mnemosyne.MemoizeKey("user", "a", "b"), mnemosyne.MemoizeKey("user", "a;b"))
+
+	long := mnemosyne.MemoizeKey("user", strings.Repeat("a", 1000))
+	assert.True(t, len(long) < 100, "long arguments are hashed")
+	assert.Equal(t, long, mnemosyne.MemoizeKey("user", strings.Repeat("a", 1000)))
+
+	first := mnemosyne.MemoizeKey("search", map[string]int{"a": 1, "b": 2, "c": 3}, TestTypeUserInfo{RoomNumber: 1})
+	second := mnemosyne.MemoizeKey("search", map[string]int{"c": 3, "b": 2, "a": 1}, TestTypeUserInfo{RoomNumber: 1})
+	assert.Equal(t, first, second, "structured arguments are hashed deterministically")
+	assert.NotEqual(t, first, mnemosyne.MemoizeKey("search", map[string]int{"a": 1}, TestTypeUserInfo{RoomNumber: 1}))
+
+	assert.NotEqual(t, mnemosyne.MemoizeKey("search", lossyQuery{Term: "a", Page: 1}), mnemosyne.MemoizeKey("search", lossyQuery{Term: "a", Page: 2}),
+		"structured arguments are told apart by their fields rather than their String method")
+}
+
+// lossyQuery prints only some of its fields
+type lossyQuery struct {
+	Term string
+	Page int
+}
+
+func (q lossyQuery) String() string { return q.Term }
+
+func TestMemoizeRecomputesWhenStale(t *testing.T) {
+	clock := mnemosyne.NewFakeClock(time.Now())
+	cache := mnemosynetest.New(mnemosynetest.WithSoftTTL(time.Hour), mnemosynetest.WithClock(clock))
+	calls := 0
+	var loadErr error
+	user := mnemosyne.Memoize2(cache, "user", func(ctx context.Context, name string, room int64) (*TestTypeUser, error) {
+		calls++
+		return &TestTypeUser{UserName: name, Info: TestTypeUserInfo{RoomNumber: room}}, loadErr
+	}, mnemosyne.MemoizeOptions{})
+	ctx := context.Background()
+
+	res, err := user(ctx, "ali", 7)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(7), res.Info.RoomNumber)
+	res, err = user(ctx, "ali", 7)
+	assert.Nil(t, err)
+	assert.Equal(t, "ali", res.UserName)
+	assert.Equal(t, 1, calls)
+	assert.True(t, cache.Has(mnemosyne.MemoizeKey("user", "ali", 7)))
+
+	_, err = user(ctx, "ali", 8)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, calls, "other arguments are another key")
+
+	clock.Advance(2 * time.Hour)
+	_, err = user(ctx, "ali", 7)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, calls, "a stale result is computed again")
+
+	loadErr = errors.New("database is down")
+	clock.Advance(2 * time.Hour)
+	res, err = user(ctx, "ali", 7)
+	assert.Nil(t, err, "the stale result is served when computing it again fails")
+	assert.Equal(t, int64(7), res.Info.RoomNumber)
+	_, err = user(ctx, "ali", 9)
+	assert.Equal(t, loadErr, err)
+	_, err = user(ctx, "ali", 9)
+	assert.Equal(t, 6, calls, "errors aren't cached by default")
+}
+
+func TestMemoizeOptions(t *testing.T) {
+	clock := mnemosyne.NewFakeClock(time.Now())
+	cache := mnemosynetest.New(mnemosynetest.WithSoftTTL(time.Hour), mnemosynetest.WithClock(clock))
+	calls := 0
+	square := mnemosyne.Memoize(cache, "square", func(ctx context.Context, n int) (int, error) {
+		calls++
+		if n < 0 {
+			return 0, errors.New("negative")
+		}
+		return n * n, nil
+	}, mnemosyne.MemoizeOptions{
+		SoftTTL:  10 * time.Minute,
+		ErrorTTL: time.Minute,
+		TTL: func(result interface{}) time.Duration {
+			if result.(int) == 0 {
+				return time.Second
+			}
+			return 0
+		},
+	})
+	ctx := context.Background()
+
+	_, err := square(ctx, -1)
+	assert.EqualError(t, err, "negative")
+	_, err = square(ctx, -1)
+	assert.EqualError(t, err, "negative", "the error is cached")
+	assert.Equal(t, 1, calls)
+	clock.Advance(2 * time.Minute)
+	_, _ = square(ctx, -1)
+	assert.Equal(t, 2, calls, "for ErrorTTL")
+
+	_, _ = square(ctx, 0)
+	_, _ = square(ctx, 3)
+	clock.Advance(5 * time.Minute)
+	res, _ := square(ctx, 0)
+	assert.Equal(t, 0, res)
+	res, _ = square(ctx, 3)
+	assert.Equal(t, 9, res)
+	assert.Equal(t, 5, calls, "the result of TTL overrides SoftTTL")
+	clock.Advance(10 * time.Minute)
+	_, _ = square(ctx, 3)
+	assert.Equal(t, 6, calls)
+}
+
+func TestMemoizeSharesConcurrentCalls(t *testing.T) {
+	cache := mnemosynetest.New()
+	release := make(chan struct{})
+	var calls int32
+	slow := mnemosyne.Memoize(cache, "slow", func(ctx context.Context, key string) (string, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "value of " + key, nil
+	}, mnemosyne.MemoizeOptions{})
+
+	const callers = 8
+	results := make(chan string, callers)
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := slow(context.Background(), "key")
+			assert.Nil(t, err)
+			results <- res
+		}()
+	}
+	// wait for all the callers to miss, then let the single call finish
+	for len(cache.Calls()) < callers {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(results)
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	for res := range results {
+		assert.Equal(t, "value of key", res)
+	}
+}
+
+func TestMemoizeCallersWaitOnTheirOwnContext(t *testing.T) {
+	cache := mnemosynetest.New()
+	release := make(chan struct{})
+	slow := mnemosyne.Memoize(cache, "slow", func(ctx context.Context, key string) (string, error) {
+		select {
+		case <-release:
+			return "value of " + key, nil
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}, mnemosyne.MemoizeOptions{})
+
+	// the first caller gives up, the shared call goes on for the second one
+	first, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := slow(first, "key")
+		firstErr <- err
+	}()
+	for len(cache.Calls()) < 1 {
+		time.Sleep(time.Millisecond)
+	}
+	second := make(chan string, 1)
+	go func() {
+		res, err := slow(context.Background(), "key")
+		assert.Nil(t, err)
+		second <- res
+	}()
+	cancel()
+	err := <-firstErr
+	assert.True(t, errors.Is(err, mnemosyne.ErrTimeout), "the caller returns once its context is done: %v", err)
+	assert.True(t, errors.Is(err, context.Canceled))
+
+	close(release)
+	assert.Equal(t, "value of key", <-second)
+	res, err := slow(context.Background(), "key")
+	assert.Nil(t, err)
+	assert.Equal(t, "value of key", res, "the result was cached")
+}
+
+func TestMemoizeRecoversPanics(t *testing.T) {
+	cache := mnemosynetest.New()
+	calls := 0
+	panicking := mnemosyne.Memoize(cache, "panicking", func(ctx context.Context, key string) (string, error) {
+		calls++
+		panic("boom")
+	}, mnemosyne.MemoizeOptions{})
+	ctx := context.Background()
+
+	_, err := panicking(ctx, "key")
+	assert.NotNil(t, err, "the panic is returned as an error rather than crashing the process")
+	assert.Contains(t, err.Error(), "boom")
+	_, err = panicking(ctx, "key")
+	assert.NotNil(t, err)
+	assert.Equal(t, 2, calls, "the failed call isn't cached")
+}
+
+func TestMemoizeSurvivesFailingToCache(t *testing.T) {
+	cache := mnemosynetest.New()
+	cache.Inject(mnemosynetest.Fault{Op: mnemosynetest.OpSet, Err: mnemosyne.ErrLayerUnavailable})
+	calls := 0
+	user := mnemosyne.Memoize(cache, "user", func(ctx context.Context, name string) (*TestTypeUser, error) {
+		calls++
+		return &TestTypeUser{UserName: name}, nil
+	}, mnemosyne.MemoizeOptions{})
+
+	res, err := user(context.Background(), "ali")
+	assert.Nil(t, err, "failing to cache the result doesn't fail the call")
+	assert.Equal(t, "ali", res.UserName)
+	_, err = user(context.Background(), "ali")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, calls)
+}
@@ -0,0 +1,228 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mghayour/mnemosyne"
+	"github.com/mghayour/mnemosyne/mnemosynetest"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingHandler answers with the number of requests it served, and the Cache-Control and Vary given to it
+type countingHandler struct {
+	served       int32
+	cacheControl string
+	vary         string
+}
+
+func (h *countingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	served := atomic.AddInt32(&h.served, 1)
+	if h.cacheControl != "" {
+		w.Header().Set("Cache-Control", h.cacheControl)
+	}
+	if h.vary != "" {
+		w.Header().Set("Vary", h.vary)
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintf(w, "%s %s #%d", r.URL.Path, r.Header.Get("Accept-Language"), served)
+}
+
+func newMiddlewareInstance(t *testing.T, clock mnemosyne.Clock) *mnemosyne.MnemosyneInstance {
+	return newTestInstance(t, "http", "tiny", map[string]interface{}{"soft-ttl": "1m"}, mnemosyne.WithClock(clock))
+}
+
+func serveMiddleware(handler http.Handler, method, target string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	for name, value := range header {
+		req.Header.Set(name, value)
+	}
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	return res
+}
+
+func TestMiddlewareHitsAndMisses(t *testing.T) {
+	clock := mnemosyne.NewFakeClock(time.Now())
+	next := &countingHandler{}
+	handler := mnemosyne.NewMiddleware(newMiddlewareInstance(t, clock), mnemosyne.MiddlewareOptions{
+		QueryParams: []string{"page"},
+	})(next)
+
+	res := serveMiddleware(handler, http.MethodGet, "/users?page=1&tracking=a", nil)
+	assert.Equal(t, "MISS", res.Header().Get(mnemosyne.HeaderXCache))
+	assert.Equal(t, "/users  #1", res.Body.String())
+
+	clock.Advance(10 * time.Second)
+	res = serveMiddleware(handler, http.MethodGet, "/users?tracking=b&page=1", nil)
+	assert.Equal(t, "HIT from http-tiny", res.Header().Get(mnemosyne.HeaderXCache), "unselected query parameters aren't in the key")
+	assert.Equal(t, "10", res.Header().Get("Age"))
+	assert.Equal(t, "text/plain", res.Header().Get("Content-Type"))
+	assert.Equal(t, "/users  #1", res.Body.String())
+	etag := res.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	res = serveMiddleware(handler, http.MethodGet, "/users?page=1", map[string]string{"If-None-Match": etag})
+	assert.Equal(t, http.StatusNotModified, res.Code)
+	assert.Empty(t, res.Body.String())
+
+	res = serveMiddleware(handler, http.MethodGet, "/users?page=2", nil)
+	assert.Equal(t, "/users  #2", res.Body.String())
+	res = serveMiddleware(handler, http.MethodHead, "/users?page=1", nil)
+	assert.Equal(t, "MISS", res.Header().Get(mnemosyne.HeaderXCache), "HEAD is another key")
+	res = serveMiddleware(handler, http.MethodPost, "/users?page=1", nil)
+	assert.Equal(t, "BYPASS", res.Header().Get(mnemosyne.HeaderXCache))
+	res = serveMiddleware(handler, http.MethodGet, "/users?page=1", map[string]string{"Authorization": "Bearer token"})
+	assert.Equal(t, "BYPASS", res.Header().Get(mnemosyne.HeaderXCache))
+	assert.Equal(t, int32(5), atomic.LoadInt32(&next.served))
+}
+
+func TestMiddlewareOverAnyInstance(t *testing.T) {
+	next := &countingHandler{}
+	handler := mnemosyne.NewMiddleware(mnemosynetest.New(mnemosynetest.WithSoftTTL(time.Minute)), mnemosyne.MiddlewareOptions{})(next)
+	serveMiddleware(handler, http.MethodGet, "/users", nil)
+	res := serveMiddleware(handler, http.MethodGet, "/users", nil)
+	assert.Equal(t, "HIT from "+mnemosynetest.LayerName, res.Header().Get(mnemosyne.HeaderXCache))
+	assert.Equal(t, "/users  #1", res.Body.String())
+}
+
+func TestMiddlewareCacheControl(t *testing.T) {
+	clock := mnemosyne.NewFakeClock(time.Now())
+	next := &countingHandler{}
+	handler := mnemosyne.NewMiddleware(newMiddlewareInstance(t, clock), mnemosyne.MiddlewareOptions{})(next)
+
+	serveMiddleware(handler, http.MethodGet, "/a", nil)
+	res := serveMiddleware(handler, http.MethodGet, "/a", map[string]string{"Cache-Control": "no-cache"})
+	assert.Equal(t, "/a  #2", res.Body.String(), "no-cache requests skip the cache")
+	clock.Advance(10 * time.Second)
+	res = serveMiddleware(handler, http.MethodGet, "/a", map[string]string{"Cache-Control": "max-age=5"})
+	assert.Equal(t, "/a  #3", res.Body.String(), "the cached response is older than the request accepts")
+	res = serveMiddleware(handler, http.MethodGet, "/a", map[string]string{"Cache-Control": "max-age=5"})
+	assert.Equal(t, "/a  #3", res.Body.String())
+	res = serveMiddleware(handler, http.MethodGet, "/b", map[string]string{"Cache-Control": "only-if-cached"})
+	assert.Equal(t, http.StatusGatewayTimeout, res.Code)
+
+	next.cacheControl = "private, max-age=60"
+	serveMiddleware(handler, http.MethodGet, "/private", nil)
+	res = serveMiddleware(handler, http.MethodGet, "/private", nil)
+	assert.Equal(t, "MISS", res.Header().Get(mnemosyne.HeaderXCache), "private responses aren't cached")
+
+	next.cacheControl = "no-store"
+	serveMiddleware(handler, http.MethodGet, "/no-store", nil)
+	res = serveMiddleware(handler, http.MethodGet, "/no-store", nil)
+	assert.Equal(t, "MISS", res.Header().Get(mnemosyne.HeaderXCache))
+
+	// a max-age longer than the soft-TTL keeps the response fresh
+	next.cacheControl = "public, max-age=300"
+	serveMiddleware(handler, http.MethodGet, "/long", nil)
+	clock.Advance(2 * time.Minute)
+	res = serveMiddleware(handler, http.MethodGet, "/long", nil)
+	assert.Equal(t, "HIT from http-tiny", res.Header().Get(mnemosyne.HeaderXCache))
+}
+
+func TestMiddlewareVary(t *testing.T) {
+	clock := mnemosyne.NewFakeClock(time.Now())
+	next := &countingHandler{vary: "Accept-Language"}
+	cacheInstance := newMiddlewareInstance(t, clock)
+	handler := mnemosyne.NewMiddleware(cacheInstance, mnemosyne.MiddlewareOptions{VaryHeaders: []string{"accept-language"}})(next)
+
+	serveMiddleware(handler, http.MethodGet, "/a", map[string]string{"Accept-Language": "en"})
+	serveMiddleware(handler, http.MethodGet, "/a", map[string]string{"Accept-Language": "fa"})
+	res := serveMiddleware(handler, http.MethodGet, "/a", map[string]string{"Accept-Language": "en"})
+	assert.Equal(t, "/a en #1", res.Body.String())
+	res = serveMiddleware(handler, http.MethodGet, "/a", map[string]string{"Accept-Language": "fa"})
+	assert.Equal(t, "/a fa #2", res.Body.String())
+
+	// varying on a header which isn't part of the key can't be cached
+	unkeyed := mnemosyne.NewMiddleware(cacheInstance, mnemosyne.MiddlewareOptions{})(next)
+	serveMiddleware(unkeyed, http.MethodGet, "/b", nil)
+	res = serveMiddleware(unkeyed, http.MethodGet, "/b", nil)
+	assert.Equal(t, "MISS", res.Header().Get(mnemosyne.HeaderXCache))
+}
+
+func TestMiddlewareStaleWhileRevalidate(t *testing.T) {
+	clock := mnemosyne.NewFakeClock(time.Now())
+	next := &countingHandler{}
+	handler := mnemosyne.NewMiddleware(newMiddlewareInstance(t, clock), mnemosyne.MiddlewareOptions{})(next)
+
+	serveMiddleware(handler, http.MethodGet, "/a", nil)
+	clock.Advance(2 * time.Minute)
+	res := serveMiddleware(handler, http.MethodGet, "/a", nil)
+	assert.Equal(t, "STALE from http-tiny", res.Header().Get(mnemosyne.HeaderXCache))
+	assert.Equal(t, "/a  #1", res.Body.String(), "the stale response is served right away")
+	assert.Eventually(t, func() bool {
+		res := serveMiddleware(handler, http.MethodGet, "/a", nil)
+		return res.Body.String() == "/a  #2" && res.Header().Get(mnemosyne.HeaderXCache) == "HIT from http-tiny"
+	}, time.Second, 5*time.Millisecond, "the response was revalidated in the background")
+}
+
+func TestMiddlewareKeyHasTheHost(t *testing.T) {
+	next := &countingHandler{}
+	handler := mnemosyne.NewMiddleware(newMiddlewareInstance(t, mnemosyne.NewFakeClock(time.Now())), mnemosyne.MiddlewareOptions{})(next)
+	serveMiddleware(handler, http.MethodGet, "http://a.example/users", nil)
+	res := serveMiddleware(handler, http.MethodGet, "http://b.example/users", nil)
+	assert.Equal(t, "MISS", res.Header().Get(mnemosyne.HeaderXCache), "another host is another key")
+	res = serveMiddleware(handler, http.MethodGet, "http://a.example/users", nil)
+	assert.Equal(t, "HIT from http-tiny", res.Header().Get(mnemosyne.HeaderXCache))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&next.served))
+}
+
+func TestMiddlewareRevalidatesOnce(t *testing.T) {
+	clock := mnemosyne.NewFakeClock(time.Now())
+	release := make(chan struct{})
+	var served int32
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&served, 1) > 1 {
+			<-release
+		}
+		fmt.Fprint(w, "users")
+	})
+	handler := mnemosyne.NewMiddleware(newMiddlewareInstance(t, clock), mnemosyne.MiddlewareOptions{})(next)
+
+	serveMiddleware(handler, http.MethodGet, "/users", nil)
+	clock.Advance(2 * time.Minute)
+	serveMiddleware(handler, http.MethodGet, "/users", nil)
+	for atomic.LoadInt32(&served) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	goroutines := runtime.NumGoroutine()
+	for i := 0; i < 20; i++ {
+		res := serveMiddleware(handler, http.MethodGet, "/users", nil)
+		assert.Equal(t, "STALE from http-tiny", res.Header().Get(mnemosyne.HeaderXCache))
+	}
+	assert.Eventually(t, func() bool { return runtime.NumGoroutine()-goroutines < 5 }, time.Second, 5*time.Millisecond,
+		"the stale hits don't leave goroutines waiting on the revalidation in flight")
+	close(release)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&served), "a single revalidation runs at a time")
+}
+
+func TestMiddlewareRecoversRevalidationPanics(t *testing.T) {
+	clock := mnemosyne.NewFakeClock(time.Now())
+	logger := &recordingLogger{}
+	var served int32
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&served, 1) > 1 {
+			panic("boom")
+		}
+		fmt.Fprint(w, "users")
+	})
+	instance := newTestInstance(t, "http", "tiny", map[string]interface{}{"soft-ttl": "1m"},
+		mnemosyne.WithClock(clock), mnemosyne.WithLogger(logger), mnemosyne.WithLogRateLimit(0))
+	handler := mnemosyne.NewMiddleware(instance, mnemosyne.MiddlewareOptions{})(next)
+
+	serveMiddleware(handler, http.MethodGet, "/users", nil)
+	clock.Advance(2 * time.Minute)
+	res := serveMiddleware(handler, http.MethodGet, "/users", nil)
+	assert.Equal(t, "STALE from http-tiny", res.Header().Get(mnemosyne.HeaderXCache))
+	assert.Eventually(t, func() bool { return loggedError(logger, "failed to revalidate a response") }, time.Second, 5*time.Millisecond,
+		"the panic of the revalidation is logged rather than crashing the server")
+	assert.Eventually(t, func() bool {
+		serveMiddleware(handler, http.MethodGet, "/users", nil)
+		return atomic.LoadInt32(&served) > 2
+	}, time.Second, 5*time.Millisecond, "the key is revalidated again after the panic")
+}
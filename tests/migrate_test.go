@@ -0,0 +1,68 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis"
+	"github.com/mghayour/mnemosyne"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrateConfig(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	config := viper.New()
+	config.Set("service.port", 8080)
+	config.Set("cache.migrate.soft-ttl", "2h")
+	config.Set("cache.migrate.layers", []string{"migrate-memory", "migrate-gaurdian", "migrate-redis"})
+	config.Set("cache.migrate.migrate-memory.type", "memory")
+	config.Set("cache.migrate.migrate-memory.max-memory", 16)
+	config.Set("cache.migrate.migrate-gaurdian.type", "gaurdian")
+	config.Set("cache.migrate.migrate-gaurdian.address", mr.Addr())
+	config.Set("cache.migrate.migrate-gaurdian.db", 2)
+	config.Set("cache.migrate.migrate-gaurdian.ttl", "1h")
+	config.Set("cache.migrate.migrate-gaurdian.compression", true)
+	config.Set("cache.migrate.migrate-redis.type", "redis")
+	config.Set("cache.migrate.migrate-redis.address", mr.Addr())
+	config.Set("cache.migrate.migrate-redis.ttl", "1h")
+	config.Set("cache.migrate.migrate-redis.slaves", []string{"localhost:1"})
+
+	migration := mnemosyne.MigrateConfig(config)
+	assert.Equal(t, []string{"cache.migrate.migrate-gaurdian", "cache.migrate.migrate-redis"}, migration.Migrated)
+	assert.Len(t, migration.Problems, 1)
+	assert.Equal(t, "cache.migrate.migrate-redis.slaves", migration.Problems[0].Key)
+	assert.True(t, migration.Problems[0].Warning)
+	assert.Equal(t, "gaurdian", config.GetString("cache.migrate.migrate-gaurdian.type"))
+
+	migrated := migration.Config
+	assert.Equal(t, 8080, migrated.GetInt("service.port"))
+	assert.Equal(t, "memory", migrated.GetString("cache.migrate.migrate-memory.type"))
+	assert.Equal(t, "rediscluster", migrated.GetString("cache.migrate.migrate-gaurdian.type"))
+	assert.Equal(t, 2, migrated.GetInt("cache.migrate.migrate-gaurdian.db"))
+	assert.Equal(t, "1h", migrated.GetString("cache.migrate.migrate-gaurdian.ttl"))
+	assert.True(t, migrated.GetBool("cache.migrate.migrate-gaurdian.compression"))
+	assert.False(t, migrated.IsSet("cache.migrate.migrate-gaurdian.address"))
+	assert.Empty(t, mnemosyne.ValidateConfig(migrated))
+
+	// data written through the old config stays readable through the migrated one
+	ctx := context.Background()
+	user := TestTypeUser{UserName: "migrated"}
+	assert.Nil(t, mnemosyne.NewMnemosyne(config, nil, nil).Select("migrate").Set(ctx, "user", &user))
+	migratedInstance := mnemosyne.NewMnemosyne(migrated, nil, nil).Select("migrate")
+	for _, layerName := range []string{"migrate-gaurdian", "migrate-redis"} {
+		layer, err := migratedInstance.Layer(layerName)
+		assert.Nil(t, err)
+		explanation := layer.Explain(ctx, "user")
+		assert.True(t, explanation.Decoded, layerName)
+		assert.Equal(t, mr.Addr(), explanation.Address)
+	}
+	var result TestTypeUser
+	_, err = migratedInstance.Get(ctx, "user", &result)
+	assert.Nil(t, err)
+	assert.Equal(t, user, result)
+}
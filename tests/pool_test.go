@@ -0,0 +1,140 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mghayour/mnemosyne"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// blockingFills holds every background fill of the upper layers until released
+type blockingFills struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingFills) OnStart(parent context.Context, s sdktrace.ReadWriteSpan) {
+	if s.Name() == "mnemosyne.fillUpperLayers" {
+		b.started <- struct{}{}
+		<-b.release
+	}
+}
+func (b *blockingFills) OnEnd(s sdktrace.ReadOnlySpan)        {}
+func (b *blockingFills) Shutdown(ctx context.Context) error   { return nil }
+func (b *blockingFills) ForceFlush(ctx context.Context) error { return nil }
+
+func newPoolTestCache(t *testing.T, dropPolicy string, opts ...mnemosyne.Option) (*mnemosyne.MnemosyneInstance, *blockingFills) {
+	config := viper.New()
+	config.Set("cache.pooled.soft-ttl", "2h")
+	config.Set("cache.pooled.background.workers", 1)
+	config.Set("cache.pooled.background.queue-size", 1)
+	config.Set("cache.pooled.background.drop-policy", dropPolicy)
+	config.Set("cache.pooled.layers", []string{"pooled-tiny", "pooled-fast"})
+	config.Set("cache.pooled.pooled-tiny.type", "tiny")
+	config.Set("cache.pooled.pooled-fast.type", "fastmemory")
+	config.Set("cache.pooled.pooled-fast.ttl", "1h")
+	fills := &blockingFills{started: make(chan struct{}, 16), release: make(chan struct{})}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(fills))
+	opts = append(opts, mnemosyne.WithTracerProvider(provider))
+	cacheInstance := closeOnCleanup(t, mnemosyne.NewMnemosyne(config, nil, nil, opts...).Select("pooled"))
+	ctx := context.Background()
+	for _, key := range []string{"first", "second", "third"} {
+		assert.Nil(t, cacheInstance.Set(ctx, key, &TestTypeUser{UserName: key}))
+	}
+	assert.Nil(t, cacheInstance.Flush("pooled-tiny"))
+	return cacheInstance, fills
+}
+
+// fillQueue occupies the only worker with the first key, then queues the second and the third one
+func fillQueue(t *testing.T, cacheInstance *mnemosyne.MnemosyneInstance, fills *blockingFills) {
+	ctx := context.Background()
+	_, err := cacheInstance.Get(ctx, "first", &TestTypeUser{})
+	assert.Nil(t, err)
+	<-fills.started
+	for _, key := range []string{"second", "third"} {
+		_, err = cacheInstance.Get(ctx, key, &TestTypeUser{})
+		assert.Nil(t, err)
+	}
+}
+
+func filledKeys(t *testing.T, cacheInstance *mnemosyne.MnemosyneInstance) []string {
+	layer, err := cacheInstance.Layer("pooled-tiny")
+	assert.Nil(t, err)
+	var keys []string
+	for _, key := range []string{"first", "second", "third"} {
+		if layer.Explain(context.Background(), key).Present {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func waitForIdlePool(t *testing.T, cacheInstance *mnemosyne.MnemosyneInstance, fills *blockingFills) {
+	close(fills.release)
+	assert.Eventually(t, func() bool {
+		background := cacheInstance.Stats().Background
+		return background.QueueDepth == 0 && background.Workers == 0
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestBackgroundDropNewest(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	cacheInstance, fills := newPoolTestCache(t, mnemosyne.DropNewest, mnemosyne.WithPrometheus(registry))
+	fillQueue(t, cacheInstance, fills)
+	assert.Equal(t, mnemosyne.BackgroundStats{QueueDepth: 1, Workers: 1, Dropped: 1}, cacheInstance.Stats().Background)
+	families, err := registry.Gather()
+	assert.Nil(t, err)
+	cacheLabels := map[string]string{mnemosyne.LabelCache: "pooled"}
+	dropped := findMetric(families, "mnemosyne_background_dropped_total", cacheLabels)
+	assert.NotNil(t, dropped)
+	assert.Equal(t, 1.0, dropped.GetCounter().GetValue())
+	depth := findMetric(families, "mnemosyne_background_queue_depth", cacheLabels)
+	assert.NotNil(t, depth)
+	assert.Equal(t, 1.0, depth.GetGauge().GetValue())
+
+	waitForIdlePool(t, cacheInstance, fills)
+	assert.Equal(t, []string{"first", "second"}, filledKeys(t, cacheInstance))
+}
+
+func TestBackgroundDropOldest(t *testing.T) {
+	cacheInstance, fills := newPoolTestCache(t, mnemosyne.DropOldest)
+	fillQueue(t, cacheInstance, fills)
+	assert.Equal(t, uint64(1), cacheInstance.Stats().Background.Dropped)
+
+	waitForIdlePool(t, cacheInstance, fills)
+	assert.Equal(t, []string{"first", "third"}, filledKeys(t, cacheInstance))
+}
+
+func TestBackgroundCoalescing(t *testing.T) {
+	cacheInstance, fills := newPoolTestCache(t, mnemosyne.DropNewest)
+	ctx := context.Background()
+	_, err := cacheInstance.Get(ctx, "first", &TestTypeUser{})
+	assert.Nil(t, err)
+	<-fills.started
+	for i := 0; i < 3; i++ {
+		_, err = cacheInstance.Get(ctx, "second", &TestTypeUser{})
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, mnemosyne.BackgroundStats{QueueDepth: 1, Workers: 1, Coalesced: 2}, cacheInstance.Stats().Background)
+
+	waitForIdlePool(t, cacheInstance, fills)
+	assert.Equal(t, []string{"first", "second"}, filledKeys(t, cacheInstance))
+}
+
+func TestBackgroundCloseDiscardsQueue(t *testing.T) {
+	cacheInstance, fills := newPoolTestCache(t, mnemosyne.DropNewest)
+	fillQueue(t, cacheInstance, fills)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := cacheInstance.Close(ctx)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Equal(t, 0, cacheInstance.Stats().Background.QueueDepth)
+	assert.Equal(t, uint64(2), cacheInstance.Stats().Background.Dropped)
+	close(fills.release)
+}
@@ -0,0 +1,63 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mghayour/mnemosyne"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func findMetric(families []*dto.MetricFamily, name string, labels map[string]string) *dto.Metric {
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	metrics:
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if value, ok := labels[label.GetName()]; ok && value != label.GetValue() {
+					continue metrics
+				}
+			}
+			return metric
+		}
+	}
+	return nil
+}
+
+func TestPrometheusCollector(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	cacheInstance := newTestInstance(t, "metrics", "memory", map[string]interface{}{
+		"soft-ttl":         "2h",
+		"layer.max-memory": 64,
+		"layer.ttl":        "1h",
+	}, mnemosyne.WithPrometheus(registry))
+	ctx := context.Background()
+
+	assert.Nil(t, cacheInstance.Set(ctx, "user", &TestTypeUser{UserName: "metrics"}))
+	_, err := cacheInstance.Get(ctx, "user", &TestTypeUser{})
+	assert.Nil(t, err)
+	_, err = cacheInstance.Get(ctx, "absent", &TestTypeUser{})
+	assert.NotNil(t, err)
+
+	families, err := registry.Gather()
+	assert.Nil(t, err)
+	layerLabels := map[string]string{mnemosyne.LabelCache: "metrics", mnemosyne.LabelLayer: "metrics-memory"}
+
+	hits := findMetric(families, "mnemosyne_hits_total", layerLabels)
+	assert.NotNil(t, hits)
+	assert.Equal(t, 1.0, hits.GetCounter().GetValue())
+	misses := findMetric(families, "mnemosyne_misses_total", map[string]string{mnemosyne.LabelCache: "metrics"})
+	assert.NotNil(t, misses)
+	assert.Equal(t, 1.0, misses.GetCounter().GetValue())
+	entries := findMetric(families, "mnemosyne_layer_entries", layerLabels)
+	assert.NotNil(t, entries)
+	assert.Equal(t, 1.0, entries.GetGauge().GetValue())
+	latency := findMetric(families, "mnemosyne_operation_duration_seconds",
+		map[string]string{mnemosyne.LabelCache: "metrics", mnemosyne.LabelOperation: "get"})
+	assert.NotNil(t, latency)
+	assert.Equal(t, uint64(2), latency.GetHistogram().GetSampleCount())
+}
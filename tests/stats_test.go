@@ -0,0 +1,62 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis"
+	"github.com/mghayour/mnemosyne"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatsSnapshot(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	config := viper.New()
+	config.Set("cache.stats.soft-ttl", "2h")
+	config.Set("cache.stats.layers", []string{"stats-tiny", "stats-redis"})
+	config.Set("cache.stats.stats-tiny.type", "tiny")
+	config.Set("cache.stats.stats-redis.type", "redis")
+	config.Set("cache.stats.stats-redis.address", mr.Addr())
+	manager := mnemosyne.NewMnemosyne(config, nil, nil)
+	cacheInstance := manager.Select("stats")
+	ctx := context.Background()
+
+	assert.Nil(t, cacheInstance.Set(ctx, "user", &TestTypeUser{UserName: "stats"}))
+	_, err = cacheInstance.Get(ctx, "user", &TestTypeUser{})
+	assert.Nil(t, err)
+	_, err = cacheInstance.Get(ctx, "absent", &TestTypeUser{})
+	assert.NotNil(t, err)
+	assert.Nil(t, cacheInstance.Flush("stats-tiny"))
+	_, err = cacheInstance.Get(ctx, "user", &TestTypeUser{})
+	assert.Nil(t, err)
+
+	assert.Eventually(t, func() bool {
+		return cacheInstance.Stats().Backfills == 1
+	}, time.Second, 10*time.Millisecond)
+	stats := cacheInstance.Stats()
+	assert.Equal(t, uint64(3), stats.Lookups)
+	assert.Equal(t, uint64(2), stats.Hits)
+	assert.Equal(t, uint64(1), stats.Misses)
+	assert.InDelta(t, 2.0/3, stats.HitRate, 0.001)
+	assert.InDelta(t, 2.0/3, stats.WindowHitRate, 0.001)
+	assert.Equal(t, uint64(2), stats.Hotness.Hot)
+	assert.Equal(t, uint64(3), stats.Latency["get"].Count)
+	assert.Equal(t, uint64(1), stats.Latency["set"].Count)
+	assert.Equal(t, "stats-tiny", stats.Layers[0].Name)
+	assert.Equal(t, uint64(3), stats.Layers[0].Lookups)
+	assert.Equal(t, uint64(1), stats.Layers[0].Hits)
+	assert.Equal(t, uint64(1), stats.Layers[0].Backfills)
+	assert.Equal(t, uint64(2), stats.Layers[1].Lookups)
+	assert.Equal(t, uint64(1), stats.Layers[1].Hits)
+
+	total := manager.Stats()
+	assert.Equal(t, stats.Hits, total.Hits)
+	assert.Equal(t, stats.Misses, total.Misses)
+	assert.Contains(t, total.Instances, "stats")
+}
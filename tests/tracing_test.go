@@ -0,0 +1,104 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis"
+	"github.com/mghayour/mnemosyne"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func spanAttribute(span sdktrace.ReadOnlySpan, key string) interface{} {
+	for _, attr := range span.Attributes() {
+		if string(attr.Key) == key {
+			return attr.Value.AsInterface()
+		}
+	}
+	return nil
+}
+
+func TestTracingSpans(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	config := viper.New()
+	config.Set("cache.traced.soft-ttl", "2h")
+	config.Set("cache.traced.layers", []string{"traced-tiny", "traced-redis"})
+	config.Set("cache.traced.traced-tiny.type", "tiny")
+	config.Set("cache.traced.traced-redis.type", "redis")
+	config.Set("cache.traced.traced-redis.address", mr.Addr())
+	config.Set("cache.traced.traced-redis.compression", true)
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	cacheInstance := mnemosyne.NewMnemosyne(config, nil, nil, mnemosyne.WithTracerProvider(provider)).Select("traced")
+	ctx := context.Background()
+
+	assert.Nil(t, cacheInstance.Set(ctx, "user", &TestTypeUser{UserName: "traced"}))
+	assert.Nil(t, cacheInstance.Flush("traced-tiny"))
+	_, err = cacheInstance.Get(ctx, "user", &TestTypeUser{})
+	assert.Nil(t, err)
+
+	var getSpan sdktrace.ReadOnlySpan
+	assert.Eventually(t, func() bool {
+		for _, span := range recorder.Ended() {
+			if span.Name() == "mnemosyne.Get" {
+				getSpan = span
+			}
+			if span.Name() == "mnemosyne.fillUpperLayers" {
+				return true
+			}
+		}
+		return false
+	}, time.Second, 10*time.Millisecond)
+	assert.NotNil(t, getSpan)
+	assert.Equal(t, true, spanAttribute(getSpan, "mnemosyne.hit"))
+
+	var layerGets, backfills int
+	for _, span := range recorder.Ended() {
+		switch span.Name() {
+		case "mnemosyne.layer.get":
+			layerGets++
+			assert.Equal(t, getSpan.SpanContext().SpanID(), span.Parent().SpanID())
+			if spanAttribute(span, "mnemosyne.layer") == "traced-redis" {
+				assert.Equal(t, true, spanAttribute(span, "mnemosyne.hit"))
+				assert.Equal(t, true, spanAttribute(span, "mnemosyne.payload.compressed"))
+				assert.NotNil(t, spanAttribute(span, "mnemosyne.payload.size"))
+			} else {
+				assert.Equal(t, false, spanAttribute(span, "mnemosyne.hit"))
+			}
+		case "mnemosyne.fillUpperLayers":
+			backfills++
+			assert.Len(t, span.Links(), 1)
+			assert.Equal(t, getSpan.SpanContext().SpanID(), span.Links()[0].SpanContext.SpanID())
+		}
+	}
+	assert.Equal(t, 2, layerGets)
+	assert.Equal(t, 1, backfills)
+}
+
+func TestTracingGetEntriesRecordsErrors(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	cacheInstance := newTestInstance(t, "traced", "tiny", map[string]interface{}{"layer.chaos.error": 100},
+		mnemosyne.WithTracerProvider(provider))
+
+	_, errs := cacheInstance.GetEntries(context.Background(), []string{"a", "b"}, []interface{}{&TestTypeUser{}, &TestTypeUser{}})
+	assert.NotNil(t, errs[0])
+	var getSpan sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		if span.Name() == "mnemosyne.GetEntries" {
+			getSpan = span
+		}
+	}
+	assert.NotNil(t, getSpan)
+	assert.Equal(t, codes.Error, getSpan.Status().Code, "the errors of the keys are recorded on the span")
+	assert.Equal(t, "error", spanAttribute(getSpan, "mnemosyne.outcome"))
+}
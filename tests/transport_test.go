@@ -0,0 +1,209 @@
+package tests
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mghayour/mnemosyne"
+	"github.com/stretchr/testify/assert"
+)
+
+// upstream is a slow third-party API, whose answers the tests change on the fly
+type upstream struct {
+	clock        mnemosyne.Clock
+	mu           sync.Mutex
+	requests     []*http.Request
+	status       int
+	cacheControl string
+	etag         string
+	lastModified string
+	version      int
+}
+
+func (u *upstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.requests = append(u.requests, r)
+	// the API's clock agrees with the client's
+	w.Header().Set("Date", u.clock.Now().UTC().Format(http.TimeFormat))
+	if u.cacheControl != "" {
+		w.Header().Set("Cache-Control", u.cacheControl)
+	}
+	if u.etag != "" {
+		w.Header().Set("ETag", u.etag)
+		if r.Header.Get("If-None-Match") == u.etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	if u.lastModified != "" {
+		w.Header().Set("Last-Modified", u.lastModified)
+		if r.Header.Get("If-Modified-Since") == u.lastModified {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	if u.status != 0 {
+		w.WriteHeader(u.status)
+	}
+	fmt.Fprintf(w, "%s v%d", r.URL.Path, u.version)
+	if authorization := r.Header.Get("Authorization"); authorization != "" {
+		fmt.Fprintf(w, " for %s", authorization)
+	}
+}
+
+func (u *upstream) set(f func(u *upstream)) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	f(u)
+}
+
+func (u *upstream) lastRequest() *http.Request {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.requests[len(u.requests)-1]
+}
+
+func (u *upstream) requestCount() int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return len(u.requests)
+}
+
+func newTransportClient(t *testing.T, options mnemosyne.TransportOptions) (*http.Client, *upstream, *httptest.Server, *mnemosyne.FakeClock) {
+	clock := mnemosyne.NewFakeClock(time.Now())
+	api := &upstream{clock: clock, cacheControl: "max-age=60"}
+	server := httptest.NewServer(api)
+	cacheInstance := newTestInstance(t, "http", "tiny", map[string]interface{}{"soft-ttl": "1m"}, mnemosyne.WithClock(clock))
+	return &http.Client{Transport: mnemosyne.NewTransport(cacheInstance, options)}, api, server, clock
+}
+
+func fetch(t *testing.T, client *http.Client, method, url string, header map[string]string) (*http.Response, string) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, value := range header {
+		req.Header.Set(name, value)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	assert.Nil(t, err)
+	return res, string(body)
+}
+
+func TestTransportFreshness(t *testing.T) {
+	client, api, server, clock := newTransportClient(t, mnemosyne.TransportOptions{})
+	defer server.Close()
+
+	res, body := fetch(t, client, http.MethodGet, server.URL+"/a", nil)
+	assert.Equal(t, "MISS", res.Header.Get(mnemosyne.HeaderXCache))
+	assert.Equal(t, "/a v0", body)
+
+	clock.Advance(30 * time.Second)
+	api.set(func(u *upstream) { u.version = 1 })
+	res, body = fetch(t, client, http.MethodGet, server.URL+"/a", nil)
+	assert.Equal(t, "HIT from http-tiny", res.Header.Get(mnemosyne.HeaderXCache))
+	assert.Equal(t, "/a v0", body)
+	assert.Equal(t, "30", res.Header.Get("Age"))
+	assert.Equal(t, 1, api.requestCount())
+
+	res, body = fetch(t, client, http.MethodGet, server.URL+"/a", map[string]string{"Cache-Control": "max-age=10"})
+	assert.Equal(t, "/a v1", body, "the request doesn't accept a response that old")
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	// unsafe methods invalidate the URL, and no-store responses aren't stored
+	api.set(func(u *upstream) { u.version, u.cacheControl = 2, "no-store" })
+	fetch(t, client, http.MethodPost, server.URL+"/a", nil)
+	_, body = fetch(t, client, http.MethodGet, server.URL+"/a", nil)
+	assert.Equal(t, "/a v2", body)
+	res, _ = fetch(t, client, http.MethodGet, server.URL+"/a", nil)
+	assert.Equal(t, "", res.Header.Get(mnemosyne.HeaderXCache))
+	assert.Equal(t, 5, api.requestCount())
+}
+
+func TestTransportAuthorizedResponses(t *testing.T) {
+	for _, shared := range []bool{false, true} {
+		client, api, server, _ := newTransportClient(t, mnemosyne.TransportOptions{Shared: shared})
+		defer server.Close()
+
+		for i := 0; i < 2; i++ {
+			for _, token := range []string{"alice", "bob"} {
+				res, body := fetch(t, client, http.MethodGet, server.URL+"/me", map[string]string{"Authorization": token})
+				assert.Equal(t, "/me v0 for "+token, body, "callers never see each other's responses (shared: %v)", shared)
+				assert.Equal(t, "", res.Header.Get(mnemosyne.HeaderXCache))
+			}
+		}
+		assert.Equal(t, 4, api.requestCount())
+
+		// unless the responses are marked to be shared
+		api.set(func(u *upstream) { u.cacheControl = "public, max-age=60" })
+		fetch(t, client, http.MethodGet, server.URL+"/me", map[string]string{"Authorization": "alice"})
+		res, body := fetch(t, client, http.MethodGet, server.URL+"/me", map[string]string{"Authorization": "bob"})
+		assert.Equal(t, "HIT from http-tiny", res.Header.Get(mnemosyne.HeaderXCache))
+		assert.Equal(t, "/me v0 for alice", body)
+	}
+}
+
+func TestTransportRevalidation(t *testing.T) {
+	client, api, server, clock := newTransportClient(t, mnemosyne.TransportOptions{})
+	defer server.Close()
+	api.set(func(u *upstream) { u.etag = `"v0"` })
+
+	fetch(t, client, http.MethodGet, server.URL+"/etag", nil)
+	clock.Advance(2 * time.Minute)
+	res, body := fetch(t, client, http.MethodGet, server.URL+"/etag", nil)
+	assert.Equal(t, `"v0"`, api.lastRequest().Header.Get("If-None-Match"))
+	assert.Equal(t, "REVALIDATED from http-tiny", res.Header.Get(mnemosyne.HeaderXCache))
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "/etag v0", body)
+	res, _ = fetch(t, client, http.MethodGet, server.URL+"/etag", nil)
+	assert.Equal(t, "HIT from http-tiny", res.Header.Get(mnemosyne.HeaderXCache), "the 304 freshened the response")
+
+	// the conditional requests of the caller are answered from the cache
+	res, _ = fetch(t, client, http.MethodGet, server.URL+"/etag", map[string]string{"If-None-Match": `"v0"`})
+	assert.Equal(t, http.StatusNotModified, res.StatusCode)
+
+	lastModified := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+	api.set(func(u *upstream) { u.etag, u.lastModified, u.cacheControl = "", lastModified, "no-cache" })
+	fetch(t, client, http.MethodGet, server.URL+"/modified", nil)
+	res, body = fetch(t, client, http.MethodGet, server.URL+"/modified", nil)
+	assert.Equal(t, lastModified, api.lastRequest().Header.Get("If-Modified-Since"), "no-cache responses are revalidated every time")
+	assert.Equal(t, "REVALIDATED from http-tiny", res.Header.Get(mnemosyne.HeaderXCache))
+	assert.Equal(t, "/modified v0", body)
+}
+
+func TestTransportStaleIfError(t *testing.T) {
+	client, api, server, clock := newTransportClient(t, mnemosyne.TransportOptions{StaleIfError: 5 * time.Minute})
+	defer server.Close()
+
+	fetch(t, client, http.MethodGet, server.URL+"/a", nil)
+	api.set(func(u *upstream) { u.cacheControl, u.version = "max-age=60, must-revalidate", 1 })
+	fetch(t, client, http.MethodGet, server.URL+"/strict", nil)
+	api.set(func(u *upstream) { u.status = http.StatusServiceUnavailable })
+	clock.Advance(3 * time.Minute)
+
+	res, body := fetch(t, client, http.MethodGet, server.URL+"/a", nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "STALE from http-tiny", res.Header.Get(mnemosyne.HeaderXCache))
+	assert.Equal(t, "/a v0", body)
+	res, _ = fetch(t, client, http.MethodGet, server.URL+"/strict", nil)
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode, "must-revalidate responses aren't served stale")
+
+	// the upstream being unreachable is an error too
+	server.Close()
+	res, _ = fetch(t, client, http.MethodGet, server.URL+"/a", nil)
+	assert.Equal(t, "STALE from http-tiny", res.Header.Get(mnemosyne.HeaderXCache))
+	clock.Advance(5 * time.Minute)
+	_, err := client.Get(server.URL + "/a")
+	assert.NotNil(t, err, "the stale-if-error window is over")
+}
@@ -0,0 +1,119 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mghayour/mnemosyne"
+	"github.com/mghayour/mnemosyne/mnemosynetest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTypedGetAndSet(t *testing.T) {
+	users := mnemosyne.Typed[*TestTypeUser](newFastMemoryInstance(t, mnemosyne.ValueModeCodec))
+	ctx := context.Background()
+
+	assert.Nil(t, users.Set(ctx, "user", &TestTypeUser{UserName: "typed", Info: TestTypeUserInfo{RoomNumber: 7}}))
+	user, err := users.Get(ctx, "user")
+	assert.Nil(t, err)
+	assert.Equal(t, "typed", user.UserName)
+	assert.Equal(t, int64(7), user.Info.RoomNumber)
+
+	_, err = users.Get(ctx, "missing")
+	assert.True(t, errors.Is(err, mnemosyne.ErrMiss))
+
+	// non-pointer types work too, and the untyped API reads what the typed one set
+	infos := mnemosyne.Typed[TestTypeUserInfo](users.Instance())
+	assert.Nil(t, infos.Set(ctx, "info", TestTypeUserInfo{SchoolName: "typed"}))
+	info, err := infos.Get(ctx, "info")
+	assert.Nil(t, err)
+	assert.Equal(t, "typed", info.SchoolName)
+	res, err := users.Instance().Get(ctx, "info", &TestTypeUserInfo{})
+	assert.Nil(t, err)
+	assert.Equal(t, "typed", res.(*TestTypeUserInfo).SchoolName)
+}
+
+func TestTypedZeroCopyMismatch(t *testing.T) {
+	cacheInstance := newFastMemoryInstance(t, mnemosyne.ValueModeZeroCopy)
+	ctx := context.Background()
+	original := &TestTypeUser{UserName: "shared"}
+	assert.Nil(t, cacheInstance.Set(ctx, "user", original))
+
+	user, err := mnemosyne.Typed[*TestTypeUser](cacheInstance).Get(ctx, "user")
+	assert.Nil(t, err)
+	assert.True(t, user == original)
+	byValue, err := mnemosyne.Typed[TestTypeUser](cacheInstance).Get(ctx, "user")
+	assert.Nil(t, err)
+	assert.Equal(t, "shared", byValue.UserName)
+
+	// a differently typed value is an error rather than a panic
+	_, err = mnemosyne.Typed[*TestTypeUserInfo](cacheInstance).Get(ctx, "user")
+	assert.True(t, errors.Is(err, mnemosyne.ErrDecode))
+}
+
+func TestTypedGetOrLoad(t *testing.T) {
+	clock := mnemosyne.NewFakeClock(time.Now())
+	cache := mnemosynetest.New(mnemosynetest.WithSoftTTL(time.Hour), mnemosynetest.WithClock(clock))
+	users := mnemosyne.Typed[*TestTypeUser](cache)
+	ctx := context.Background()
+	loads := 0
+	loadErr := error(nil)
+	loader := func(ctx context.Context, key string) (*TestTypeUser, error) {
+		loads++
+		if loadErr != nil {
+			return nil, loadErr
+		}
+		return &TestTypeUser{UserName: key, Info: TestTypeUserInfo{ClassNumber: int32(loads)}}, nil
+	}
+
+	user, err := users.GetOrLoad(ctx, "user", loader)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), user.Info.ClassNumber)
+	user, err = users.GetOrLoad(ctx, "user", loader)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), user.Info.ClassNumber, "a fresh value isn't loaded again")
+
+	clock.Advance(2 * time.Hour)
+	user, err = users.GetOrLoad(ctx, "user", loader)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), user.Info.ClassNumber, "a stale value is reloaded")
+
+	loadErr = errors.New("database is down")
+	clock.Advance(2 * time.Hour)
+	user, err = users.GetOrLoad(ctx, "user", loader)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), user.Info.ClassNumber, "the stale value is served when loading fails")
+	_, err = users.GetOrLoad(ctx, "other", loader)
+	assert.Equal(t, loadErr, err)
+
+	loadErr = nil
+	cache.Inject(mnemosynetest.Fault{Op: mnemosynetest.OpSet, Err: mnemosyne.ErrLayerUnavailable})
+	user, err = users.GetOrLoad(ctx, "other", loader)
+	assert.True(t, errors.Is(err, mnemosyne.ErrLayerUnavailable))
+	assert.Equal(t, "other", user.UserName, "the loaded value is returned even if setting it fails")
+}
+
+func TestTypedMGet(t *testing.T) {
+	cache := mnemosynetest.New()
+	users := mnemosyne.Typed[*TestTypeUser](cache)
+	ctx := context.Background()
+	assert.Nil(t, users.Set(ctx, "a", &TestTypeUser{UserName: "a"}))
+	assert.Nil(t, users.Set(ctx, "b", &TestTypeUser{UserName: "b"}))
+
+	values, err := users.MGet(ctx, "a", "b", "missing")
+	assert.Nil(t, err)
+	assert.Len(t, values, 2)
+	assert.Equal(t, "b", values["b"].UserName)
+	for _, call := range cache.Calls()[2:] {
+		assert.Equal(t, "GetEntries", call.Method, "the keys are looked up at once")
+	}
+
+	// a failing layer is a miss, like with Get, but a closed instance isn't
+	cacheInstance := newFastMemoryInstance(t, mnemosyne.ValueModeCodec)
+	assert.Nil(t, cacheInstance.Close(ctx))
+	values, err = mnemosyne.Typed[*TestTypeUser](cacheInstance).MGet(ctx, "a")
+	assert.Len(t, values, 0)
+	assert.True(t, errors.Is(err, mnemosyne.ErrClosed))
+}
@@ -0,0 +1,91 @@
+package mnemosyne
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/mghayour/mnemosyne"
+
+// Attribute keys of the spans created by Mnemosyne
+const (
+	AttributeInstance    = attribute.Key("mnemosyne.instance")
+	AttributeLayer       = attribute.Key("mnemosyne.layer")
+	AttributeLayerIndex  = attribute.Key("mnemosyne.layer.index")
+	AttributeHit         = attribute.Key("mnemosyne.hit")
+	AttributeOutcome     = attribute.Key("mnemosyne.outcome")
+	AttributeAmnesia     = attribute.Key("mnemosyne.amnesia")
+	AttributePayloadSize = attribute.Key("mnemosyne.payload.size")
+	AttributeCompression = attribute.Key("mnemosyne.payload.compressed")
+	AttributeEncryption  = attribute.Key("mnemosyne.payload.encrypted")
+)
+
+func newTracer(provider trace.TracerProvider) trace.Tracer {
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return provider.Tracer(tracerName)
+}
+
+// startSpan starts the span of an operation on the instance
+func (mn *MnemosyneInstance) startSpan(ctx context.Context, op string) (context.Context, trace.Span) {
+	return mn.tracer.Start(ctx, "mnemosyne."+op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(AttributeInstance.String(mn.name)))
+}
+
+// startLayerSpan starts the span of an operation on a single layer
+func (mn *MnemosyneInstance) startLayerSpan(ctx context.Context, layer int, op string) (context.Context, trace.Span) {
+	return mn.tracer.Start(ctx, "mnemosyne.layer."+op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			AttributeInstance.String(mn.name),
+			AttributeLayer.String(mn.cacheLayers[layer].Name()),
+			AttributeLayerIndex.Int(layer),
+		))
+}
+
+// startBackgroundSpan detaches the background work started by a request from its context (so it isn't canceled
+// with the request) while linking its span to the originating one
+func (mn *MnemosyneInstance) startBackgroundSpan(origin context.Context, op string) (context.Context, trace.Span) {
+	return mn.tracer.Start(context.Background(), "mnemosyne."+op,
+		trace.WithLinks(trace.LinkFromContext(origin)),
+		trace.WithAttributes(AttributeInstance.String(mn.name)))
+}
+
+// endSpan records the outcome of an operation and ends its span, misses are not considered as errors
+func endSpan(span trace.Span, err error, lookup bool) {
+	outcome := outcomeOf(err)
+	span.SetAttributes(AttributeOutcome.String(outcome))
+	switch outcome {
+	case outcomeOK:
+		if lookup {
+			span.SetAttributes(AttributeHit.Bool(true))
+		}
+	case outcomeMiss:
+		span.SetAttributes(AttributeHit.Bool(false))
+	case outcomeAmnesia:
+		span.SetAttributes(AttributeHit.Bool(false), AttributeAmnesia.Bool(true))
+	default:
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// annotatePayload adds the details of an encoded payload to the current span
+func (bc *baseCache) annotatePayload(ctx context.Context, size int) {
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return
+	}
+	span.SetAttributes(
+		AttributePayloadSize.Int(size),
+		AttributeCompression.Bool(bc.compressionEnabled),
+		AttributeEncryption.Bool(bc.keyring != nil),
+	)
+}
@@ -0,0 +1,360 @@
+package mnemosyne
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxHeuristicLifetime caps the freshness guessed from the Last-Modified of a response
+const maxHeuristicLifetime = 24 * time.Hour
+
+// TransportOptions controls how NewTransport caches the responses
+type TransportOptions struct {
+	// Transport makes the requests (default: http.DefaultTransport)
+	Transport http.RoundTripper
+	// Shared follows the rules of shared caches (RFC 9111 section 3.5): s-maxage is preferred and private responses
+	// aren't stored. Either way, as all the callers of the transport share the cache, responses to requests with
+	// an Authorization header are stored only when marked public or given an s-maxage
+	Shared bool
+	// StaleIfError is how long after getting stale a response is served when the upstream fails (errors or
+	// answers with a 5xx), unless the response requires revalidation. The stale-if-error directive of
+	// the response extends it
+	StaleIfError time.Duration
+	// MaxBodySize is the size of the largest body cached (default: 1MB)
+	MaxBodySize int
+}
+
+type cachingTransport struct {
+	instance    ICacheInstance
+	integration Integration
+	options     TransportOptions
+}
+
+// NewTransport returns an http.RoundTripper caching the GET and HEAD responses in instance, following the freshness
+// rules of RFC 9111 and revalidating stale responses with If-None-Match and If-Modified-Since. Responses served from
+// the cache carry an Age and an X-Cache header. Successful unsafe requests (e.g. POST) invalidate their URL
+func NewTransport(instance ICacheInstance, options TransportOptions) http.RoundTripper {
+	if options.Transport == nil {
+		options.Transport = http.DefaultTransport
+	}
+	if options.MaxBodySize <= 0 {
+		options.MaxBodySize = 1 << 20
+	}
+	return &cachingTransport{instance: instance, integration: IntegrationOf(instance), options: options}
+}
+
+func (t *cachingTransport) key(method string, req *http.Request) string {
+	return MakeKey("http-client", method, req.URL.String())
+}
+
+func (t *cachingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		res, err := t.options.Transport.RoundTrip(req)
+		if err == nil && res.StatusCode < 400 && isUnsafeMethod(req.Method) {
+			t.instance.Delete(ctx, t.key(http.MethodGet, req))
+			t.instance.Delete(ctx, t.key(http.MethodHead, req))
+		}
+		return res, err
+	}
+	requestCC := parseCacheControl(req.Header.Get("Cache-Control"))
+	if len(requestCC) == 0 && strings.EqualFold(req.Header.Get("Pragma"), "no-cache") {
+		requestCC["no-cache"] = ""
+	}
+	if requestCC.has("no-store") {
+		return t.options.Transport.RoundTrip(req)
+	}
+	key := t.key(req.Method, req)
+
+	var cached *CachedResponse
+	var entry *Entry
+	var age time.Duration
+	if e, err := t.instance.GetEntry(ctx, key, &CachedResponse{}); err == nil {
+		if res, ok := e.Value.(*CachedResponse); ok && res.matches(req) {
+			cached, entry, age = res, e, res.Age+e.Age
+		}
+	}
+	if cached != nil && !requestCC.has("no-cache") {
+		if fresh, state := t.usable(requestCC, cached, age); fresh {
+			return cached.response(req, age, state+" from "+entry.LayerName), nil
+		}
+	}
+	if requestCC.has("only-if-cached") {
+		return syntheticResponse(req, http.StatusGatewayTimeout), nil
+	}
+
+	// the conditional requests of the caller are theirs to handle
+	conditional := req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != ""
+	upstreamReq := req
+	if cached != nil && !conditional {
+		upstreamReq = cached.revalidation(req)
+	}
+	requestTime := t.integration.Now()
+	res, err := t.options.Transport.RoundTrip(upstreamReq)
+	responseTime := t.integration.Now()
+	if err != nil || res.StatusCode >= 500 {
+		if cached != nil && t.staleIfError(requestCC, cached, age) {
+			if res != nil {
+				io.Copy(io.Discard, res.Body)
+				res.Body.Close()
+			}
+			return cached.response(req, age, "STALE from "+entry.LayerName), nil
+		}
+		return res, err
+	}
+	if res.StatusCode == http.StatusNotModified && cached != nil && !conditional {
+		io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+		t.freshen(cached, res.Header)
+		t.store(req, key, cached, cached.Header, requestTime, responseTime)
+		return cached.response(req, cached.Age, "REVALIDATED from "+entry.LayerName), nil
+	}
+	if requestCC.has("no-store") || !t.storable(req, res) {
+		return res, nil
+	}
+	return t.capture(req, key, res, requestTime, responseTime)
+}
+
+// usable tells whether a cached response can be used without going upstream, and how to report it
+func (t *cachingTransport) usable(requestCC cacheControl, cached *CachedResponse, age time.Duration) (bool, string) {
+	if cached.Revalidate {
+		return false, ""
+	}
+	if maxAge, ok := requestCC.duration("max-age"); ok && age > maxAge {
+		return false, ""
+	}
+	if minFresh, ok := requestCC.duration("min-fresh"); ok && cached.MaxAge-age < minFresh {
+		return false, ""
+	}
+	if age < cached.MaxAge {
+		return true, "HIT"
+	}
+	responseCC := parseCacheControl(cached.Header.Get("Cache-Control"))
+	if value, ok := requestCC["max-stale"]; ok && !t.mustRevalidate(responseCC) {
+		maxStale, limited := requestCC.duration("max-stale")
+		if value == "" || (limited && age-cached.MaxAge <= maxStale) {
+			return true, "STALE"
+		}
+	}
+	return false, ""
+}
+
+// staleIfError tells whether a stale response can be served in place of an upstream failure
+func (t *cachingTransport) staleIfError(requestCC cacheControl, cached *CachedResponse, age time.Duration) bool {
+	responseCC := parseCacheControl(cached.Header.Get("Cache-Control"))
+	if t.mustRevalidate(responseCC) {
+		return false
+	}
+	window := t.options.StaleIfError
+	for _, cc := range []cacheControl{responseCC, requestCC} {
+		if directive, ok := cc.duration("stale-if-error"); ok && directive > window {
+			window = directive
+		}
+	}
+	return age-cached.MaxAge <= window
+}
+
+func (t *cachingTransport) mustRevalidate(responseCC cacheControl) bool {
+	return responseCC.has("must-revalidate") || responseCC.has("no-cache") ||
+		(t.options.Shared && responseCC.has("proxy-revalidate"))
+}
+
+// storable tells whether a response may be stored (RFC 9111 section 3)
+func (t *cachingTransport) storable(req *http.Request, res *http.Response) bool {
+	responseCC := parseCacheControl(res.Header.Get("Cache-Control"))
+	if responseCC.has("no-store") || res.StatusCode < 200 ||
+		res.StatusCode == http.StatusPartialContent || res.StatusCode == http.StatusNotModified ||
+		strings.Contains(res.Header.Get("Vary"), "*") {
+		return false
+	}
+	if req.Header.Get("Authorization") != "" && !responseCC.has("public") && !responseCC.has("s-maxage") {
+		return false
+	}
+	if t.options.Shared && responseCC.has("private") {
+		return false
+	}
+	explicit := responseCC.has("max-age") || responseCC.has("public") || res.Header.Get("Expires") != "" ||
+		(t.options.Shared && responseCC.has("s-maxage"))
+	return explicit || cacheableStatuses[res.StatusCode]
+}
+
+// capture reads the body of a response to store it, handing the caller a response with the same body
+func (t *cachingTransport) capture(req *http.Request, key string, res *http.Response, requestTime, responseTime time.Time) (*http.Response, error) {
+	body, err := io.ReadAll(io.LimitReader(res.Body, int64(t.options.MaxBodySize)+1))
+	if err != nil {
+		res.Body.Close()
+		return nil, err
+	}
+	if len(body) > t.options.MaxBodySize {
+		res.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), res.Body), res.Body}
+		return res, nil
+	}
+	res.Body.Close()
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	cached := &CachedResponse{Status: res.StatusCode, Header: res.Header.Clone(), Body: body}
+	for _, vary := range res.Header.Values("Vary") {
+		for _, name := range strings.Split(vary, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				if cached.RequestHeader == nil {
+					cached.RequestHeader = http.Header{}
+				}
+				cached.RequestHeader[http.CanonicalHeaderKey(name)] = req.Header.Values(name)
+			}
+		}
+	}
+	t.store(req, key, cached, res.Header, requestTime, responseTime)
+	res.Header.Set(HeaderXCache, "MISS")
+	return res, nil
+}
+
+// store computes the freshness of a response from its headers (RFC 9111 section 4.2) and stores it
+func (t *cachingTransport) store(req *http.Request, key string, cached *CachedResponse, header http.Header, requestTime, responseTime time.Time) {
+	cached.MaxAge = t.lifetime(cached.Status, header, responseTime)
+	cached.Age = initialAge(header, requestTime, responseTime)
+	responseCC := parseCacheControl(header.Get("Cache-Control"))
+	cached.Revalidate = responseCC.has("no-cache") || cached.MaxAge <= 0
+	cached.Header.Del(HeaderXCache)
+	if err := t.instance.Set(req.Context(), key, cached); err != nil {
+		t.integration.LogError("failed to cache a response", key, err)
+	}
+}
+
+// freshen updates a stored response with the headers of a 304 (RFC 9111 section 4.3.4)
+func (t *cachingTransport) freshen(cached *CachedResponse, header http.Header) {
+	for name, values := range header {
+		switch http.CanonicalHeaderKey(name) {
+		case "Content-Length", "Content-Encoding", "Transfer-Encoding":
+			continue
+		}
+		cached.Header[name] = values
+	}
+}
+
+// lifetime is the freshness lifetime of a response (RFC 9111 section 4.2.1)
+func (t *cachingTransport) lifetime(status int, header http.Header, responseTime time.Time) time.Duration {
+	responseCC := parseCacheControl(header.Get("Cache-Control"))
+	if t.options.Shared {
+		if maxAge, ok := responseCC.duration("s-maxage"); ok {
+			return maxAge
+		}
+	}
+	if maxAge, ok := responseCC.duration("max-age"); ok {
+		return maxAge
+	}
+	date := headerTime(header, "Date", responseTime)
+	if expiresHeader := header.Get("Expires"); expiresHeader != "" {
+		expires, err := http.ParseTime(expiresHeader)
+		if err != nil {
+			// an invalid Expires means already expired
+			return 0
+		}
+		return expires.Sub(date)
+	}
+	if lastModified := headerTime(header, "Last-Modified", time.Time{}); !lastModified.IsZero() && cacheableStatuses[status] {
+		// a tenth of the time since the last modification, as suggested by RFC 9111 section 4.2.2
+		heuristic := date.Sub(lastModified) / 10
+		if heuristic > maxHeuristicLifetime {
+			heuristic = maxHeuristicLifetime
+		}
+		return heuristic
+	}
+	return 0
+}
+
+// initialAge is the age of a response when it was received (RFC 9111 section 4.2.3)
+func initialAge(header http.Header, requestTime, responseTime time.Time) time.Duration {
+	apparentAge := responseTime.Sub(headerTime(header, "Date", responseTime))
+	if apparentAge < 0 {
+		apparentAge = 0
+	}
+	var ageValue time.Duration
+	if seconds, err := strconv.ParseInt(header.Get("Age"), 10, 64); err == nil && seconds > 0 {
+		ageValue = time.Duration(seconds) * time.Second
+	}
+	correctedAge := ageValue + responseTime.Sub(requestTime)
+	if correctedAge > apparentAge {
+		return correctedAge
+	}
+	return apparentAge
+}
+
+func headerTime(header http.Header, name string, fallback time.Time) time.Time {
+	parsed, err := http.ParseTime(header.Get(name))
+	if err != nil {
+		return fallback
+	}
+	return parsed
+}
+
+func isUnsafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return false
+	}
+	return true
+}
+
+// matches tells whether the request has the same values for the headers the response varies on
+func (res *CachedResponse) matches(req *http.Request) bool {
+	for name, values := range res.RequestHeader {
+		if strings.Join(req.Header.Values(name), ",") != strings.Join(values, ",") {
+			return false
+		}
+	}
+	return true
+}
+
+// revalidation is req made conditional on the validators of the response
+func (res *CachedResponse) revalidation(req *http.Request) *http.Request {
+	etag, lastModified := res.Header.Get("ETag"), res.Header.Get("Last-Modified")
+	if etag == "" && lastModified == "" {
+		return req
+	}
+	revalidation := req.Clone(req.Context())
+	if etag != "" {
+		revalidation.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		revalidation.Header.Set("If-Modified-Since", lastModified)
+	}
+	return revalidation
+}
+
+// response builds the response to req from the cached one
+func (res *CachedResponse) response(req *http.Request, age time.Duration, state string) *http.Response {
+	header := res.Header.Clone()
+	header.Set("Age", strconv.Itoa(int(age/time.Second)))
+	header.Set(HeaderXCache, state)
+	if etagMatches(req.Header.Get("If-None-Match"), res.Header.Get("ETag")) {
+		response := syntheticResponse(req, http.StatusNotModified)
+		response.Header = header
+		return response
+	}
+	response := syntheticResponse(req, res.Status)
+	response.Header = header
+	if req.Method != http.MethodHead {
+		response.Body = io.NopCloser(bytes.NewReader(res.Body))
+		response.ContentLength = int64(len(res.Body))
+	}
+	return response
+}
+
+func syntheticResponse(req *http.Request, status int) *http.Response {
+	return &http.Response{
+		Status:     strconv.Itoa(status) + " " + http.StatusText(status),
+		StatusCode: status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{},
+		Body:       http.NoBody,
+		Request:    req,
+	}
+}
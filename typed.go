@@ -0,0 +1,152 @@
+package mnemosyne
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// TypedInstance is a cache instance holding values of type T, so callers neither pass refrences
+// nor type-assert the results. T is usually a pointer to a struct, e.g. Typed[*User](instance)
+type TypedInstance[T any] struct {
+	instance ICacheInstance
+}
+
+// Loader loads the value of a key on a cache miss
+type Loader[T any] func(ctx context.Context, key string) (T, error)
+
+// Typed wraps instance (a *MnemosyneInstance or any other ICacheInstance) with a typed API,
+// the untyped API of instance stays available
+func Typed[T any](instance ICacheInstance) *TypedInstance[T] {
+	return &TypedInstance[T]{instance: instance}
+}
+
+// Instance returns the wrapped instance
+func (ti *TypedInstance[T]) Instance() ICacheInstance {
+	return ti.instance
+}
+
+// newRefrence returns a refrence to decode a T into: a new *User for a T of *User, a *User for a T of User
+func (ti *TypedInstance[T]) newRefrence() interface{} {
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	if typ.Kind() == reflect.Ptr {
+		return reflect.New(typ.Elem()).Interface()
+	}
+	return new(T)
+}
+
+// value converts what a layer returned to T, layers keeping values as-is (e.g. fastmemory in zero-copy mode)
+// return whatever was set regardless of the refrence
+func (ti *TypedInstance[T]) value(res interface{}) (T, error) {
+	switch v := res.(type) {
+	case T:
+		return v, nil
+	case *T:
+		if v != nil {
+			return *v, nil
+		}
+	}
+	var zero T
+	return zero, newDecodeError(fmt.Errorf("cached value is a %T, not a %T", res, zero))
+}
+
+// Get retrieves the value for key
+func (ti *TypedInstance[T]) Get(ctx context.Context, key string) (T, error) {
+	value, _, err := ti.GetAndShouldUpdate(ctx, key)
+	return value, err
+}
+
+// GetAndShouldUpdate retrieves the value for key and also shows whether the soft-TTL of that key has passed or not
+func (ti *TypedInstance[T]) GetAndShouldUpdate(ctx context.Context, key string) (T, bool, error) {
+	res, shouldUpdate, err := ti.instance.GetAndShouldUpdate(ctx, key, ti.newRefrence())
+	if err != nil {
+		var zero T
+		return zero, shouldUpdate, err
+	}
+	value, err := ti.value(res)
+	return value, shouldUpdate, err
+}
+
+// GetOrLoad retrieves the value for key, loading and setting it when it is missing or its soft-TTL has passed.
+// If loading a stale value fails, the stale value is returned instead. The loaded value is returned
+// even when setting it fails, along with the error of Set
+func (ti *TypedInstance[T]) GetOrLoad(ctx context.Context, key string, loader Loader[T]) (T, error) {
+	cached, shouldUpdate, err := ti.GetAndShouldUpdate(ctx, key)
+	if err == nil && !shouldUpdate {
+		return cached, nil
+	}
+	stale := err == nil
+	value, err := loader(ctx, key)
+	if err != nil {
+		if stale {
+			return cached, nil
+		}
+		var zero T
+		return zero, err
+	}
+	return value, ti.Set(ctx, key, value)
+}
+
+// MGet retrieves the values of keys, the keys which miss are left out of the result.
+// The error holds the failures other than misses (e.g. of a layer which is down), if any.
+// Instances reading many keys at once (IBatchCacheInstance) look them all up with GetEntries
+func (ti *TypedInstance[T]) MGet(ctx context.Context, keys ...string) (map[string]T, error) {
+	values := make(map[string]T, len(keys))
+	var errs []error
+	for i, res := range ti.getMany(ctx, keys) {
+		key := keys[i]
+		value, err := res.value, res.err
+		if errors.Is(err, ErrMiss) {
+			continue
+		} else if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+			continue
+		}
+		values[key] = value
+	}
+	if len(errs) > 0 {
+		return values, &MultiError{Errors: errs}
+	}
+	return values, nil
+}
+
+type typedResult[T any] struct {
+	value T
+	err   error
+}
+
+// getMany retrieves the values of keys, with GetEntries if the instance has it
+func (ti *TypedInstance[T]) getMany(ctx context.Context, keys []string) []typedResult[T] {
+	results := make([]typedResult[T], len(keys))
+	batch, ok := ti.instance.(IBatchCacheInstance)
+	if !ok {
+		for i, key := range keys {
+			results[i].value, results[i].err = ti.Get(ctx, key)
+		}
+		return results
+	}
+	refrences := make([]interface{}, len(keys))
+	for i := range refrences {
+		refrences[i] = ti.newRefrence()
+	}
+	entries, errs := batch.GetEntries(ctx, keys, refrences)
+	for i := range keys {
+		if errs[i] != nil {
+			results[i].err = errs[i]
+			continue
+		}
+		results[i].value, results[i].err = ti.value(entries[i].Value)
+	}
+	return results
+}
+
+// Set sets the value for a key in all layers of the cache instance
+func (ti *TypedInstance[T]) Set(ctx context.Context, key string, value T) error {
+	return ti.instance.Set(ctx, key, value)
+}
+
+// Delete removes a key from all the layers (if exists)
+func (ti *TypedInstance[T]) Delete(ctx context.Context, key string) error {
+	return ti.instance.Delete(ctx, key)
+}
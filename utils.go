@@ -12,6 +12,11 @@ type amnesiaError struct {
 func (e *amnesiaError) Error() string {
 	return fmt.Sprintf("Had Amnesia (Chance:%d)", e.Chance)
 }
+
+// Is makes an amnesia match both ErrAmnesia and ErrMiss
+func (e *amnesiaError) Is(target error) bool {
+	return target == ErrAmnesia || target == ErrMiss
+}
 func newAmnesiaError(c int) *amnesiaError {
 	return &amnesiaError{Chance: c}
 }
@@ -0,0 +1,47 @@
+// Package zaplogger adapts zap loggers to mnemosyne.Logger
+package zaplogger
+
+import (
+	"sort"
+
+	"github.com/mghayour/mnemosyne"
+	"go.uber.org/zap"
+)
+
+type zapLogger struct {
+	base *zap.Logger
+}
+
+// New adapts a zap logger to mnemosyne.Logger
+func New(base *zap.Logger) mnemosyne.Logger {
+	return &zapLogger{base: base}
+}
+
+func (l *zapLogger) zapFields(fields mnemosyne.Fields) []zap.Field {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	zapFields := make([]zap.Field, 0, len(fields))
+	for _, name := range names {
+		if err, ok := fields[name].(error); ok {
+			zapFields = append(zapFields, zap.NamedError(name, err))
+		} else {
+			zapFields = append(zapFields, zap.Any(name, fields[name]))
+		}
+	}
+	return zapFields
+}
+
+func (l *zapLogger) Info(msg string, fields mnemosyne.Fields) {
+	l.base.Info(msg, l.zapFields(fields)...)
+}
+
+func (l *zapLogger) Warn(msg string, fields mnemosyne.Fields) {
+	l.base.Warn(msg, l.zapFields(fields)...)
+}
+
+func (l *zapLogger) Error(msg string, fields mnemosyne.Fields) {
+	l.base.Error(msg, l.zapFields(fields)...)
+}